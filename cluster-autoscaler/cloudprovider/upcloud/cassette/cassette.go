@@ -0,0 +1,280 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cassette implements HTTP transport that records UpCloud API interactions
+// into a file (cassette) and replays them later without network access or credentials.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Mode defines whether recorder records new or replays existing interactions
+type Mode int
+
+const (
+	// ModeReplay replays interactions from existing cassette file
+	ModeReplay Mode = iota
+	// ModeRecord forwards requests to real transport and records interactions into cassette file
+	ModeRecord
+)
+
+// EnvRecord is environment variable that switches recorders created with ModeFromEnv to record mode
+const EnvRecord string = "UPCLOUD_CASSETTE_RECORD"
+
+// Interaction represents single recorded request/response pair
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request represents recorded HTTP request
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// Response represents recorded HTTP response
+type Response struct {
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+}
+
+// SanitizeFn modifies interaction before it's written to the cassette
+type SanitizeFn func(*Interaction)
+
+// Recorder is http.RoundTripper that records or replays API interactions
+type Recorder struct {
+	path string
+	mode Mode
+	// limit is the maximum number of recorded interactions kept, oldest are dropped first. Zero means no limit.
+	limit        int
+	transport    http.RoundTripper
+	sanitizers   []SanitizeFn
+	interactions []Interaction
+	used         []bool
+
+	mu sync.Mutex
+}
+
+// ModeFromEnv returns ModeRecord if EnvRecord environment variable is set, otherwise ModeReplay
+func ModeFromEnv() Mode {
+	if os.Getenv(EnvRecord) != "" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// New creates new recorder using cassette file at path. In replay mode the cassette must exist.
+// Transport is used to perform real requests in record mode, http.DefaultTransport is used if nil.
+func New(path string, mode Mode, transport http.RoundTripper, sanitizers ...SanitizeFn) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	r := &Recorder{
+		path:         path,
+		mode:         mode,
+		transport:    transport,
+		sanitizers:   append([]SanitizeFn{sanitizeURL}, sanitizers...),
+		interactions: make([]Interaction, 0),
+	}
+	if mode == ModeReplay {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+		}
+		if err := json.Unmarshal(b, &r.interactions); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.interactions))
+	}
+	return r, nil
+}
+
+// NewTrace creates recorder that records at most limit latest interactions in memory.
+// Interactions are written to the file at path each time Stop is called, which makes it
+// suitable for capturing traces from long-running processes.
+func NewTrace(path string, limit int, transport http.RoundTripper, sanitizers ...SanitizeFn) *Recorder {
+	r, _ := New(path, ModeRecord, transport, sanitizers...)
+	r.limit = limit
+	return r
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	res, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	i := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Body:   string(body),
+		},
+		Response: Response{
+			StatusCode: res.StatusCode,
+			Headers:    map[string]string{"Content-Type": res.Header.Get("Content-Type")},
+			Body:       string(resBody),
+		},
+	}
+	for _, fn := range r.sanitizers {
+		fn(&i)
+	}
+	r.mu.Lock()
+	r.interactions = append(r.interactions, i)
+	if r.limit > 0 && len(r.interactions) > r.limit {
+		r.interactions = append([]Interaction(nil), r.interactions[len(r.interactions)-r.limit:]...)
+	}
+	r.mu.Unlock()
+	return newResponse(req, i.Response), nil
+}
+
+// replay returns the first unused interaction matching request method, URL and body.
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	url := sanitizedURL(req.URL.String())
+	for i := range r.interactions {
+		if r.used[i] {
+			continue
+		}
+		rec := r.interactions[i].Request
+		if rec.Method == req.Method && rec.URL == url && rec.Body == string(body) {
+			r.used[i] = true
+			return newResponse(req, r.interactions[i].Response), nil
+		}
+	}
+	return nil, fmt.Errorf("cassette %s has no unused interaction for %s %s", r.path, req.Method, url)
+}
+
+// Unused returns interactions that haven't been replayed
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unused := make([]Interaction, 0)
+	for i := range r.used {
+		if !r.used[i] {
+			unused = append(unused, r.interactions[i])
+		}
+	}
+	return unused
+}
+
+// Stop writes recorded interactions to the cassette file. It's no-op in replay mode.
+// In record mode Stop can be called multiple times, each call overwrites the file.
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, b, 0o600)
+}
+
+// ReplaceString returns sanitizer that replaces every occurrence of old with new in URLs and bodies.
+// It can be used to replace e.g. real cluster UUID with a static one.
+func ReplaceString(old, new string) SanitizeFn {
+	return func(i *Interaction) {
+		if old == "" {
+			return
+		}
+		i.Request.URL = strings.ReplaceAll(i.Request.URL, old, new)
+		i.Request.Body = strings.ReplaceAll(i.Request.Body, old, new)
+		i.Response.Body = strings.ReplaceAll(i.Response.Body, old, new)
+	}
+}
+
+func sanitizeURL(i *Interaction) {
+	i.Request.URL = sanitizedURL(i.Request.URL)
+}
+
+// sanitizedURL strips possible user info from the URL so that credentials never end up in the cassette.
+func sanitizedURL(u string) string {
+	scheme, rest, ok := strings.Cut(u, "://")
+	if !ok {
+		return u
+	}
+	host, path, _ := strings.Cut(rest, "/")
+	if _, h, ok := strings.Cut(host, "@"); ok {
+		host = h
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, host, path)
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+func newResponse(req *http.Request, r Response) *http.Response {
+	header := make(http.Header)
+	for k, v := range r.Headers {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
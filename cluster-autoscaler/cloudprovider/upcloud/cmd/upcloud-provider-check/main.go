@@ -0,0 +1,248 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// upcloud-provider-check verifies UpCloud credentials, cluster ID and permissions by exercising
+// the UpCloud cloud provider the same way cluster autoscaler does.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/klog/v2"
+)
+
+const timeoutScaleUp time.Duration = time.Minute * 20
+
+type nodeGroupSpecs []string
+
+func (n *nodeGroupSpecs) String() string {
+	return strings.Join(*n, ",")
+}
+
+func (n *nodeGroupSpecs) Set(v string) error {
+	*n = append(*n, v)
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run checks the provider and returns error if a check fails. Errors are returned instead of exiting, so that
+// the provider is cleaned up.
+func run() error {
+	var (
+		specs          nodeGroupSpecs
+		discoverySpecs nodeGroupSpecs
+		scaleTestGroup string
+		confirm        bool
+		validate       bool
+		debug          bool
+	)
+	klog.InitFlags(nil)
+	flag.Var(&specs, "nodes", "node group spec in format <min>:<max>:<node_group_name>, can be used multiple times")
+	flag.Var(&discoverySpecs, "node-group-auto-discovery", "node group auto-discovery spec in format label:<key>=<value>[,<key>=<value>], can be used multiple times")
+	flag.StringVar(&scaleTestGroup, "scale-test-group", "", "name of the node group used to run +1/-1 scale test")
+	flag.BoolVar(&confirm, "confirm", false, "confirm that scale test is allowed to add and remove a node from the scale test group")
+	flag.BoolVar(&validate, "validate-specs", false, "print effective size limits of node groups and exit with error if some --nodes spec doesn't match any node group")
+	flag.BoolVar(&debug, "debug", false, "print JSON document of the cluster and node groups, including nodes and in-flight operations")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Required environment variables: UPCLOUD_USERNAME, UPCLOUD_PASSWORD, UPCLOUD_CLUSTER_ID\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if scaleTestGroup != "" && !confirm {
+		return fmt.Errorf("scale test adds and removes a node from node group %s, use --confirm to allow it", scaleTestGroup)
+	}
+
+	provider := upcloud.BuildUpCloud(
+		config.AutoscalingOptions{CloudProviderName: cloudprovider.UpCloudProviderName, UserAgent: "upcloud-provider-check"},
+		cloudprovider.NodeGroupDiscoveryOptions{NodeGroupSpecs: specs, NodeGroupAutoDiscoverySpecs: discoverySpecs},
+		nil,
+	)
+	defer provider.Cleanup() //nolint: errcheck
+
+	if err := provider.Refresh(); err != nil {
+		return fmt.Errorf("failed to refresh node groups: %w", err)
+	}
+	if d, ok := provider.(interface{ Debug() string }); ok && debug {
+		fmt.Println(d.Debug())
+		return nil
+	}
+	if validate {
+		v, err := validateSpecs(provider.NodeGroups(), specs)
+		if err != nil {
+			return err
+		}
+		printSpecValidation(os.Stdout, v)
+		if len(v.unmatched) > 0 {
+			return fmt.Errorf("%d node group specs don't match any node group", len(v.unmatched))
+		}
+		return nil
+	}
+	printNodeGroups(provider.NodeGroups())
+
+	if scaleTestGroup == "" {
+		return nil
+	}
+	if err := scaleTest(provider, scaleTestGroup); err != nil {
+		return fmt.Errorf("scale test failed: %w", err)
+	}
+	fmt.Println("scale test succeeded")
+	return nil
+}
+
+func printNodeGroups(groups []cloudprovider.NodeGroup) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE GROUP\tMIN\tMAX\tTARGET\tNODES\tTEMPLATE")
+	for _, g := range groups {
+		target, err := g.TargetSize()
+		if err != nil {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%v\t-\t-\n", g.Id(), g.MinSize(), g.MaxSize(), err)
+			continue
+		}
+		nodes := "-"
+		if instances, err := g.Nodes(); err == nil {
+			nodes = fmt.Sprintf("%d", len(instances))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", g.Id(), g.MinSize(), g.MaxSize(), target, nodes, templateSummary(g))
+	}
+	_ = w.Flush()
+}
+
+func templateSummary(g cloudprovider.NodeGroup) string {
+	info, err := g.TemplateNodeInfo()
+	if errors.Is(err, cloudprovider.ErrNotImplemented) {
+		return "not implemented"
+	}
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	allocatable := info.Node().Status.Allocatable
+	return fmt.Sprintf("cpu=%s memory=%s pods=%s", allocatable.Cpu(), allocatable.Memory(), allocatable.Pods())
+}
+
+// scaleTest increases node group size by one and removes the new node after it's provisioned.
+func scaleTest(provider cloudprovider.CloudProvider, name string) error {
+	group := nodeGroupByName(provider.NodeGroups(), name)
+	if group == nil {
+		return fmt.Errorf("node group %s not found", name)
+	}
+	target, err := group.TargetSize()
+	if err != nil {
+		return err
+	}
+	if target+1 > group.MaxSize() {
+		return fmt.Errorf("node group %s is already at max size %d", name, group.MaxSize())
+	}
+	before, err := instanceIDs(group)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("scaling node group %s from %d to %d nodes\n", name, target, target+1)
+	if err := group.IncreaseSize(1); err != nil {
+		return err
+	}
+	node, group, err := waitNewNode(provider, name, before)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("deleting node %s from node group %s\n", node.Spec.ProviderID, name)
+	if err := group.DeleteNodes([]*apiv1.Node{node}); err != nil {
+		return fmt.Errorf("failed to delete node %s, node group %s needs to be scaled down manually: %w", node.Spec.ProviderID, name, err)
+	}
+	return nil
+}
+
+// waitNewNode refreshes node groups until the new node is running, because scale up doesn't wait for the node to be provisioned.
+func waitNewNode(provider cloudprovider.CloudProvider, name string, before map[string]bool) (*apiv1.Node, cloudprovider.NodeGroup, error) {
+	deadline := time.Now().Add(timeoutScaleUp)
+	for {
+		if err := provider.Refresh(); err != nil {
+			return nil, nil, err
+		}
+		group := nodeGroupByName(provider.NodeGroups(), name)
+		if group == nil {
+			return nil, nil, fmt.Errorf("node group %s disappeared after scale up", name)
+		}
+		node, err := newNode(name, group, before)
+		if err != nil || node != nil {
+			return node, group, err
+		}
+		if time.Now().After(deadline) {
+			return nil, nil, fmt.Errorf("new node of node group %s is not running after %s, node group needs to be scaled down manually", name, timeoutScaleUp)
+		}
+		fmt.Printf("waiting for new node of node group %s to be running\n", name)
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// newNode returns Kubernetes node object of the node group instance that didn't exist before scale up. Node only
+// has provider ID, which the provider uses to resolve UpCloud node. Nil node is returned if the new instance isn't
+// running yet.
+func newNode(name string, group cloudprovider.NodeGroup, before map[string]bool) (*apiv1.Node, error) {
+	after, err := group.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range after {
+		if before[instance.Id] {
+			continue
+		}
+		if instance.Status == nil || instance.Status.State != cloudprovider.InstanceRunning {
+			return nil, nil
+		}
+		return &apiv1.Node{Spec: apiv1.NodeSpec{ProviderID: instance.Id}}, nil
+	}
+	return nil, fmt.Errorf("unable to find new node from node group %s, node group needs to be scaled down manually", name)
+}
+
+func nodeGroupByName(groups []cloudprovider.NodeGroup, name string) cloudprovider.NodeGroup {
+	for _, g := range groups {
+		if nodeGroupName(g) == name {
+			return g
+		}
+	}
+	return nil
+}
+
+func instanceIDs(group cloudprovider.NodeGroup) (map[string]bool, error) {
+	instances, err := group.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(instances))
+	for _, i := range instances {
+		ids[i.Id] = true
+	}
+	return ids, nil
+}
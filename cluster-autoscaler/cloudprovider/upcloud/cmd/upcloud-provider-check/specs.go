@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/config/dynamic"
+)
+
+const (
+	limitSourceSpec         string = "--nodes"
+	limitSourceLabel        string = "label"
+	limitSourceAntiAffinity string = "anti-affinity"
+	limitSourceDefault      string = "default"
+)
+
+// limitSourcer is implemented by UpCloud node groups, which know where their size limits come from
+type limitSourcer interface {
+	SizeLimitSource() string
+}
+
+// nodeGroupLimits is the effective size limits of a node group
+type nodeGroupLimits struct {
+	name    string
+	minSize int
+	maxSize int
+	source  string
+}
+
+// specValidation is the result of matching node group specs against cluster node groups
+type specValidation struct {
+	groups    []nodeGroupLimits
+	unmatched []string
+}
+
+// validateSpecs matches node group specs to node groups the same way as the provider does, and returns effective
+// limits of each group together with specs that aren't used by any node group.
+func validateSpecs(groups []cloudprovider.NodeGroup, specs []string) (specValidation, error) {
+	v := specValidation{
+		groups:    make([]nodeGroupLimits, 0, len(groups)),
+		unmatched: make([]string, 0),
+	}
+	parsed := make(map[string]dynamic.NodeGroupSpec, len(specs))
+	specNames := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		// provider has already validated the specs, so scale to zero is allowed here
+		s, err := dynamic.SpecFromString(spec, true)
+		if err != nil {
+			return v, fmt.Errorf("invalid node group spec %s: %w", spec, err)
+		}
+		parsed[s.Name] = *s
+		specNames[s.Name] = spec
+	}
+	matched := make(map[string]bool, len(specNames))
+	for _, g := range groups {
+		name := nodeGroupName(g)
+		limits := nodeGroupLimits{
+			name:    name,
+			minSize: g.MinSize(),
+			maxSize: g.MaxSize(),
+			source:  limitSourceDefault,
+		}
+		if s, ok := upcloud.MatchNodeGroupSpec(parsed, name); ok {
+			limits.source = limitSourceSpec
+			matched[s.Name] = true
+		}
+		if ls, ok := g.(limitSourcer); ok {
+			limits.source = ls.SizeLimitSource()
+		}
+		v.groups = append(v.groups, limits)
+	}
+	for name, spec := range specNames {
+		if !matched[name] {
+			v.unmatched = append(v.unmatched, spec)
+		}
+	}
+	sort.Strings(v.unmatched)
+	return v, nil
+}
+
+func printSpecValidation(w io.Writer, v specValidation) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE GROUP\tMIN\tMAX\tSOURCE")
+	for _, g := range v.groups {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", g.name, g.minSize, g.maxSize, g.source)
+	}
+	_ = tw.Flush()
+	if len(v.unmatched) > 0 {
+		fmt.Fprintf(w, "\nnode group specs not matching any node group:\n")
+		for _, spec := range v.unmatched {
+			fmt.Fprintf(w, "  %s\n", spec)
+		}
+	}
+}
+
+// nodeGroupName returns node group name from the node group ID, which has format <cluster ID>/<name>
+func nodeGroupName(g cloudprovider.NodeGroup) string {
+	id := g.Id()
+	return id[strings.LastIndex(id, "/")+1:]
+}
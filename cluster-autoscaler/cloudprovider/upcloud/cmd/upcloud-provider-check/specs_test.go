@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+)
+
+func TestValidateSpecs(t *testing.T) {
+	t.Parallel()
+
+	provider := test.NewTestCloudProvider(nil, nil)
+	provider.AddNodeGroup("cluster/dev", 2, 3, 2)
+	provider.AddNodeGroup("cluster/default", 1, 20, 1)
+	groups := []cloudprovider.NodeGroup{
+		provider.GetNodeGroup("cluster/dev"),
+		provider.GetNodeGroup("cluster/default"),
+	}
+
+	v, err := validateSpecs(groups, []string{"2:3:dev", "1:5:typo"})
+	require.NoError(t, err)
+	require.Equal(t, []nodeGroupLimits{
+		{name: "dev", minSize: 2, maxSize: 3, source: limitSourceSpec},
+		{name: "default", minSize: 1, maxSize: 20, source: limitSourceDefault},
+	}, v.groups)
+	require.Equal(t, []string{"1:5:typo"}, v.unmatched)
+
+	var out bytes.Buffer
+	printSpecValidation(&out, v)
+	require.Contains(t, out.String(), "1:5:typo")
+
+	_, err = validateSpecs(groups, []string{"dev"})
+	require.Error(t, err)
+}
+
+func TestValidateSpecs_Pattern(t *testing.T) {
+	t.Parallel()
+
+	provider := test.NewTestCloudProvider(nil, nil)
+	provider.AddNodeGroup("cluster/worker-1", 1, 10, 1)
+	provider.AddNodeGroup("cluster/worker-2", 2, 3, 2)
+	provider.AddNodeGroup("cluster/gpu", 0, 4, 0)
+	provider.AddNodeGroup("cluster/default", 1, 20, 1)
+	groups := []cloudprovider.NodeGroup{
+		provider.GetNodeGroup("cluster/worker-1"),
+		provider.GetNodeGroup("cluster/worker-2"),
+		provider.GetNodeGroup("cluster/gpu"),
+		provider.GetNodeGroup("cluster/default"),
+	}
+
+	v, err := validateSpecs(groups, []string{"1:10:worker-*", "2:3:worker-2", "0:4:/gpu|tpu/", "1:5:db-*"})
+	require.NoError(t, err)
+	require.Equal(t, []nodeGroupLimits{
+		{name: "worker-1", minSize: 1, maxSize: 10, source: limitSourceSpec},
+		{name: "worker-2", minSize: 2, maxSize: 3, source: limitSourceSpec},
+		{name: "gpu", minSize: 0, maxSize: 4, source: limitSourceSpec},
+		{name: "default", minSize: 1, maxSize: 20, source: limitSourceDefault},
+	}, v.groups)
+	require.Equal(t, []string{"1:5:db-*"}, v.unmatched)
+}
+
+// sourcedNodeGroup is node group that reports the source of its size limits like UpCloud node groups do
+type sourcedNodeGroup struct {
+	cloudprovider.NodeGroup
+	source string
+}
+
+func (g sourcedNodeGroup) SizeLimitSource() string {
+	return g.source
+}
+
+func TestValidateSpecs_LimitSource(t *testing.T) {
+	t.Parallel()
+
+	provider := test.NewTestCloudProvider(nil, nil)
+	provider.AddNodeGroup("cluster/labeled", 2, 8, 2)
+	provider.AddNodeGroup("cluster/spread", 1, 3, 1)
+	provider.AddNodeGroup("cluster/dev", 2, 3, 2)
+	provider.AddNodeGroup("cluster/default", 1, 20, 1)
+	groups := []cloudprovider.NodeGroup{
+		sourcedNodeGroup{provider.GetNodeGroup("cluster/labeled"), limitSourceLabel},
+		sourcedNodeGroup{provider.GetNodeGroup("cluster/spread"), limitSourceAntiAffinity},
+		sourcedNodeGroup{provider.GetNodeGroup("cluster/dev"), limitSourceSpec},
+		sourcedNodeGroup{provider.GetNodeGroup("cluster/default"), limitSourceDefault},
+	}
+
+	// spec that anti-affinity cap overrides is still matched
+	v, err := validateSpecs(groups, []string{"1:10:spread", "2:3:dev"})
+	require.NoError(t, err)
+	require.Equal(t, []nodeGroupLimits{
+		{name: "labeled", minSize: 2, maxSize: 8, source: limitSourceLabel},
+		{name: "spread", minSize: 1, maxSize: 3, source: limitSourceAntiAffinity},
+		{name: "dev", minSize: 2, maxSize: 3, source: limitSourceSpec},
+		{name: "default", minSize: 1, maxSize: 20, source: limitSourceDefault},
+	}, v.groups)
+	require.Empty(t, v.unmatched)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mocks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/client"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+)
+
+// NewAPIServer returns test server that serves the UKS and server plan endpoints used by the autoscaler from svc.
+// Requests and responses use the JSON format of the real API, so SDK client can be pointed to the server,
+// e.g. client.New("user", "pass", client.WithBaseURL(server.URL)). Errors are returned as problem JSON
+// documents. Caller must close the server.
+func NewAPIServer(svc *UpCloudService) *httptest.Server {
+	prefix := "/" + client.APIVersion + "/kubernetes"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+prefix, func(w http.ResponseWriter, r *http.Request) {
+		v, err := svc.GetKubernetesClusters(r.Context(), &request.GetKubernetesClustersRequest{})
+		writeResponse(w, http.StatusOK, v, err)
+	})
+	mux.HandleFunc("GET "+prefix+"/plans", func(w http.ResponseWriter, r *http.Request) {
+		v, err := svc.GetKubernetesPlans(r.Context(), &request.GetKubernetesPlansRequest{})
+		writeResponse(w, http.StatusOK, v, err)
+	})
+	mux.HandleFunc("GET "+prefix+"/{cluster}", func(w http.ResponseWriter, r *http.Request) {
+		v, err := svc.GetKubernetesCluster(r.Context(), &request.GetKubernetesClusterRequest{UUID: r.PathValue("cluster")})
+		writeResponse(w, http.StatusOK, v, err)
+	})
+	mux.HandleFunc("GET "+prefix+"/{cluster}/node-groups", func(w http.ResponseWriter, r *http.Request) {
+		v, err := svc.GetKubernetesNodeGroups(r.Context(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: r.PathValue("cluster")})
+		writeResponse(w, http.StatusOK, v, err)
+	})
+	mux.HandleFunc("POST "+prefix+"/{cluster}/node-groups", func(w http.ResponseWriter, r *http.Request) {
+		req := &request.CreateKubernetesNodeGroupRequest{ClusterUUID: r.PathValue("cluster")}
+		if !readRequest(w, r, &req.NodeGroup) {
+			return
+		}
+		v, err := svc.CreateKubernetesNodeGroup(r.Context(), req)
+		writeResponse(w, http.StatusCreated, v, err)
+	})
+	mux.HandleFunc("GET "+prefix+"/{cluster}/node-groups/{name}", func(w http.ResponseWriter, r *http.Request) {
+		v, err := svc.GetKubernetesNodeGroup(r.Context(), &request.GetKubernetesNodeGroupRequest{
+			ClusterUUID: r.PathValue("cluster"),
+			Name:        r.PathValue("name"),
+		})
+		writeResponse(w, http.StatusOK, v, err)
+	})
+	mux.HandleFunc("PATCH "+prefix+"/{cluster}/node-groups/{name}", func(w http.ResponseWriter, r *http.Request) {
+		req := &request.ModifyKubernetesNodeGroupRequest{ClusterUUID: r.PathValue("cluster"), Name: r.PathValue("name")}
+		if !readRequest(w, r, &req.NodeGroup) {
+			return
+		}
+		v, err := svc.ModifyKubernetesNodeGroup(r.Context(), req)
+		writeResponse(w, http.StatusAccepted, v, err)
+	})
+	mux.HandleFunc("DELETE "+prefix+"/{cluster}/node-groups/{name}", func(w http.ResponseWriter, r *http.Request) {
+		err := svc.DeleteKubernetesNodeGroup(r.Context(), &request.DeleteKubernetesNodeGroupRequest{
+			ClusterUUID: r.PathValue("cluster"),
+			Name:        r.PathValue("name"),
+		})
+		writeResponse(w, http.StatusNoContent, nil, err)
+	})
+	mux.HandleFunc("DELETE "+prefix+"/{cluster}/node-groups/{name}/{node}", func(w http.ResponseWriter, r *http.Request) {
+		err := svc.DeleteKubernetesNodeGroupNode(r.Context(), &request.DeleteKubernetesNodeGroupNodeRequest{
+			ClusterUUID: r.PathValue("cluster"),
+			Name:        r.PathValue("name"),
+			NodeName:    r.PathValue("node"),
+		})
+		writeResponse(w, http.StatusNoContent, nil, err)
+	})
+	mux.HandleFunc("GET /"+client.APIVersion+"/plan", func(w http.ResponseWriter, r *http.Request) {
+		v, err := svc.GetPlans(r.Context(), &sdkext.GetPlansRequest{})
+		res := struct {
+			Plans struct {
+				Plan []sdkext.Plan `json:"plan"`
+			} `json:"plans"`
+		}{}
+		res.Plans.Plan = v
+		writeResponse(w, http.StatusOK, res, err)
+	})
+	return httptest.NewServer(mux)
+}
+
+// readRequest decodes request body into v and writes bad request problem if the body is invalid
+func readRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		p := newProblem(http.StatusBadRequest)
+		p.Title = err.Error()
+		writeProblem(w, p)
+		return false
+	}
+	return true
+}
+
+// writeResponse writes v as JSON response or err as problem. Errors that are not problems are returned as not
+// found, or as gateway timeout if the call was cancelled.
+func writeResponse(w http.ResponseWriter, status int, v interface{}, err error) {
+	if err != nil {
+		var p *upcloud.Problem
+		if !errors.As(err, &p) {
+			p = newProblem(http.StatusNotFound)
+			p.Title = err.Error()
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				p = newProblem(http.StatusGatewayTimeout)
+			}
+		}
+		writeProblem(w, p)
+		return
+	}
+	if v == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeProblem(w http.ResponseWriter, p *upcloud.Problem) {
+	status := p.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(p)
+}
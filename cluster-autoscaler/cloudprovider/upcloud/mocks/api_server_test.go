@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mocks
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/client"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+)
+
+func TestAPIServer(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	server := NewAPIServer(newService(clusterID))
+	defer server.Close()
+	svc := sdkext.NewService(client.New("user", "pass", client.WithBaseURL(server.URL)))
+	ctx := context.TODO()
+
+	clusters, err := svc.GetKubernetesClusters(ctx, &request.GetKubernetesClustersRequest{})
+	require.NoError(t, err)
+	require.Len(t, clusters, 1)
+	cluster, err := svc.GetKubernetesCluster(ctx, &request.GetKubernetesClusterRequest{UUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Equal(t, TestZone, cluster.Zone)
+	plans, err := svc.GetKubernetesPlans(ctx, &request.GetKubernetesPlansRequest{})
+	require.NoError(t, err)
+	require.NotEmpty(t, plans)
+	serverPlans, err := svc.GetPlans(ctx, &sdkext.GetPlansRequest{})
+	require.NoError(t, err)
+	require.Equal(t, TestServerPlans, serverPlans)
+
+	group, err := svc.ModifyKubernetesNodeGroup(ctx, &request.ModifyKubernetesNodeGroupRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+		NodeGroup:   request.ModifyKubernetesNodeGroup{Count: 3},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, group.Count)
+	details, err := svc.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group1"})
+	require.NoError(t, err)
+	require.Len(t, details.Nodes, 3)
+	require.NoError(t, svc.DeleteKubernetesNodeGroupNode(ctx, &request.DeleteKubernetesNodeGroupNodeRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+		NodeName:    details.Nodes[0].Name,
+	}))
+
+	_, err = svc.CreateKubernetesNodeGroup(ctx, &request.CreateKubernetesNodeGroupRequest{
+		ClusterUUID: clusterID.String(),
+		NodeGroup: request.KubernetesNodeGroup{
+			Count:  1,
+			Name:   "group2",
+			Plan:   TestNodeGroupPlan,
+			Labels: []upcloud.Label{{Key: "role", Value: "worker"}},
+		},
+	})
+	require.NoError(t, err)
+	groups, err := svc.GetKubernetesNodeGroups(ctx, &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, 2, groups[0].Count)
+	require.Equal(t, []upcloud.Label{{Key: "role", Value: "worker"}}, groups[1].Labels)
+	require.NoError(t, svc.DeleteKubernetesNodeGroup(ctx, &request.DeleteKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group2"}))
+
+	_, err = svc.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group2"})
+	requireProblemStatus(t, err, http.StatusNotFound)
+}
+
+func TestAPIServer_CustomPlan(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	server := NewAPIServer(NewTestCluster(clusterID).WithNodeGroups(
+		NewTestNodeGroup("group1").WithNodes(1),
+		NewTestNodeGroup("custom").WithCustomPlan(2, 6144, 50).WithNodes(1),
+	).Service())
+	defer server.Close()
+	svc := sdkext.NewService(client.New("user", "pass", client.WithBaseURL(server.URL)))
+
+	groups, err := svc.GetKubernetesNodeGroups(context.TODO(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Nil(t, groups[0].CustomPlan)
+	require.Equal(t, "custom", groups[1].Name)
+	require.Equal(t, "custom", groups[1].Plan)
+	require.Equal(t, &sdkext.KubernetesNodeGroupCustomPlan{Cores: 2, Memory: 6144, StorageSize: 50}, groups[1].CustomPlan)
+}
+
+func TestAPIServer_Faults(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	mock := newService(clusterID)
+	server := NewAPIServer(mock)
+	defer server.Close()
+	svc := sdkext.NewService(client.New("user", "pass", client.WithBaseURL(server.URL)))
+
+	mock.SetFaults(Faults{RateLimitedCalls: 1})
+	_, err := svc.GetKubernetesNodeGroups(context.TODO(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	requireProblemStatus(t, err, http.StatusTooManyRequests)
+	_, err = svc.GetKubernetesNodeGroups(context.TODO(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	require.NoError(t, err)
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mocks
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/google/uuid"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+)
+
+const (
+	// TestClusterPlan is the default plan of test clusters
+	TestClusterPlan string = "dev"
+	// TestClusterPlanMaxNodes is the default max nodes of the test cluster plan
+	TestClusterPlanMaxNodes int = 20
+	// TestNodeGroupPlan is the default plan of test node groups
+	TestNodeGroupPlan string = "2xCPU-4GB"
+	// TestZone is the default zone of test clusters
+	TestZone string = "fi-hel1"
+)
+
+// TestServerPlans are the server plans listed by test services
+var TestServerPlans = []sdkext.Plan{
+	{Name: "1xCPU-2GB", CoreNumber: 1, MemoryAmount: 2048, StorageSize: 50, StorageTier: "maxiops"},
+	{Name: "2xCPU-4GB", CoreNumber: 2, MemoryAmount: 4096, StorageSize: 80, StorageTier: "maxiops"},
+	{Name: "4xCPU-8GB", CoreNumber: 4, MemoryAmount: 8192, StorageSize: 160, StorageTier: "maxiops"},
+	{Name: "DEV-1xCPU-1GB-10GB", CoreNumber: 1, MemoryAmount: 1024, StorageSize: 10, StorageTier: "standard"},
+	{Name: "HIMEM-4xCPU-32GB", CoreNumber: 4, MemoryAmount: 32768, StorageSize: 100, StorageTier: "maxiops"},
+	{Name: "GPU-8xCPU-64GB-1xL40S", CoreNumber: 8, MemoryAmount: 65536, StorageSize: 300, StorageTier: "maxiops", GPUAmount: 1, GPUModel: "NVIDIA L40S"},
+}
+
+// TestNodeGroup builds UKS node group fixtures
+type TestNodeGroup struct {
+	group      upcloud.KubernetesNodeGroup
+	customPlan *sdkext.KubernetesNodeGroupCustomPlan
+}
+
+// NewTestNodeGroup returns builder for running node group without nodes
+func NewTestNodeGroup(name string) *TestNodeGroup {
+	return &TestNodeGroup{
+		group: upcloud.KubernetesNodeGroup{
+			Name:  name,
+			Plan:  TestNodeGroupPlan,
+			State: upcloud.KubernetesNodeGroupStateRunning,
+		},
+	}
+}
+
+// WithPlan sets node group server plan
+func (b *TestNodeGroup) WithPlan(plan string) *TestNodeGroup {
+	b.group.Plan = plan
+	return b
+}
+
+// WithCustomPlan sets node group custom plan, memory is in MiB and storage in GB
+func (b *TestNodeGroup) WithCustomPlan(cores, memory, storage int) *TestNodeGroup {
+	b.group.Plan = "custom"
+	b.customPlan = &sdkext.KubernetesNodeGroupCustomPlan{Cores: cores, Memory: memory, StorageSize: storage}
+	return b
+}
+
+// WithNodes sets node group node count
+func (b *TestNodeGroup) WithNodes(count int) *TestNodeGroup {
+	b.group.Count = count
+	return b
+}
+
+// WithState sets node group state
+func (b *TestNodeGroup) WithState(state upcloud.KubernetesNodeGroupState) *TestNodeGroup {
+	b.group.State = state
+	return b
+}
+
+// WithLabel adds node group label
+func (b *TestNodeGroup) WithLabel(key, value string) *TestNodeGroup {
+	b.group.Labels = append(b.group.Labels, upcloud.Label{Key: key, Value: value})
+	return b
+}
+
+// WithTaint adds node group taint
+func (b *TestNodeGroup) WithTaint(key, value string, effect upcloud.KubernetesClusterTaintEffect) *TestNodeGroup {
+	b.group.Taints = append(b.group.Taints, upcloud.KubernetesTaint{Key: key, Value: value, Effect: effect})
+	return b
+}
+
+// WithAntiAffinity enables node group anti-affinity
+func (b *TestNodeGroup) WithAntiAffinity() *TestNodeGroup {
+	b.group.AntiAffinity = true
+	return b
+}
+
+// NodeGroup returns node group object
+func (b *TestNodeGroup) NodeGroup() upcloud.KubernetesNodeGroup {
+	g := b.group
+	g.Labels = append([]upcloud.Label(nil), b.group.Labels...)
+	g.Taints = append([]upcloud.KubernetesTaint(nil), b.group.Taints...)
+	return g
+}
+
+// Details returns node group details object with running nodes
+func (b *TestNodeGroup) Details() upcloud.KubernetesNodeGroupDetails {
+	g := b.NodeGroup()
+	return upcloud.KubernetesNodeGroupDetails{
+		KubernetesNodeGroup: g,
+		Nodes:               NewTestNodes(&g),
+	}
+}
+
+// NewTestNodes returns running nodes of the node group. Node UUID and name are derived from the node group name
+// and node index, so same node group always produces same nodes.
+func NewTestNodes(nodeGroup *upcloud.KubernetesNodeGroup) []upcloud.KubernetesNode {
+	nodes := make([]upcloud.KubernetesNode, nodeGroup.Count)
+	for i := 0; i < nodeGroup.Count; i++ {
+		nodes[i] = upcloud.KubernetesNode{
+			UUID:  fmt.Sprintf("%s-%d", nodeGroup.Name, i),
+			Name:  fmt.Sprintf("%s-node-%d", nodeGroup.Name, i),
+			State: upcloud.KubernetesNodeStateRunning,
+		}
+	}
+	return nodes
+}
+
+// TestCluster builds UKS cluster fixtures
+type TestCluster struct {
+	cluster     upcloud.KubernetesCluster
+	plans       []upcloud.KubernetesPlan
+	customPlans map[string]*sdkext.KubernetesNodeGroupCustomPlan
+	serverPlans []sdkext.Plan
+}
+
+// NewTestCluster returns builder for running cluster using TestClusterPlan
+func NewTestCluster(clusterID uuid.UUID) *TestCluster {
+	return &TestCluster{
+		cluster: upcloud.KubernetesCluster{
+			UUID:       clusterID.String(),
+			Plan:       TestClusterPlan,
+			State:      upcloud.KubernetesClusterStateRunning,
+			Zone:       TestZone,
+			NodeGroups: make([]upcloud.KubernetesNodeGroup, 0),
+		},
+		plans: []upcloud.KubernetesPlan{{
+			Name:     TestClusterPlan,
+			MaxNodes: TestClusterPlanMaxNodes,
+		}},
+		serverPlans: append([]sdkext.Plan(nil), TestServerPlans...),
+	}
+}
+
+// WithPlan sets cluster plan and adds it to available plans
+func (b *TestCluster) WithPlan(name string, maxNodes int) *TestCluster {
+	b.cluster.Plan = name
+	b.plans = append(b.plans, upcloud.KubernetesPlan{Name: name, MaxNodes: maxNodes})
+	return b
+}
+
+// WithServerPlans adds server plans to the plans listed by the service
+func (b *TestCluster) WithServerPlans(plans ...sdkext.Plan) *TestCluster {
+	b.serverPlans = append(b.serverPlans, plans...)
+	return b
+}
+
+// WithZone sets cluster zone
+func (b *TestCluster) WithZone(zone string) *TestCluster {
+	b.cluster.Zone = zone
+	return b
+}
+
+// WithNodeGroups adds node groups to the cluster
+func (b *TestCluster) WithNodeGroups(groups ...*TestNodeGroup) *TestCluster {
+	for _, g := range groups {
+		b.cluster.NodeGroups = append(b.cluster.NodeGroups, g.NodeGroup())
+		if g.customPlan != nil {
+			if b.customPlans == nil {
+				b.customPlans = make(map[string]*sdkext.KubernetesNodeGroupCustomPlan)
+			}
+			p := *g.customPlan
+			b.customPlans[b.cluster.UUID+"/"+g.group.Name] = &p
+		}
+	}
+	return b
+}
+
+// Cluster returns cluster object
+func (b *TestCluster) Cluster() upcloud.KubernetesCluster {
+	c := b.cluster
+	c.NodeGroups = append([]upcloud.KubernetesNodeGroup(nil), b.cluster.NodeGroups...)
+	return c
+}
+
+// Service returns mock service serving the cluster
+func (b *TestCluster) Service() *UpCloudService {
+	return &UpCloudService{
+		Clusters:    map[string]upcloud.KubernetesCluster{b.cluster.UUID: b.Cluster()},
+		Plans:       append([]upcloud.KubernetesPlan(nil), b.plans...),
+		CustomPlans: maps.Clone(b.customPlans),
+		ServerPlans: append([]sdkext.Plan(nil), b.serverPlans...),
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mocks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+)
+
+func TestTestNodeGroup(t *testing.T) {
+	t.Parallel()
+
+	b := NewTestNodeGroup("gpu").
+		WithPlan("GPU-8xCPU-64GB-1xL40S").
+		WithNodes(3).
+		WithLabel("env", "test").
+		WithTaint("gpu", "true", upcloud.KubernetesClusterTaintEffectNoSchedule).
+		WithAntiAffinity()
+	g := b.Details()
+	require.Equal(t, "gpu", g.Name)
+	require.Equal(t, "GPU-8xCPU-64GB-1xL40S", g.Plan)
+	require.Equal(t, 3, g.Count)
+	require.True(t, g.AntiAffinity)
+	require.Equal(t, []upcloud.Label{{Key: "env", Value: "test"}}, g.Labels)
+	require.Len(t, g.Taints, 1)
+	require.Len(t, g.Nodes, 3)
+	require.Equal(t, "gpu-node-0", g.Nodes[0].Name)
+
+	// builders must not share state with built objects
+	g.Labels[0].Value = "modified"
+	require.Equal(t, "test", b.NodeGroup().Labels[0].Value)
+}
+
+func TestTestCluster(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := NewTestCluster(clusterID).
+		WithPlan("prod", 100).
+		WithZone("de-fra1").
+		WithNodeGroups(NewTestNodeGroup("group1").WithNodes(1), NewTestNodeGroup("group2")).
+		Service()
+	c, err := svc.GetKubernetesCluster(context.TODO(), &request.GetKubernetesClusterRequest{UUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Equal(t, "prod", c.Plan)
+	require.Equal(t, "de-fra1", c.Zone)
+	require.Len(t, c.NodeGroups, 2)
+	require.Len(t, svc.Plans, 2)
+}
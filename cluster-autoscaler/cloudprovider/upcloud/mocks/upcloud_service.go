@@ -19,138 +19,438 @@ package mocks
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
 )
 
 // UpCloudService is mock that implements UpCloudService
 type UpCloudService struct {
 	Clusters map[string]upcloud.KubernetesCluster
 	Plans    []upcloud.KubernetesPlan
-	nodes    map[string][]upcloud.KubernetesNode
-	mu       sync.Mutex
+	// ServerPlans are the server plans listed by GetPlans
+	ServerPlans []sdkext.Plan
+	// CustomPlans maps cluster/node group to custom plan of the node group
+	CustomPlans map[string]*sdkext.KubernetesNodeGroupCustomPlan
+	// Faults configures errors and delays injected into service calls
+	Faults Faults
+	// nodes maps cluster/node group to node group nodes, they are reconciled with node group count
+	nodes map[string][]upcloud.KubernetesNode
+	// nodeSeq maps cluster/node group to the index of the next created node
+	nodeSeq      map[string]int
+	provisioning map[string]provisioning
+	// failed maps cluster/node group to the number of nodes of node group that failed to scale up
+	failed map[string]int
+	mu     sync.Mutex
+}
+
+// provisioning tracks node group nodes that are being provisioned
+type provisioning struct {
+	// from is the index of the first node being provisioned
+	from  int
+	until time.Time
+}
+
+// Faults configures failures that mock service injects into API calls.
+// Zero value disables fault injection.
+type Faults struct {
+	// ErrorRate is the probability (0.0 - 1.0) of a call failing with ErrorStatus
+	ErrorRate float64
+	// ErrorStatus is the HTTP status code of injected errors, defaults to 500
+	ErrorStatus int
+	// Latency is added to every call before it's processed
+	Latency time.Duration
+	// Jitter adds random delay between zero and Jitter on top of Latency
+	Jitter time.Duration
+	// ProvisioningTimes maps server plan name to the time it takes new nodes to become running after
+	// node group is scaled up. Empty plan name applies to plans that are not listed. While nodes are being
+	// provisioned, node group is in scaling-up state and new nodes are in pending state.
+	ProvisioningTimes map[string]time.Duration
+	// RateLimitedCalls is the number of upcoming calls answered with 429 Too Many Requests
+	RateLimitedCalls int
+	// NodeGroupStates maps node group name to the sequence of states returned by
+	// successive GetKubernetesNodeGroup calls. The last state of the sequence sticks,
+	// so e.g. single pending state simulates a node group stuck in pending.
+	NodeGroupStates map[string][]upcloud.KubernetesNodeGroupState
+	// FailedScaleUps lists node groups that fail to create new nodes. Scaled up node group is in failed state
+	// and new nodes are missing from its details until node group is scaled back to its previous size.
+	FailedScaleUps map[string]bool
+}
+
+// inject applies configured faults and returns an error if the call should fail.
+// Like HTTP client, calls with cancelled context fail.
+func (s *UpCloudService) inject(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	latency := s.Faults.Latency
+	if s.Faults.Jitter > 0 {
+		latency += time.Duration(rand.Int63n(int64(s.Faults.Jitter))) //nolint: gosec
+	}
+	s.mu.Unlock()
+	if latency > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(latency):
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Faults.RateLimitedCalls > 0 {
+		s.Faults.RateLimitedCalls--
+		return newProblem(http.StatusTooManyRequests)
+	}
+	if s.Faults.ErrorRate > 0 && rand.Float64() < s.Faults.ErrorRate { //nolint: gosec
+		status := s.Faults.ErrorStatus
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		return newProblem(status)
+	}
+	return nil
+}
+
+// nodeGroupState returns next injected state of the node group, if any. Caller must hold the lock.
+func (s *UpCloudService) nodeGroupState(name string) (upcloud.KubernetesNodeGroupState, bool) {
+	states := s.Faults.NodeGroupStates[name]
+	if len(states) == 0 {
+		return "", false
+	}
+	state := states[0]
+	if len(states) > 1 {
+		s.Faults.NodeGroupStates[name] = states[1:]
+	}
+	return state, true
+}
+
+// provisioningTime returns time it takes to provision nodes using the plan. Caller must hold the lock.
+func (s *UpCloudService) provisioningTime(plan string) time.Duration {
+	if d, ok := s.Faults.ProvisioningTimes[plan]; ok {
+		return d
+	}
+	return s.Faults.ProvisioningTimes[""]
+}
+
+// SetFaults replaces fault configuration, it's safe to call while the service is in use
+func (s *UpCloudService) SetFaults(f Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Faults = f
+}
+
+func newProblem(status int) *upcloud.Problem {
+	return &upcloud.Problem{
+		Type:   fmt.Sprintf("MOCK_ERROR_%d", status),
+		Title:  http.StatusText(status),
+		Status: status,
+	}
 }
 
 // GetKubernetesNodeGroups list node groups
-func (s *UpCloudService) GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) ([]upcloud.KubernetesNodeGroup, error) {
-	cluster, err := s.GetKubernetesCluster(ctx, &request.GetKubernetesClusterRequest{UUID: r.ClusterUUID})
+func (s *UpCloudService) GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) ([]sdkext.KubernetesNodeGroup, error) {
+	if err := s.inject(ctx); err != nil {
+		return nil, err
+	}
+	cluster, err := s.cluster(r.ClusterUUID)
 	if err != nil {
 		return nil, err
 	}
-	return cluster.NodeGroups, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups := make([]sdkext.KubernetesNodeGroup, 0, len(cluster.NodeGroups))
+	for _, g := range cluster.NodeGroups {
+		groups = append(groups, sdkext.KubernetesNodeGroup{KubernetesNodeGroup: g, CustomPlan: s.CustomPlans[r.ClusterUUID+"/"+g.Name]})
+	}
+	return groups, nil
 }
 
 // ModifyKubernetesNodeGroup modifies the node group
 func (s *UpCloudService) ModifyKubernetesNodeGroup(ctx context.Context, r *request.ModifyKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error) {
-	cluster, err := s.GetKubernetesCluster(ctx, &request.GetKubernetesClusterRequest{UUID: r.ClusterUUID})
+	if err := s.inject(ctx); err != nil {
+		return nil, err
+	}
+	var group upcloud.KubernetesNodeGroup
+	err := s.updateNodeGroup(r.ClusterUUID, r.Name, func(g *upcloud.KubernetesNodeGroup) {
+		if d := s.provisioningTime(g.Plan); d > 0 && r.NodeGroup.Count > g.Count {
+			if s.provisioning == nil {
+				s.provisioning = make(map[string]provisioning)
+			}
+			s.provisioning[r.ClusterUUID+"/"+r.Name] = provisioning{from: g.Count, until: time.Now().Add(d)}
+		}
+		key := r.ClusterUUID + "/" + r.Name
+		if from, ok := s.failed[key]; ok && r.NodeGroup.Count <= from {
+			delete(s.failed, key)
+			g.State = upcloud.KubernetesNodeGroupStateRunning
+		} else if !ok && r.NodeGroup.Count > g.Count && s.Faults.FailedScaleUps[r.Name] {
+			if s.failed == nil {
+				s.failed = make(map[string]int)
+			}
+			s.failed[key] = g.Count
+			g.State = upcloud.KubernetesNodeGroupStateFailed
+		}
+		g.Count = r.NodeGroup.Count
+		group = *g
+	})
 	if err != nil {
 		return nil, err
 	}
+	return &group, nil
+}
+
+// CreateKubernetesNodeGroup creates new node group in running state
+func (s *UpCloudService) CreateKubernetesNodeGroup(ctx context.Context, r *request.CreateKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error) {
+	if err := s.inject(ctx); err != nil {
+		return nil, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	cluster, ok := s.Clusters[r.ClusterUUID]
+	if !ok {
+		return nil, &upcloud.Problem{Status: http.StatusNotFound}
+	}
 	for i := range cluster.NodeGroups {
-		if cluster.NodeGroups[i].Name == r.Name {
-			cluster.NodeGroups[i].Count = r.NodeGroup.Count
-			return &cluster.NodeGroups[i], nil
+		if cluster.NodeGroups[i].Name == r.NodeGroup.Name {
+			return nil, &upcloud.Problem{Status: http.StatusConflict, Title: fmt.Sprintf("node group %s already exists", r.NodeGroup.Name)}
 		}
 	}
-	return nil, fmt.Errorf("node group not found %+v", r)
+	group := upcloud.KubernetesNodeGroup{
+		AntiAffinity: r.NodeGroup.AntiAffinity,
+		Count:        r.NodeGroup.Count,
+		KubeletArgs:  r.NodeGroup.KubeletArgs,
+		Labels:       r.NodeGroup.Labels,
+		Name:         r.NodeGroup.Name,
+		Plan:         r.NodeGroup.Plan,
+		SSHKeys:      r.NodeGroup.SSHKeys,
+		State:        upcloud.KubernetesNodeGroupStateRunning,
+		Storage:      r.NodeGroup.Storage,
+		Taints:       r.NodeGroup.Taints,
+	}
+	cluster.NodeGroups = append(append([]upcloud.KubernetesNodeGroup(nil), cluster.NodeGroups...), group)
+	s.Clusters[r.ClusterUUID] = cluster
+	return &group, nil
 }
 
-// DeleteKubernetesNodeGroupNode deletes the node group
-func (s *UpCloudService) DeleteKubernetesNodeGroupNode(ctx context.Context, r *request.DeleteKubernetesNodeGroupNodeRequest) error {
-	_, err := s.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{ClusterUUID: r.ClusterUUID, Name: r.Name})
-	if err != nil {
+// DeleteKubernetesNodeGroup deletes the node group
+func (s *UpCloudService) DeleteKubernetesNodeGroup(ctx context.Context, r *request.DeleteKubernetesNodeGroupRequest) error {
+	if err := s.inject(ctx); err != nil {
 		return err
 	}
-	cluster, err := s.GetKubernetesCluster(ctx, &request.GetKubernetesClusterRequest{UUID: r.ClusterUUID})
-	if err != nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cluster, ok := s.Clusters[r.ClusterUUID]
+	if !ok {
+		return &upcloud.Problem{Status: http.StatusNotFound}
+	}
+	groups := make([]upcloud.KubernetesNodeGroup, 0, len(cluster.NodeGroups))
+	for i := range cluster.NodeGroups {
+		if cluster.NodeGroups[i].Name != r.Name {
+			groups = append(groups, cluster.NodeGroups[i])
+		}
+	}
+	if len(groups) == len(cluster.NodeGroups) {
+		return &upcloud.Problem{Status: http.StatusNotFound, Title: fmt.Sprintf("node group %s not found", r.Name)}
+	}
+	cluster.NodeGroups = groups
+	s.Clusters[r.ClusterUUID] = cluster
+	delete(s.CustomPlans, r.ClusterUUID+"/"+r.Name)
+	return nil
+}
+
+// DeleteKubernetesNodeGroupNode deletes the node group
+func (s *UpCloudService) DeleteKubernetesNodeGroupNode(ctx context.Context, r *request.DeleteKubernetesNodeGroupNodeRequest) error {
+	if err := s.inject(ctx); err != nil {
 		return err
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	nodes, ok := s.nodes[r.ClusterUUID]
-	if !ok {
-		return fmt.Errorf("node %s not found", r.NodeName)
+	g, err := s.storedNodeGroup(r.ClusterUUID, r.Name)
+	if err != nil {
+		return err
 	}
+	key := r.ClusterUUID + "/" + r.Name
+	nodes := s.groupNodes(key, g)
 	n := make([]upcloud.KubernetesNode, 0)
 	for i := range nodes {
 		if nodes[i].Name != r.NodeName {
 			n = append(n, nodes[i])
 		}
 	}
-
-	for i := range cluster.NodeGroups {
-		if cluster.NodeGroups[i].Name == r.Name {
-			cluster.NodeGroups[i].Count--
-			break
-		}
+	if len(n) == len(nodes) {
+		return &upcloud.Problem{Status: http.StatusNotFound, Title: fmt.Sprintf("node %s not found", r.NodeName)}
 	}
-	s.nodes[r.ClusterUUID] = n
+	s.nodes[key] = n
+	g.Count--
 	return nil
 }
 
 // GetKubernetesNodeGroup returns node group details
 func (s *UpCloudService) GetKubernetesNodeGroup(ctx context.Context, r *request.GetKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroupDetails, error) {
-	cluster, err := s.GetKubernetesCluster(ctx, &request.GetKubernetesClusterRequest{UUID: r.ClusterUUID})
-	if err != nil {
+	if err := s.inject(ctx); err != nil {
 		return nil, err
 	}
+	return s.nodeGroup(r.ClusterUUID, r.Name)
+}
+
+func (s *UpCloudService) nodeGroup(clusterUUID, name string) (*upcloud.KubernetesNodeGroupDetails, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.nodes == nil {
-		s.nodes = make(map[string][]upcloud.KubernetesNode)
+	g, err := s.storedNodeGroup(clusterUUID, name)
+	if err != nil {
+		return nil, err
 	}
-	for i := range cluster.NodeGroups {
-		if cluster.NodeGroups[i].Name == r.Name {
-			s.nodes[r.ClusterUUID] = s.initNodeGroupNodes(&cluster.NodeGroups[i])
-			return &upcloud.KubernetesNodeGroupDetails{
-				KubernetesNodeGroup: cluster.NodeGroups[i],
-				Nodes:               s.nodes[r.ClusterUUID],
-			}, nil
+	key := clusterUUID + "/" + name
+	details := &upcloud.KubernetesNodeGroupDetails{
+		KubernetesNodeGroup: *g,
+		Nodes:               append([]upcloud.KubernetesNode(nil), s.groupNodes(key, g)...),
+	}
+	if p, ok := s.provisioning[key]; ok {
+		if time.Now().Before(p.until) {
+			details.State = upcloud.KubernetesNodeGroupStateScalingUp
+			for j := p.from; j < len(details.Nodes); j++ {
+				details.Nodes[j].State = upcloud.KubernetesNodeStatePending
+			}
+		} else {
+			delete(s.provisioning, key)
 		}
 	}
-	return nil, fmt.Errorf("node group details not found %+v", r)
+	if from, ok := s.failed[key]; ok {
+		details.Nodes = details.Nodes[:from]
+	}
+	if state, ok := s.nodeGroupState(name); ok {
+		details.State = state
+	}
+	return details, nil
 }
 
-func (s *UpCloudService) initNodeGroupNodes(nodeGroup *upcloud.KubernetesNodeGroup) []upcloud.KubernetesNode {
-	nodes := make([]upcloud.KubernetesNode, nodeGroup.Count)
-	for i := 0; i < nodeGroup.Count; i++ {
-		nodes[i] = upcloud.KubernetesNode{
-			UUID:  fmt.Sprintf("%s-%d", nodeGroup.Name, i),
-			Name:  fmt.Sprintf("%s-node-%d", nodeGroup.Name, i),
+// groupNodes reconciles stored nodes with node group count. New nodes are added to the end and
+// removed from the end, so that existing nodes keep their names. Caller must hold the lock.
+func (s *UpCloudService) groupNodes(key string, g *upcloud.KubernetesNodeGroup) []upcloud.KubernetesNode {
+	if s.nodes == nil {
+		s.nodes = make(map[string][]upcloud.KubernetesNode)
+		s.nodeSeq = make(map[string]int)
+	}
+	nodes, ok := s.nodes[key]
+	if !ok {
+		nodes = NewTestNodes(g)
+		s.nodeSeq[key] = len(nodes)
+	}
+	for len(nodes) < g.Count {
+		i := s.nodeSeq[key]
+		nodes = append(nodes, upcloud.KubernetesNode{
+			UUID:  fmt.Sprintf("%s-%d", g.Name, i),
+			Name:  fmt.Sprintf("%s-node-%d", g.Name, i),
 			State: upcloud.KubernetesNodeStateRunning,
-		}
+		})
+		s.nodeSeq[key] = i + 1
+	}
+	if len(nodes) > g.Count {
+		nodes = nodes[:g.Count]
 	}
+	s.nodes[key] = nodes
 	return nodes
 }
 
+// storedNodeGroup returns pointer to the stored node group. Caller must hold the lock.
+func (s *UpCloudService) storedNodeGroup(clusterUUID, name string) (*upcloud.KubernetesNodeGroup, error) {
+	c, ok := s.Clusters[clusterUUID]
+	if !ok {
+		return nil, &upcloud.Problem{Status: http.StatusNotFound}
+	}
+	for i := range c.NodeGroups {
+		if c.NodeGroups[i].Name == name {
+			return &c.NodeGroups[i], nil
+		}
+	}
+	return nil, &upcloud.Problem{Status: http.StatusNotFound, Title: fmt.Sprintf("node group %s/%s not found", clusterUUID, name)}
+}
+
+// updateNodeGroup applies fn to the stored node group while holding the lock
+func (s *UpCloudService) updateNodeGroup(clusterUUID, name string, fn func(*upcloud.KubernetesNodeGroup)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, err := s.storedNodeGroup(clusterUUID, name)
+	if err != nil {
+		return err
+	}
+	fn(g)
+	return nil
+}
+
+// GetKubernetesClusters lists clusters sorted by UUID
+func (s *UpCloudService) GetKubernetesClusters(ctx context.Context, _ *request.GetKubernetesClustersRequest) ([]upcloud.KubernetesCluster, error) {
+	if err := s.inject(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clusters := make([]upcloud.KubernetesCluster, 0, len(s.Clusters))
+	for _, c := range s.Clusters {
+		c.NodeGroups = append([]upcloud.KubernetesNodeGroup(nil), c.NodeGroups...)
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].UUID < clusters[j].UUID
+	})
+	return clusters, nil
+}
+
 // GetKubernetesCluster return UKS cluster object
-func (s *UpCloudService) GetKubernetesCluster(_ context.Context, r *request.GetKubernetesClusterRequest) (*upcloud.KubernetesCluster, error) {
-	if c, ok := s.Clusters[r.UUID]; ok {
+func (s *UpCloudService) GetKubernetesCluster(ctx context.Context, r *request.GetKubernetesClusterRequest) (*upcloud.KubernetesCluster, error) {
+	if err := s.inject(ctx); err != nil {
+		return nil, err
+	}
+	return s.cluster(r.UUID)
+}
+
+// cluster returns copy of the stored cluster, so that callers can't race with modifications
+func (s *UpCloudService) cluster(clusterUUID string) (*upcloud.KubernetesCluster, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.Clusters[clusterUUID]; ok {
+		c.NodeGroups = append([]upcloud.KubernetesNodeGroup(nil), c.NodeGroups...)
 		return &c, nil
 	}
 	return nil, &upcloud.Problem{Status: http.StatusNotFound}
 }
 
 // GetKubernetesPlans list UKS plans
-func (s *UpCloudService) GetKubernetesPlans(_ context.Context, _ *request.GetKubernetesPlansRequest) ([]upcloud.KubernetesPlan, error) {
-	return s.Plans, nil
+func (s *UpCloudService) GetKubernetesPlans(ctx context.Context, _ *request.GetKubernetesPlansRequest) ([]upcloud.KubernetesPlan, error) {
+	if err := s.inject(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]upcloud.KubernetesPlan(nil), s.Plans...), nil
 }
 
-// AppendNodeGroup is mock helper function to add new node groups during tests
-func (s *UpCloudService) AppendNodeGroup(ctx context.Context, clusterID uuid.UUID, group upcloud.KubernetesNodeGroup) error {
-	cluster, err := s.GetKubernetesCluster(ctx, &request.GetKubernetesClusterRequest{UUID: clusterID.String()})
-	if err != nil {
-		return err
+// GetPlans list server plans
+func (s *UpCloudService) GetPlans(ctx context.Context, _ *sdkext.GetPlansRequest) ([]sdkext.Plan, error) {
+	if err := s.inject(ctx); err != nil {
+		return nil, err
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	cluster.NodeGroups = append(cluster.NodeGroups, group)
-	s.Clusters[clusterID.String()] = *cluster
+	return append([]sdkext.Plan(nil), s.ServerPlans...), nil
+}
+
+// AppendNodeGroup is mock helper function to add new node groups during tests
+func (s *UpCloudService) AppendNodeGroup(_ context.Context, clusterID uuid.UUID, group upcloud.KubernetesNodeGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cluster, ok := s.Clusters[clusterID.String()]
+	if !ok {
+		return &upcloud.Problem{Status: http.StatusNotFound}
+	}
+	cluster.NodeGroups = append(append([]upcloud.KubernetesNodeGroup(nil), cluster.NodeGroups...), group)
+	s.Clusters[clusterID.String()] = cluster
 	return nil
 }
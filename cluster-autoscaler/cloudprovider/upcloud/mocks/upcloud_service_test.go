@@ -0,0 +1,229 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mocks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+)
+
+func TestUpCloudService_FaultsErrorRate(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newService(clusterID)
+	svc.SetFaults(Faults{ErrorRate: 1, ErrorStatus: http.StatusBadGateway})
+	_, err := svc.GetKubernetesNodeGroups(context.TODO(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	requireProblemStatus(t, err, http.StatusBadGateway)
+
+	svc.SetFaults(Faults{ErrorRate: 1})
+	_, err = svc.GetKubernetesPlans(context.TODO(), &request.GetKubernetesPlansRequest{})
+	requireProblemStatus(t, err, http.StatusInternalServerError)
+
+	svc.SetFaults(Faults{})
+	_, err = svc.GetKubernetesPlans(context.TODO(), &request.GetKubernetesPlansRequest{})
+	require.NoError(t, err)
+}
+
+func TestUpCloudService_FaultsRateLimitedCalls(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newService(clusterID)
+	svc.SetFaults(Faults{RateLimitedCalls: 2})
+	r := &request.GetKubernetesClusterRequest{UUID: clusterID.String()}
+	for i := 0; i < 2; i++ {
+		_, err := svc.GetKubernetesCluster(context.TODO(), r)
+		requireProblemStatus(t, err, http.StatusTooManyRequests)
+	}
+	_, err := svc.GetKubernetesCluster(context.TODO(), r)
+	require.NoError(t, err)
+}
+
+func TestUpCloudService_FaultsLatency(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newService(clusterID)
+	svc.SetFaults(Faults{Latency: time.Minute})
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	_, err := svc.GetKubernetesCluster(ctx, &request.GetKubernetesClusterRequest{UUID: clusterID.String()})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestUpCloudService_FaultsNodeGroupStates(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newService(clusterID)
+	svc.SetFaults(Faults{
+		NodeGroupStates: map[string][]upcloud.KubernetesNodeGroupState{
+			"group1": {upcloud.KubernetesNodeGroupStateScalingUp, upcloud.KubernetesNodeGroupStatePending},
+		},
+	})
+	r := &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group1"}
+	want := []upcloud.KubernetesNodeGroupState{
+		upcloud.KubernetesNodeGroupStateScalingUp,
+		upcloud.KubernetesNodeGroupStatePending,
+		upcloud.KubernetesNodeGroupStatePending,
+	}
+	for _, state := range want {
+		ng, err := svc.GetKubernetesNodeGroup(context.TODO(), r)
+		require.NoError(t, err)
+		require.Equal(t, state, ng.State)
+	}
+}
+
+func TestUpCloudService_FaultsProvisioningTimes(t *testing.T) {
+	t.Parallel()
+
+	const provisioningTime time.Duration = 100 * time.Millisecond
+
+	clusterID := uuid.New()
+	svc := NewTestCluster(clusterID).WithNodeGroups(
+		NewTestNodeGroup("gpu").WithPlan("GPU-8xCPU-64GB-1xL40S").WithNodes(1),
+		NewTestNodeGroup("cpu").WithNodes(1),
+	).Service()
+	svc.SetFaults(Faults{
+		ProvisioningTimes: map[string]time.Duration{"GPU-8xCPU-64GB-1xL40S": provisioningTime},
+	})
+	start := time.Now()
+	for _, name := range []string{"gpu", "cpu"} {
+		_, err := svc.ModifyKubernetesNodeGroup(context.TODO(), &request.ModifyKubernetesNodeGroupRequest{
+			ClusterUUID: clusterID.String(),
+			Name:        name,
+			NodeGroup:   request.ModifyKubernetesNodeGroup{Count: 2},
+		})
+		require.NoError(t, err)
+	}
+
+	// plan without provisioning time is provisioned immediately
+	cpu, err := svc.GetKubernetesNodeGroup(context.TODO(), &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "cpu"})
+	require.NoError(t, err)
+	require.Equal(t, upcloud.KubernetesNodeGroupStateRunning, cpu.State)
+
+	r := &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "gpu"}
+	gpu, err := svc.GetKubernetesNodeGroup(context.TODO(), r)
+	require.NoError(t, err)
+	if time.Since(start) < provisioningTime {
+		require.Equal(t, upcloud.KubernetesNodeGroupStateScalingUp, gpu.State)
+		require.Equal(t, upcloud.KubernetesNodeStateRunning, gpu.Nodes[0].State)
+		require.Equal(t, upcloud.KubernetesNodeStatePending, gpu.Nodes[1].State)
+	}
+
+	time.Sleep(time.Until(start.Add(provisioningTime)))
+	gpu, err = svc.GetKubernetesNodeGroup(context.TODO(), r)
+	require.NoError(t, err)
+	require.Equal(t, upcloud.KubernetesNodeGroupStateRunning, gpu.State)
+	require.Equal(t, upcloud.KubernetesNodeStateRunning, gpu.Nodes[1].State)
+}
+
+func TestUpCloudService_FaultsFailedScaleUps(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := NewTestCluster(clusterID).WithNodeGroups(NewTestNodeGroup("group1").WithNodes(1)).Service()
+	svc.SetFaults(Faults{FailedScaleUps: map[string]bool{"group1": true}})
+	ctx := context.TODO()
+	modify := func(count int) {
+		_, err := svc.ModifyKubernetesNodeGroup(ctx, &request.ModifyKubernetesNodeGroupRequest{
+			ClusterUUID: clusterID.String(),
+			Name:        "group1",
+			NodeGroup:   request.ModifyKubernetesNodeGroup{Count: count},
+		})
+		require.NoError(t, err)
+	}
+	r := &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group1"}
+
+	modify(3)
+	ng, err := svc.GetKubernetesNodeGroup(ctx, r)
+	require.NoError(t, err)
+	require.Equal(t, upcloud.KubernetesNodeGroupStateFailed, ng.State)
+	require.Equal(t, 3, ng.Count)
+	require.Len(t, ng.Nodes, 1)
+
+	modify(1)
+	ng, err = svc.GetKubernetesNodeGroup(ctx, r)
+	require.NoError(t, err)
+	require.Equal(t, upcloud.KubernetesNodeGroupStateRunning, ng.State)
+	require.Len(t, ng.Nodes, 1)
+}
+
+func TestUpCloudService_FaultsJitter(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newService(clusterID)
+	svc.SetFaults(Faults{Latency: 10 * time.Millisecond, Jitter: 10 * time.Millisecond})
+	start := time.Now()
+	_, err := svc.GetKubernetesCluster(context.TODO(), &request.GetKubernetesClusterRequest{UUID: clusterID.String()})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+}
+
+func TestUpCloudService_DeleteKubernetesNodeGroupNode(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newService(clusterID)
+	ctx := context.TODO()
+	_, err := svc.ModifyKubernetesNodeGroup(ctx, &request.ModifyKubernetesNodeGroupRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+		NodeGroup:   request.ModifyKubernetesNodeGroup{Count: 3},
+	})
+	require.NoError(t, err)
+	del := &request.DeleteKubernetesNodeGroupNodeRequest{ClusterUUID: clusterID.String(), Name: "group1", NodeName: "group1-node-1"}
+	require.NoError(t, svc.DeleteKubernetesNodeGroupNode(ctx, del))
+	requireProblemStatus(t, svc.DeleteKubernetesNodeGroupNode(ctx, del), http.StatusNotFound)
+
+	// remaining nodes keep their names and new nodes get new names
+	_, err = svc.ModifyKubernetesNodeGroup(ctx, &request.ModifyKubernetesNodeGroupRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+		NodeGroup:   request.ModifyKubernetesNodeGroup{Count: 3},
+	})
+	require.NoError(t, err)
+	g, err := svc.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group1"})
+	require.NoError(t, err)
+	names := make([]string, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		names = append(names, n.Name)
+	}
+	require.Equal(t, []string{"group1-node-0", "group1-node-2", "group1-node-3"}, names)
+}
+
+func requireProblemStatus(t *testing.T, err error, status int) {
+	t.Helper()
+
+	var p *upcloud.Problem
+	require.True(t, errors.As(err, &p))
+	require.Equal(t, status, p.Status)
+}
+
+func newService(clusterID uuid.UUID) *UpCloudService {
+	return NewTestCluster(clusterID).WithNodeGroups(NewTestNodeGroup("group1").WithNodes(2)).Service()
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sdkext extends the vendored UpCloud SDK with API fields and endpoints that the SDK version pinned in
+// Makefile doesn't have. Vendored SDK under pkg is replaced by `make vendor`, so it must not be edited. Types of this package can be
+// removed once the pinned SDK version has them.
+package sdkext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/client"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/service"
+)
+
+// KubernetesNodeGroup is UKS node group with custom plan
+type KubernetesNodeGroup struct {
+	upcloud.KubernetesNodeGroup
+	CustomPlan *KubernetesNodeGroupCustomPlan `json:"custom_plan,omitempty"`
+}
+
+// KubernetesNodeGroupCustomPlan defines resources of node group that uses custom plan, memory is in MiB and
+// storage in GB
+type KubernetesNodeGroupCustomPlan struct {
+	Cores       int    `json:"cores,omitempty"`
+	Memory      int    `json:"memory,omitempty"`
+	StorageSize int    `json:"storage_size,omitempty"`
+	StorageTier string `json:"storage_tier,omitempty"`
+}
+
+// Plan is UpCloud server plan, memory is in MiB and storage in GB. GPU model has vendor prefix, e.g. NVIDIA L40S.
+type Plan struct {
+	Name         string `json:"name"`
+	CoreNumber   int    `json:"core_number"`
+	MemoryAmount int    `json:"memory_amount"`
+	StorageSize  int    `json:"storage_size"`
+	StorageTier  string `json:"storage_tier"`
+	GPUAmount    int    `json:"gpu_amount,omitempty"`
+	GPUModel     string `json:"gpu_model,omitempty"`
+}
+
+// GetPlansRequest represents a request to list server plans
+type GetPlansRequest struct{}
+
+// RequestURL implements the Request interface
+func (r *GetPlansRequest) RequestURL() string {
+	return "/plan"
+}
+
+// Service is UpCloud SDK service that lists node groups and server plans with the types of this package
+type Service struct {
+	*service.Service
+	client service.Client
+}
+
+// NewService returns service that uses the client
+func NewService(c service.Client) *Service {
+	return &Service{Service: service.New(c), client: c}
+}
+
+// GetKubernetesNodeGroups retrieves a list of Kubernetes cluster node groups.
+func (s *Service) GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) ([]KubernetesNodeGroup, error) {
+	res, err := s.client.Get(ctx, r.RequestURL())
+	if err != nil {
+		return nil, parseServiceError(err)
+	}
+	groups := make([]KubernetesNodeGroup, 0)
+	return groups, json.Unmarshal(res, &groups)
+}
+
+// GetPlans retrieves a list of server plans.
+func (s *Service) GetPlans(ctx context.Context, r *GetPlansRequest) ([]Plan, error) {
+	res, err := s.client.Get(ctx, r.RequestURL())
+	if err != nil {
+		return nil, parseServiceError(err)
+	}
+	plans := struct {
+		Plans struct {
+			Plan []Plan `json:"plan"`
+		} `json:"plans"`
+	}{}
+	if err := json.Unmarshal(res, &plans); err != nil {
+		return nil, err
+	}
+	return plans.Plans.Plan, nil
+}
+
+// parseServiceError returns API errors as problems, same way as the SDK service does
+func parseServiceError(err error) error {
+	var clientError *client.Error
+	if !errors.As(err, &clientError) {
+		return err
+	}
+	if clientError.Type == client.ErrorTypeProblem {
+		prob := &upcloud.Problem{}
+		if err := json.Unmarshal(clientError.ResponseBody, prob); err != nil {
+			return fmt.Errorf("received malformed client error: %s", string(clientError.ResponseBody))
+		}
+		return prob
+	}
+	legacy := struct {
+		Error struct {
+			ErrorCode    string `json:"error_code"`
+			ErrorMessage string `json:"error_message"`
+		} `json:"error"`
+	}{}
+	if err := json.Unmarshal(clientError.ResponseBody, &legacy); err != nil {
+		return fmt.Errorf("received malformed client error: %s", string(clientError.ResponseBody))
+	}
+	return &upcloud.Problem{
+		Type:   legacy.Error.ErrorCode,
+		Title:  legacy.Error.ErrorMessage,
+		Status: clientError.ErrorCode,
+	}
+}
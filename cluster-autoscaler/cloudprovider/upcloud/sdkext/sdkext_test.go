@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sdkext
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/client"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+)
+
+func TestService_GetKubernetesNodeGroups(t *testing.T) {
+	t.Parallel()
+
+	responses := map[string]struct {
+		status      int
+		contentType string
+		body        string
+	}{
+		"ok": {http.StatusOK, "application/json",
+			`[{"name":"default","plan":"2xCPU-4GB","count":2},{"name":"custom","plan":"custom","count":1,"custom_plan":{"cores":2,"memory":6144,"storage_size":50}}]`},
+		"problem": {http.StatusForbidden, "application/problem+json", `{"type":"FORBIDDEN","title":"Forbidden","status":403}`},
+		"legacy":  {http.StatusNotFound, "application/json", `{"error":{"error_code":"CLUSTER_NOT_FOUND","error_message":"Cluster not found"}}`},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /1.3/kubernetes/{cluster}/node-groups", func(w http.ResponseWriter, r *http.Request) {
+		res := responses[r.PathValue("cluster")]
+		w.Header().Set("Content-Type", res.contentType)
+		w.WriteHeader(res.status)
+		_, _ = w.Write([]byte(res.body))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	svc := NewService(client.New("user", "pass", client.WithBaseURL(srv.URL)))
+
+	groups, err := svc.GetKubernetesNodeGroups(context.TODO(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: "ok"})
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, "default", groups[0].Name)
+	require.Equal(t, 2, groups[0].Count)
+	require.Nil(t, groups[0].CustomPlan)
+	require.Equal(t, &KubernetesNodeGroupCustomPlan{Cores: 2, Memory: 6144, StorageSize: 50}, groups[1].CustomPlan)
+
+	var p *upcloud.Problem
+	_, err = svc.GetKubernetesNodeGroups(context.TODO(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: "problem"})
+	require.True(t, errors.As(err, &p), err)
+	require.Equal(t, http.StatusForbidden, p.Status)
+
+	_, err = svc.GetKubernetesNodeGroups(context.TODO(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: "legacy"})
+	require.True(t, errors.As(err, &p), err)
+	require.Equal(t, http.StatusNotFound, p.Status)
+	require.Equal(t, "CLUSTER_NOT_FOUND", p.Type)
+}
+
+func TestService_GetPlans(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /1.3/plan", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"plans":{"plan":[{"name":"2xCPU-4GB","core_number":2,"memory_amount":4096,"storage_size":80,"storage_tier":"maxiops","public_traffic_out":4096},{"name":"GPU-8xCPU-64GB-1xL40S","core_number":8,"memory_amount":65536,"storage_size":300,"storage_tier":"maxiops","gpu_amount":1,"gpu_model":"NVIDIA L40S"}]}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	svc := NewService(client.New("user", "pass", client.WithBaseURL(srv.URL)))
+
+	plans, err := svc.GetPlans(context.TODO(), &GetPlansRequest{})
+	require.NoError(t, err)
+	require.Equal(t, []Plan{
+		{Name: "2xCPU-4GB", CoreNumber: 2, MemoryAmount: 4096, StorageSize: 80, StorageTier: "maxiops"},
+		{Name: "GPU-8xCPU-64GB-1xL40S", CoreNumber: 8, MemoryAmount: 65536, StorageSize: 300, StorageTier: "maxiops", GPUAmount: 1, GPUModel: "NVIDIA L40S"},
+	}, plans)
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"fmt"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+)
+
+// antiAffinityErrorCode is the error code of nodes that anti-affinity node group can't place on separate hosts
+const antiAffinityErrorCode string = "ANTI_AFFINITY_HOSTS_EXHAUSTED"
+
+// antiAffinitySizeLimits returns size limits of anti-affinity node group capped to the number of hosts that can
+// run its nodes, because anti-affinity places every node of the node group on a separate host. Zero maxNodes
+// doesn't cap the limits.
+func antiAffinitySizeLimits(minSize, maxSize, maxNodes int) (int, int) {
+	if maxNodes <= 0 || maxSize <= maxNodes {
+		return minSize, maxSize
+	}
+	return min(minSize, maxNodes), maxNodes
+}
+
+// antiAffinityPlaceholders marks placeholder instances that don't fit on separate hosts as out of resources, so
+// that CA backs off the node group instead of waiting for nodes that can't be provisioned. Zero maxNodes doesn't
+// mark placeholders.
+func antiAffinityPlaceholders(name string, nodes []cloudprovider.Instance, maxNodes int) []cloudprovider.Instance {
+	if maxNodes <= 0 || len(nodes) <= maxNodes {
+		return nodes
+	}
+	errorInfo := &cloudprovider.InstanceErrorInfo{
+		ErrorClass:   cloudprovider.OutOfResourcesErrorClass,
+		ErrorCode:    antiAffinityErrorCode,
+		ErrorMessage: fmt.Sprintf("anti-affinity node group can't place more than %d nodes on separate hosts", maxNodes),
+	}
+	for i := maxNodes; i < len(nodes); i++ {
+		if isPlaceholder(name, nodes[i].Id) {
+			nodes[i].Status = &cloudprovider.InstanceStatus{State: cloudprovider.InstanceCreating, ErrorInfo: errorInfo}
+		}
+	}
+	return nodes
+}
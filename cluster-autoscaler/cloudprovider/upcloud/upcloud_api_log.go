@@ -0,0 +1,151 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// apiLogBodyLimit is the maximum number of logged bytes of request and response bodies
+	apiLogBodyLimit int = 2048
+	// apiLogRedacted replaces redacted header and body values
+	apiLogRedacted string = "REDACTED"
+)
+
+// apiLogRedactedHeaders are the headers whose values are never logged
+var apiLogRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// apiLogRedactedFields are substrings of JSON field names whose values are never logged
+var apiLogRedactedFields = []string{"password", "secret", "token", "authorization"}
+
+// apiLogTransport logs every UpCloud API request and response, with credentials redacted
+type apiLogTransport struct {
+	transport http.RoundTripper
+}
+
+func newAPILogTransport(transport http.RoundTripper) *apiLogTransport {
+	return &apiLogTransport{transport: transport}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *apiLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readAPILogBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	path := req.URL.RequestURI()
+	klog.InfoS("UpCloud API request", "method", req.Method, "path", path, "headers", redactHeaders(req.Header), "body", redactBody(body))
+
+	start := time.Now()
+	res, err := t.transport.RoundTrip(req)
+	if err != nil {
+		klog.ErrorS(err, "UpCloud API request failed", "method", req.Method, "path", path, logKeyDuration, time.Since(start))
+		return nil, err
+	}
+	resBody, err := readAPILogBody(&res.Body)
+	if err != nil {
+		return nil, err
+	}
+	klog.InfoS("UpCloud API response", "method", req.Method, "path", path, "status", res.StatusCode,
+		logKeyDuration, time.Since(start), "body", redactBody(resBody))
+	return res, nil
+}
+
+// readAPILogBody reads the body and replaces it with a copy, so that it can be read again by the caller
+func readAPILogBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	b, err := io.ReadAll(*body)
+	_ = (*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// redactHeaders returns headers as a map of single values, credentials redacted
+func redactHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for k := range h {
+		headers[k] = h.Get(k)
+	}
+	for _, k := range apiLogRedactedHeaders {
+		if _, ok := headers[k]; ok {
+			headers[k] = apiLogRedacted
+		}
+	}
+	return headers
+}
+
+// redactBody returns body with values of credential fields redacted and truncated to apiLogBodyLimit bytes.
+// Bodies that aren't JSON aren't logged, because their credentials can't be redacted.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("<%d bytes of non-JSON body>", len(body))
+	}
+	b, err := json.Marshal(redactJSON(v))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes of body>", len(body))
+	}
+	if len(b) > apiLogBodyLimit {
+		return fmt.Sprintf("%s... (%d bytes truncated)", b[:apiLogBodyLimit], len(b)-apiLogBodyLimit)
+	}
+	return string(b)
+}
+
+func redactJSON(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if isRedactedField(k) {
+				t[k] = apiLogRedacted
+				continue
+			}
+			t[k] = redactJSON(val)
+		}
+	case []any:
+		for i := range t {
+			t[i] = redactJSON(t[i])
+		}
+	}
+	return v
+}
+
+func isRedactedField(name string) bool {
+	name = strings.ToLower(name)
+	for _, f := range apiLogRedactedFields {
+		if strings.Contains(name, f) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPILogTransport(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: newAPILogTransport(http.DefaultTransport)}
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/1.3/kubernetes", strings.NewReader(`{"name":"group1"}`))
+	require.NoError(t, err)
+	req.SetBasicAuth("uks-username", "uks-passwd")
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	// logged bodies are still read by the client
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, `{"name":"group1"}`, string(b))
+}
+
+func TestRedactHeaders(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest(http.MethodGet, "https://api.upcloud.com/1.3/kubernetes", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("uks-username", "uks-passwd")
+	req.Header.Set("Accept", "application/json")
+	require.Equal(t, map[string]string{
+		"Authorization": apiLogRedacted,
+		"Accept":        "application/json",
+	}, redactHeaders(req.Header))
+}
+
+func TestRedactBody(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, redactBody(nil))
+	require.Equal(t,
+		`{"labels":[{"key":"env","value":"prod"}],"login":{"password":"REDACTED","user":"uks"},"name":"group1","storage_encryption":"data-at-rest"}`,
+		redactBody([]byte(`{"name":"group1","login":{"user":"uks","password":"secret"},"labels":[{"key":"env","value":"prod"}],"storage_encryption":"data-at-rest"}`)),
+	)
+	require.Equal(t, `[{"ClientSecret":"REDACTED","api_token":"REDACTED"}]`, redactBody([]byte(`[{"api_token":"t","ClientSecret":"s"}]`)))
+	require.Equal(t, "<15 bytes of non-JSON body>", redactBody([]byte("password=secret")))
+
+	long := redactBody([]byte(`"` + strings.Repeat("a", apiLogBodyLimit) + `"`))
+	require.True(t, strings.HasPrefix(long, `"`+strings.Repeat("a", apiLogBodyLimit-1)+"... (2 bytes truncated)"), long)
+}
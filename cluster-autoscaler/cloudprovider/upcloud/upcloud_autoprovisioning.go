@@ -0,0 +1,159 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// labelAutoprovisioned marks node groups created by the autoscaler
+	labelAutoprovisioned string = labelPrefix + "autoprovisioned"
+
+	autoprovisionedNamePrefix string = "ca-"
+	// autoprovisionedInitialSize is the size of created node group, because UKS node group can't be created without nodes
+	autoprovisionedInitialSize int = 1
+)
+
+// autoprovisioningPlans are the server plans used when creating node groups
+var autoprovisioningPlans = []string{
+	"1xCPU-2GB",
+	"2xCPU-4GB",
+	"4xCPU-8GB",
+	"6xCPU-16GB",
+	"8xCPU-32GB",
+	"12xCPU-48GB",
+	"16xCPU-64GB",
+	"20xCPU-96GB",
+	"20xCPU-128GB",
+}
+
+var nodeGroupNameInvalidChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// newAutoprovisionedNodeGroup returns node group that doesn't exist until it's created
+func (m *manager) newAutoprovisionedNodeGroup(plan string, labels map[string]string, taints []apiv1.Taint) (*upCloudNodeGroup, error) {
+	if _, err := m.plans.byName(plan); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s%s-%08x", autoprovisionedNamePrefix, nodeGroupNameInvalidChars.ReplaceAllString(strings.ToLower(plan), "-"), rand.Uint32()) //nolint: gosec
+	_, maxSize := m.sizeDefaults.limits(m.maxNodesTotal)
+	groupLabels := map[string]string{labelAutoprovisioned: "true"}
+	for k, v := range labels {
+		// Kubernetes reserved labels are managed by the nodes
+		if strings.Contains(k, "kubernetes.io/") || strings.Contains(k, "k8s.io/") {
+			continue
+		}
+		groupLabels[k] = v
+	}
+	return &upCloudNodeGroup{
+		clusterID:       m.clusterID,
+		name:            name,
+		minSize:         0,
+		maxSize:         maxSize,
+		labels:          groupLabels,
+		plan:            plan,
+		zone:            m.zone,
+		taints:          taints,
+		autoprovisioned: true,
+		theoretical:     true,
+		svc:             m.service(),
+		hooks:           m.hooks,
+		details:         m.details,
+		schedule:        m.schedule,
+		lifecycle:       m.lifecycle,
+		opLocks:         m.opLocks,
+		pending:         m.pending,
+		failures:        m.failures,
+		plans:           m.plans,
+		watch:           m.watch,
+		templates:       m.templates,
+		systemPods:      m.systemPods,
+		nodes:           make([]cloudprovider.Instance, 0),
+	}, nil
+}
+
+// create creates the node group in UpCloud and waits until it's running
+func (u *upCloudNodeGroup) create() error {
+	ctx, cancel := u.lifecycle.withTimeout(timeoutModifyNodeGroup)
+	defer cancel()
+	labels := make([]upcloud.Label, 0, len(u.labels))
+	for k, v := range u.labels {
+		labels = append(labels, upcloud.Label{Key: k, Value: v})
+	}
+	taints := make([]upcloud.KubernetesTaint, 0, len(u.taints))
+	for _, t := range u.taints {
+		taints = append(taints, upcloud.KubernetesTaint{
+			Key:    t.Key,
+			Value:  t.Value,
+			Effect: upcloud.KubernetesClusterTaintEffect(t.Effect),
+		})
+	}
+	klog.V(logInfo).InfoS("creating node group", u.logValues("plan", u.plan)...)
+	_, err := u.svc.CreateKubernetesNodeGroup(ctx, &request.CreateKubernetesNodeGroupRequest{
+		ClusterUUID: u.clusterID.String(),
+		NodeGroup: request.KubernetesNodeGroup{
+			Count:  autoprovisionedInitialSize,
+			Labels: labels,
+			Name:   u.name,
+			Plan:   u.plan,
+			Taints: taints,
+		},
+	})
+	if err != nil {
+		return toAutoscalerError(err, "failed to create node group %s", u.name)
+	}
+	u.schedule.reset()
+	nodeGroup, err := u.waitNodeGroupState(u.lifecycle.context(), upcloud.KubernetesNodeGroupStateRunning, timeoutWaitNodeGroupState)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	u.theoretical = false
+	u.size = nodeGroup.Count
+	u.initialNodes = nodeGroup.Count
+	u.mu.Unlock()
+	return nil
+}
+
+// delete deletes the node group from UpCloud
+func (u *upCloudNodeGroup) delete() error {
+	ctx, cancel := u.lifecycle.withTimeout(timeoutModifyNodeGroup)
+	defer cancel()
+	klog.V(logInfo).InfoS("deleting node group", u.logValues()...)
+	if err := u.svc.DeleteKubernetesNodeGroup(ctx, &request.DeleteKubernetesNodeGroupRequest{
+		ClusterUUID: u.clusterID.String(),
+		Name:        u.name,
+	}); err != nil {
+		return toAutoscalerError(err, "failed to delete node group %s", u.name)
+	}
+	u.details.invalidate(u.name)
+	u.schedule.reset()
+	return nil
+}
+
+func isAutoprovisioned(labels map[string]string) bool {
+	return labels[labelAutoprovisioned] == "true"
+}
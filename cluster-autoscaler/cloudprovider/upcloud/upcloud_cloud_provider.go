@@ -19,17 +19,26 @@ package upcloud
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	oteltrace "go.opentelemetry.io/otel/trace"
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/cassette"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/client"
-	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/service"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/gpu"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
 	"k8s.io/klog/v2"
 )
 
@@ -40,23 +49,105 @@ const (
 	timeoutNodeGroupStateChange time.Duration = time.Minute * 20
 	timeoutDeleteNode           time.Duration = time.Second * 20
 	timeoutWaitNodeGroupState   time.Duration = time.Minute * 20
+	timeoutScaleHook            time.Duration = time.Minute
 
+	// nodeGroupStateBackoffInitial is the delay before the second node group state check, which grows up to
+	// nodeGroupStateBackoffMax
+	nodeGroupStateBackoffInitial time.Duration = 500 * time.Millisecond
+	nodeGroupStateBackoffMax     time.Duration = 20 * time.Second
+
+	// deleteNodesParallelism is the maximum number of concurrent node delete requests of DeleteNodes
+	deleteNodesParallelism int = 5
+
+	// instanceCacheTTL is the maximum age of cached instances used by HasInstance
+	instanceCacheTTL time.Duration = time.Minute
+	// instanceCacheMinAge is the minimum age of cache before unknown instance triggers cache update
+	instanceCacheMinAge time.Duration = time.Second * 10
+
+	// nodeGroupMinSize is the min size of node groups that don't set their limits, unless
+	// UPCLOUD_NODEGROUP_DEFAULT_MIN overrides it
 	nodeGroupMinSize int = 1
-	nodeGroupMaxSize int = 20
 
 	logInfo  klog.Level = 4
 	logDebug klog.Level = 5
 
-	envUpCloudUsername  string = "UPCLOUD_USERNAME"
-	envUpCloudPassword  string = "UPCLOUD_PASSWORD"
-	envUpCloudClusterID string = "UPCLOUD_CLUSTER_ID"
+	envUpCloudUsername             string = "UPCLOUD_USERNAME"
+	envUpCloudPassword             string = "UPCLOUD_PASSWORD"
+	envUpCloudUsernameFile         string = "UPCLOUD_USERNAME_FILE"
+	envUpCloudPasswordFile         string = "UPCLOUD_PASSWORD_FILE"
+	envUpCloudClusterID            string = "UPCLOUD_CLUSTER_ID"
+	envUpCloudRecordFile           string = "UPCLOUD_RECORD_FILE"
+	envUpCloudAPIDebugLog          string = "UPCLOUD_API_DEBUG_LOG"
+	envUpCloudAPIURL               string = "UPCLOUD_API_URL"
+	envUpCloudNodeGroupCacheTTL    string = "UPCLOUD_NODE_GROUP_CACHE_TTL"
+	envUpCloudRefreshInterval      string = "UPCLOUD_REFRESH_INTERVAL"
+	envUpCloudAPIRateLimit         string = "UPCLOUD_API_RATE_LIMIT"
+	envUpCloudAPIRetries           string = "UPCLOUD_API_RETRIES"
+	envUpCloudDryRun               string = "UPCLOUD_DRY_RUN"
+	envUpCloudTemplateConfigMap    string = "UPCLOUD_TEMPLATE_CONFIG_MAP"
+	envUpCloudAntiAffinityMaxNodes string = "UPCLOUD_ANTI_AFFINITY_MAX_NODES"
+	envUpCloudNodeGroupDefaultMin  string = "UPCLOUD_NODEGROUP_DEFAULT_MIN"
+	envUpCloudNodeGroupDefaultMax  string = "UPCLOUD_NODEGROUP_DEFAULT_MAX"
+	envUpCloudTemplateSystemPods   string = "UPCLOUD_TEMPLATE_SYSTEM_PODS"
+	envUpCloudTracingEndpoint      string = "UPCLOUD_TRACING_ENDPOINT"
+	envUpCloudTracingSamplingRate  string = "UPCLOUD_TRACING_SAMPLING_RATE_PER_MILLION"
+
+	// defaultNodeGroupCacheTTL is the default maximum age of cached node group details
+	defaultNodeGroupCacheTTL time.Duration = time.Minute
+	// defaultAPIRateLimit is the default maximum number of UpCloud API requests per second
+	defaultAPIRateLimit float64 = 10
+	// defaultAPIRetries is the default number of times transient API errors are retried
+	defaultAPIRetries int = 3
+	// defaultTracingSamplingRate samples every UpCloud API request when tracing is enabled
+	defaultTracingSamplingRate int32 = 1000000
+	// timeoutTracingShutdown is the maximum time of exporting remaining spans on cleanup
+	timeoutTracingShutdown time.Duration = time.Second * 5
+	// retryBackoffInitial and retryBackoffMax are the bounds of exponential backoff between API request retries
+	retryBackoffInitial time.Duration = time.Millisecond * 500
+	retryBackoffMax     time.Duration = time.Second * 8
+
+	// recordTraceLimit is the maximum number of API interactions kept in memory in recording mode
+	recordTraceLimit int = 1000
 )
 
 type upCloudConfig struct {
 	ClusterID string
 	Username  string
 	Password  string
-	UserAgent string
+	// UsernameFile and PasswordFile are re-read on refresh when set
+	UsernameFile string
+	PasswordFile string
+	UserAgent    string
+	// APIURL overrides default API endpoint, e.g. to use staging endpoint or local fake API
+	APIURL string
+	// RecordFile enables recording of API interactions, which are written to the file when process receives SIGUSR1
+	RecordFile string
+	// APIDebugLog logs every API request and response with credentials redacted
+	APIDebugLog bool
+	// NodeGroupCacheTTL is the maximum age of cached node group details, zero disables caching
+	NodeGroupCacheTTL time.Duration
+	// APIRateLimit is the maximum number of API requests per second, zero disables rate limiting
+	APIRateLimit float64
+	// APIRetries is the number of times transient API errors are retried
+	APIRetries int
+	// RefreshInterval is the minimum interval of listing node groups, zero lists node groups on every refresh
+	RefreshInterval time.Duration
+	// DryRun skips API requests that would change the cluster and simulates their results
+	DryRun bool
+	// TemplateConfigMap is the ConfigMap of node group template overrides in format [<namespace>/]<name>
+	TemplateConfigMap string
+	// TemplateSystemPods adds UKS system pods to node group templates, DaemonSet pods are counted twice when the
+	// autoscaler lists the DaemonSets of these pods
+	TemplateSystemPods bool
+	// AntiAffinityMaxNodes is the number of zone hosts that can run nodes of anti-affinity node group, zero doesn't cap
+	// size of anti-affinity node groups
+	AntiAffinityMaxNodes int
+	// NodeGroupSizeDefaults overrides size limits of node groups that --nodes specs and node group labels don't set
+	NodeGroupSizeDefaults *nodeGroupSizeDefaults
+	// TracingEndpoint is the OTLP gRPC endpoint that spans of API requests are exported to, empty disables tracing
+	TracingEndpoint string
+	// TracingSamplingRatePerMillion is the number of sampled API requests per million
+	TracingSamplingRatePerMillion int32
 }
 
 // upCloudCloudProvider implements cloudprovide.CloudProvider interfaces
@@ -67,15 +158,16 @@ type upCloudCloudProvider struct {
 
 // Name returns name of the cloud provider.
 func (u *upCloudCloudProvider) Name() string {
-	klog.V(logDebug).Info("UpCloud CloudProvider.Name called")
+	u.logOperation("Name")
 	return cloudprovider.UpCloudProviderName
 }
 
 // NodeGroups returns all node groups configured for this cloud provider.
 func (u *upCloudCloudProvider) NodeGroups() []cloudprovider.NodeGroup {
-	klog.V(logDebug).Info("UpCloud CloudProvider.NodeGroups called")
-	nodeGroups := make([]cloudprovider.NodeGroup, len(u.manager.nodeGroups))
-	for i, ng := range u.manager.nodeGroups {
+	u.logOperation("NodeGroups")
+	groups := u.manager.getNodeGroups()
+	nodeGroups := make([]cloudprovider.NodeGroup, len(groups))
+	for i, ng := range groups {
 		nodeGroups[i] = ng
 	}
 	return nodeGroups
@@ -85,9 +177,9 @@ func (u *upCloudCloudProvider) NodeGroups() []cloudprovider.NodeGroup {
 // should not be processed by cluster autoscaler, or non-nil error if such
 // occurred. Must be implemented.
 func (u *upCloudCloudProvider) NodeGroupForNode(node *apiv1.Node) (cloudprovider.NodeGroup, error) {
-	klog.V(logDebug).Info("UpCloud CloudProvider.NodeGroupForNode called")
+	u.logOperation("NodeGroupForNode")
 	providerID := node.Spec.ProviderID
-	for _, group := range u.manager.nodeGroups {
+	for _, group := range u.manager.getNodeGroups() {
 		nodes, err := group.Nodes()
 		if err != nil {
 			return nil, err
@@ -98,74 +190,122 @@ func (u *upCloudCloudProvider) NodeGroupForNode(node *apiv1.Node) (cloudprovider
 			}
 		}
 	}
-	klog.V(logInfo).Infof("couldn't find node group for node with provider ID %s", providerID)
+	klog.V(logInfo).InfoS("couldn't find node group for node", logKeyClusterID, u.manager.clusterID.String(), "providerID", providerID)
 	return nil, nil
 }
 
 // HasInstance returns whether the node has corresponding instance in cloud provider,
 // true if the node has an instance, false if it no longer exists
-func (u *upCloudCloudProvider) HasInstance(*apiv1.Node) (bool, error) {
-	klog.V(logDebug).Info("UpCloud CloudProvider.HasInstance called")
-	return true, cloudprovider.ErrNotImplemented
+func (u *upCloudCloudProvider) HasInstance(node *apiv1.Node) (bool, error) {
+	u.logOperation("HasInstance")
+	nodeUUID, ok := strings.CutPrefix(node.Spec.ProviderID, providerIDPrefix)
+	if !ok || nodeUUID == "" {
+		// fall back to taint based logic with nodes not managed by UpCloud
+		return true, fmt.Errorf("node %s provider ID '%s' is not UpCloud node: %w", node.GetName(), node.Spec.ProviderID, cloudprovider.ErrNotImplemented)
+	}
+	return u.manager.hasInstance(nodeUUID)
+}
+
+// Debug returns JSON document of the cluster, provider health and node groups, which helps to diagnose why node
+// groups are not scaled. It can be used by custom builds and tools, cloud provider interface doesn't include it.
+func (u *upCloudCloudProvider) Debug() string {
+	u.logOperation("Debug")
+	if u.manager == nil {
+		return debugJSON(nil)
+	}
+	return debugJSON(u.manager.debug())
 }
 
 // GetResourceLimiter returns struct containing limits (max, min) for resources (cores, memory etc.).
 func (u *upCloudCloudProvider) GetResourceLimiter() (*cloudprovider.ResourceLimiter, error) {
-	klog.V(logDebug).Info("UpCloud CloudProvider.GetResourceLimiter called")
+	u.logOperation("GetResourceLimiter")
 	return u.resourceLimiter, nil
 }
 
 // GetAvailableGPUTypes return all available GPU types cloud provider supports.
+// GPU types are detected from the server plans of the cluster node groups.
 func (u *upCloudCloudProvider) GetAvailableGPUTypes() map[string]struct{} {
-	klog.V(logDebug).Info("UpCloud CloudProvider.GetAvailableGPUTypes called")
-	return nil
+	u.logOperation("GetAvailableGPUTypes")
+	types := make(map[string]struct{})
+	for _, g := range u.manager.getNodeGroups() {
+		if plan, err := g.serverPlan(); err == nil && plan.gpus > 0 {
+			types[plan.gpuLabelValue()] = struct{}{}
+		}
+	}
+	return types
 }
 
 // GPULabel returns the label added to nodes with GPU resource.
 func (u *upCloudCloudProvider) GPULabel() string {
-	klog.V(logDebug).Info("UpCloud CloudProvider.GPULabel called")
-	return ""
+	u.logOperation("GPULabel")
+	return gpuLabel
 }
 
 // GetNodeGpuConfig returns the label, type and resource name for the GPU added to node. If node doesn't have
 // any GPUs, it returns nil.
 func (u *upCloudCloudProvider) GetNodeGpuConfig(node *apiv1.Node) *cloudprovider.GpuConfig {
-	klog.V(logDebug).Info("UpCloud CloudProvider.GetNodeGpuConfig called")
+	u.logOperation("GetNodeGpuConfig")
 	return gpu.GetNodeGPUFromCloudProvider(u, node)
 }
 
 // Refresh is called before every main loop and can be used to dynamically update cloud provider state.
 // In particular the list of node groups returned by NodeGroups can change as a result of CloudProvider.Refresh().
-func (u *upCloudCloudProvider) Refresh() error {
-	klog.V(logDebug).Info("UpCloud CloudProvider.Refresh called")
-	return u.manager.refresh()
+func (u *upCloudCloudProvider) Refresh() (err error) {
+	defer u.logOperation("Refresh").done(&err)
+	err = u.manager.refresh()
+	u.manager.health.refreshDone(err)
+	if err == nil {
+		u.manager.metrics.update(u.manager.getNodeGroups())
+	}
+	return err
+}
+
+// Healthz returns error that describes why the cloud provider is degraded, nil if it's healthy. The provider is
+// degraded when UpCloud API rejects the credentials or node groups haven't been refreshed recently.
+func (u *upCloudCloudProvider) Healthz() error {
+	if u.manager == nil {
+		return nil
+	}
+	return u.manager.health.check()
 }
 
 // Pricing returns pricing model for this cloud provider or error if not available.
 // Implementation optional.
 func (u *upCloudCloudProvider) Pricing() (cloudprovider.PricingModel, errors.AutoscalerError) {
-	klog.V(logDebug).Info("UpCloud CloudProvider.Pricing called")
+	u.logOperation("Pricing")
 	return nil, cloudprovider.ErrNotImplemented
 }
 
 // GetAvailableMachineTypes get all machine types that can be requested from the cloud provider.
 // Implementation optional.
 func (u *upCloudCloudProvider) GetAvailableMachineTypes() ([]string, error) {
-	klog.V(logDebug).Info("UpCloud CloudProvider.GetAvailableMachineTypes called")
-	return nil, cloudprovider.ErrNotImplemented
+	u.logOperation("GetAvailableMachineTypes")
+	return append([]string(nil), autoprovisioningPlans...), nil
 }
 
 // NewNodeGroup builds a theoretical node group based on the node definition provided. The node group is not automatically
 // created on the cloud provider side. The node group is not returned by NodeGroups() until it is created.
 // Implementation optional.
-func (u *upCloudCloudProvider) NewNodeGroup(_ string, _ map[string]string, _ map[string]string, _ []apiv1.Taint, _ map[string]resource.Quantity) (cloudprovider.NodeGroup, error) {
-	klog.V(logDebug).Info("UpCloud CloudProvider.NewNodeGroup called")
-	return nil, cloudprovider.ErrNotImplemented
+// Machine type is the name of UpCloud server plan.
+func (u *upCloudCloudProvider) NewNodeGroup(machineType string, labels map[string]string, _ map[string]string, taints []apiv1.Taint, _ map[string]resource.Quantity) (cloudprovider.NodeGroup, error) {
+	u.logOperation("NewNodeGroup")
+	return u.manager.newAutoprovisionedNodeGroup(machineType, labels, taints)
 }
 
 // Cleanup cleans up open resources before the cloud provider is destroyed, i.e. go routines etc.
+// In-flight API requests and node group state polling are cancelled.
 func (u *upCloudCloudProvider) Cleanup() error {
-	klog.V(logDebug).Info("UpCloud CloudProvider.Cleanup called")
+	defer u.logOperation("Cleanup").done(nil)
+	if u.manager != nil {
+		u.manager.lifecycle.stop()
+		if u.manager.tracerProvider != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutTracingShutdown)
+			defer cancel()
+			if err := u.manager.tracerProvider.Shutdown(ctx); err != nil {
+				klog.ErrorS(err, "failed to export remaining UpCloud API spans")
+			}
+		}
+	}
 	return nil
 }
 
@@ -178,21 +318,48 @@ func BuildUpCloud(opts config.AutoscalingOptions, do cloudprovider.NodeGroupDisc
 	if err != nil {
 		klog.Fatalf("failed to initialize UpCloud config: %v", err)
 	}
-	svc, err := newUpCloudService(cfg)
+	RegisterMetrics()
+	// spans are exported in background, so the provider outlives the init context
+	tracerProvider, err := newTracerProvider(context.Background(), cfg)
+	if err != nil {
+		klog.Fatalf("failed to initialize UpCloud API tracing: %v", err)
+	}
+	newService := newServiceBuilder(cfg, tracerProvider)
+	svc, err := newService(cfg)
 	if err != nil {
 		klog.Fatalf("failed to initialize UpCloud service: %v", err)
 	}
+	if cfg.ClusterID == "" {
+		klog.Infof("environment variable %s not set, detecting cluster ID using Kubernetes nodes", envUpCloudClusterID)
+		nodeUUIDs, err := kubeNodeUUIDs(ctx, kube_util.CreateKubeClient(opts.KubeClientOpts))
+		if err != nil {
+			klog.Fatalf("failed to detect cluster ID, set %s environment variable: %v", envUpCloudClusterID, err)
+		}
+		if cfg.ClusterID, err = detectClusterID(ctx, svc, nodeUUIDs); err != nil {
+			klog.Fatalf("failed to detect cluster ID, set %s environment variable: %v", envUpCloudClusterID, err)
+		}
+	}
+	if err := preflight(ctx, svc, cfg); err != nil {
+		klog.Fatalf("UpCloud preflight check failed: %v", err)
+	}
 	manager, err := newManager(ctx, svc, cfg, opts, do)
 	if err != nil {
 		klog.Fatalf("failed to initialize manager: %v", err)
 	}
-
-	klog.V(logInfo).Infof("%s cloud provider initialized successfully", opts.CloudProviderName)
-	if len(manager.nodeGroupSpecs) > 0 {
-		for _, v := range manager.nodeGroupSpecs {
-			klog.Infof("using custom %s node group spec: %s min=%d max=%d", opts.CloudProviderName, v.Name, v.MinSize, v.MaxSize)
+	manager.credentials = newCredentialFiles(cfg, newService)
+	go manager.reloadPlans()
+	manager.tracerProvider = tracerProvider
+	if cfg.TemplateConfigMap != "" {
+		manager.templates = newTemplateOverrides(kube_util.CreateKubeClient(opts.KubeClientOpts), cfg.TemplateConfigMap)
+		if err := manager.templates.load(ctx); err != nil {
+			klog.Fatalf("failed to load template overrides: %v", err)
 		}
 	}
+
+	klog.V(logInfo).InfoS("cloud provider initialized successfully", "cloudProvider", opts.CloudProviderName, logKeyClusterID, manager.clusterID.String())
+	for _, v := range manager.nodeGroupSpecs {
+		klog.InfoS("using custom node group spec", logKeyClusterID, manager.clusterID.String(), logKeyNodeGroup, v.Name, "minSize", v.MinSize, "maxSize", v.MaxSize)
+	}
 	return &upCloudCloudProvider{
 		manager:         manager,
 		resourceLimiter: rl,
@@ -205,31 +372,177 @@ func buildCloudConfig(opts config.AutoscalingOptions) (upCloudConfig, error) {
 }
 
 func newUpCloudService(cfg upCloudConfig) (upCloudService, error) {
-	if cfg.Username == "" || cfg.Password == "" {
-		return nil, errors.NewAutoscalerError(errors.ConfigurationError, "UpCloud API credentials not configured")
+	return newServiceBuilder(cfg, nil)(cfg)
+}
+
+// newServiceBuilder returns builder that is used to (re)build service when credentials change.
+// HTTP client is shared between services, so that e.g. API recording survives credential rotation.
+// Requests are traced when tracer provider is not nil.
+func newServiceBuilder(cfg upCloudConfig, tp oteltrace.TracerProvider) serviceBuilder {
+	opts := make([]client.ConfigFn, 0)
+	if cfg.APIURL != "" {
+		opts = append(opts, client.WithBaseURL(cfg.APIURL))
 	}
-	upClient := client.New(cfg.Username, cfg.Password)
-	if cfg.UserAgent != "" {
-		upClient.UserAgent = cfg.UserAgent
+	var transport http.RoundTripper
+	if cfg.RecordFile != "" {
+		rec := cassette.NewTrace(cfg.RecordFile, recordTraceLimit, client.NewDefaultHTTPTransport())
+		writeTraceOnSignal(rec, cfg.RecordFile)
+		transport = rec
+	}
+	if cfg.APIDebugLog {
+		klog.Infof("UpCloud API debug logging enabled, requests and responses are logged with credentials redacted")
+		if transport == nil {
+			transport = client.NewDefaultHTTPTransport()
+		}
+		transport = newAPILogTransport(transport)
+	}
+	if transport != nil {
+		opts = append(opts, client.WithHTTPClient(&http.Client{Transport: transport}))
+	}
+	limiter := newAPIRateLimiter(cfg.APIRateLimit)
+	var dryRun *dryRunState
+	if cfg.DryRun {
+		klog.Infof("dry-run mode enabled, UpCloud API requests that would change the cluster are skipped")
+		dryRun = newDryRunState()
+	}
+	return func(cfg upCloudConfig) (upCloudService, error) {
+		if cfg.Username == "" || cfg.Password == "" {
+			return nil, errors.NewAutoscalerError(errors.ConfigurationError, "UpCloud API credentials not configured")
+		}
+		upClient := client.New(cfg.Username, cfg.Password, opts...)
+		if cfg.UserAgent != "" {
+			upClient.UserAgent = cfg.UserAgent
+		}
+		var svc upCloudService = newRetryService(sdkext.NewService(upClient), limiter, cfg.APIRetries)
+		if dryRun != nil {
+			svc = newDryRunService(svc, dryRun)
+		}
+		return newTracingService(svc, tp), nil
 	}
-	return service.New(upClient), nil
+}
+
+// writeTraceOnSignal writes recorded API interactions to the file every time process receives SIGUSR1.
+func writeTraceOnSignal(rec *cassette.Recorder, path string) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	klog.Infof("recording UpCloud API interactions, send SIGUSR1 to write them to %s", path)
+	go func() {
+		for range sigs {
+			if err := rec.Stop(); err != nil {
+				klog.ErrorS(err, "failed to write UpCloud API interactions", "file", path)
+				continue
+			}
+			klog.Infof("UpCloud API interactions written to %s", path)
+		}
+	}()
 }
 
 func cloudConfigFromEnv(opts config.AutoscalingOptions) (upCloudConfig, error) {
 	cfg := upCloudConfig{}
 
-	if cfg.ClusterID = os.Getenv(envUpCloudClusterID); cfg.ClusterID == "" {
-		return cfg, fmt.Errorf("environment variable %s not set", envUpCloudClusterID)
-	}
-	if cfg.Username = os.Getenv(envUpCloudUsername); cfg.Username == "" {
-		return cfg, fmt.Errorf("environment variable %s not set", envUpCloudUsername)
+	// cluster ID is detected using cluster nodes when it's not set
+	cfg.ClusterID = os.Getenv(envUpCloudClusterID)
+	var err error
+	if cfg.UsernameFile = os.Getenv(envUpCloudUsernameFile); cfg.UsernameFile != "" {
+		if cfg.Username, err = readCredentialFile(cfg.UsernameFile); err != nil {
+			return cfg, err
+		}
+	} else if cfg.Username = os.Getenv(envUpCloudUsername); cfg.Username == "" {
+		return cfg, fmt.Errorf("environment variable %s or %s not set", envUpCloudUsername, envUpCloudUsernameFile)
 	}
-	if cfg.Password = os.Getenv(envUpCloudPassword); cfg.Password == "" {
-		return cfg, fmt.Errorf("environment variable %s not set", envUpCloudPassword)
+	if cfg.PasswordFile = os.Getenv(envUpCloudPasswordFile); cfg.PasswordFile != "" {
+		if cfg.Password, err = readCredentialFile(cfg.PasswordFile); err != nil {
+			return cfg, err
+		}
+	} else if cfg.Password = os.Getenv(envUpCloudPassword); cfg.Password == "" {
+		return cfg, fmt.Errorf("environment variable %s or %s not set", envUpCloudPassword, envUpCloudPasswordFile)
 	}
 	if opts.UserAgent != "" {
 		cfg.UserAgent = opts.UserAgent
 	}
+	cfg.RecordFile = os.Getenv(envUpCloudRecordFile)
+	if debugLog := os.Getenv(envUpCloudAPIDebugLog); debugLog != "" {
+		if cfg.APIDebugLog, err = strconv.ParseBool(debugLog); err != nil {
+			return cfg, fmt.Errorf("environment variable %s is not valid boolean: %s", envUpCloudAPIDebugLog, debugLog)
+		}
+	}
+	if apiURL := os.Getenv(envUpCloudAPIURL); apiURL != "" {
+		u, err := url.Parse(apiURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, fmt.Errorf("environment variable %s is not valid HTTP(S) URL: %s", envUpCloudAPIURL, apiURL)
+		}
+		cfg.APIURL = strings.TrimSuffix(apiURL, "/")
+	}
+	cfg.NodeGroupCacheTTL = defaultNodeGroupCacheTTL
+	if ttl := os.Getenv(envUpCloudNodeGroupCacheTTL); ttl != "" {
+		if cfg.NodeGroupCacheTTL, err = time.ParseDuration(ttl); err != nil || cfg.NodeGroupCacheTTL < 0 {
+			return cfg, fmt.Errorf("environment variable %s is not valid duration: %s", envUpCloudNodeGroupCacheTTL, ttl)
+		}
+	}
+	if interval := os.Getenv(envUpCloudRefreshInterval); interval != "" {
+		if cfg.RefreshInterval, err = time.ParseDuration(interval); err != nil || cfg.RefreshInterval < 0 {
+			return cfg, fmt.Errorf("environment variable %s is not valid duration: %s", envUpCloudRefreshInterval, interval)
+		}
+	}
+	cfg.APIRateLimit = defaultAPIRateLimit
+	if rate := os.Getenv(envUpCloudAPIRateLimit); rate != "" {
+		if cfg.APIRateLimit, err = strconv.ParseFloat(rate, 64); err != nil || cfg.APIRateLimit < 0 {
+			return cfg, fmt.Errorf("environment variable %s is not valid number of requests per second: %s", envUpCloudAPIRateLimit, rate)
+		}
+	}
+	cfg.APIRetries = defaultAPIRetries
+	if retries := os.Getenv(envUpCloudAPIRetries); retries != "" {
+		if cfg.APIRetries, err = strconv.Atoi(retries); err != nil || cfg.APIRetries < 0 {
+			return cfg, fmt.Errorf("environment variable %s is not valid number of retries: %s", envUpCloudAPIRetries, retries)
+		}
+	}
+	if dryRun := os.Getenv(envUpCloudDryRun); dryRun != "" {
+		if cfg.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+			return cfg, fmt.Errorf("environment variable %s is not valid boolean: %s", envUpCloudDryRun, dryRun)
+		}
+	}
+	if systemPods := os.Getenv(envUpCloudTemplateSystemPods); systemPods != "" {
+		if cfg.TemplateSystemPods, err = strconv.ParseBool(systemPods); err != nil {
+			return cfg, fmt.Errorf("environment variable %s is not valid boolean: %s", envUpCloudTemplateSystemPods, systemPods)
+		}
+	}
+	if cfg.TracingEndpoint = os.Getenv(envUpCloudTracingEndpoint); cfg.TracingEndpoint != "" {
+		cfg.TracingSamplingRatePerMillion = defaultTracingSamplingRate
+	}
+	if rate := os.Getenv(envUpCloudTracingSamplingRate); rate != "" {
+		n, err := strconv.ParseInt(rate, 10, 32)
+		if err != nil || n < 0 || n > 1000000 {
+			return cfg, fmt.Errorf("environment variable %s is not valid number of samples per million: %s", envUpCloudTracingSamplingRate, rate)
+		}
+		cfg.TracingSamplingRatePerMillion = int32(n)
+	}
+	if cfg.TemplateConfigMap = os.Getenv(envUpCloudTemplateConfigMap); cfg.TemplateConfigMap != "" && !validTemplateConfigMap(cfg.TemplateConfigMap) {
+		return cfg, fmt.Errorf("environment variable %s is not valid ConfigMap in format [<namespace>/]<name>: %s", envUpCloudTemplateConfigMap, cfg.TemplateConfigMap)
+	}
+	if maxNodes := os.Getenv(envUpCloudAntiAffinityMaxNodes); maxNodes != "" {
+		if cfg.AntiAffinityMaxNodes, err = strconv.Atoi(maxNodes); err != nil || cfg.AntiAffinityMaxNodes < 0 {
+			return cfg, fmt.Errorf("environment variable %s is not valid number of nodes: %s", envUpCloudAntiAffinityMaxNodes, maxNodes)
+		}
+	}
+	minSize, maxSize := os.Getenv(envUpCloudNodeGroupDefaultMin), os.Getenv(envUpCloudNodeGroupDefaultMax)
+	if minSize != "" || maxSize != "" {
+		d := &nodeGroupSizeDefaults{minSize: nodeGroupMinSize}
+		if minSize != "" {
+			if d.minSize, err = strconv.Atoi(minSize); err != nil || d.minSize < 0 {
+				return cfg, fmt.Errorf("environment variable %s is not valid number of nodes: %s", envUpCloudNodeGroupDefaultMin, minSize)
+			}
+		}
+		if maxSize != "" {
+			if d.maxSize, err = strconv.Atoi(maxSize); err != nil || d.maxSize <= 0 {
+				return cfg, fmt.Errorf("environment variable %s is not valid number of nodes: %s", envUpCloudNodeGroupDefaultMax, maxSize)
+			}
+		}
+		if d.maxSize > 0 && d.minSize > d.maxSize {
+			return cfg, fmt.Errorf("environment variable %s value %d is greater than %s value %d",
+				envUpCloudNodeGroupDefaultMin, d.minSize, envUpCloudNodeGroupDefaultMax, d.maxSize)
+		}
+		cfg.NodeGroupSizeDefaults = d
+	}
 
 	return cfg, nil
 }
@@ -19,15 +19,22 @@ package upcloud
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/mocks"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestUpCloudCloudProvider_NodeGroups(t *testing.T) {
@@ -99,6 +106,10 @@ func TestBuildCloudConfig(t *testing.T) {
 		Username:  "uks-username",
 		Password:  "uks-passwd",
 		UserAgent: "uks-agent",
+
+		NodeGroupCacheTTL: defaultNodeGroupCacheTTL,
+		APIRateLimit:      defaultAPIRateLimit,
+		APIRetries:        defaultAPIRetries,
 	}
 	_, err := buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
 	require.Error(t, err)
@@ -115,20 +126,213 @@ func TestBuildCloudConfig(t *testing.T) {
 	got, err := buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
 	require.NoError(t, err)
 	require.Equal(t, want, got)
+
+	want.RecordFile = "/tmp/upcloud-trace.json"
+	t.Setenv(envUpCloudRecordFile, want.RecordFile)
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudAPIDebugLog, "yes")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.APIDebugLog = true
+	t.Setenv(envUpCloudAPIDebugLog, "true")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudAPIURL, "api.upcloud.test")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.APIURL = "http://127.0.0.1:8080"
+	t.Setenv(envUpCloudAPIURL, want.APIURL+"/")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudNodeGroupCacheTTL, "-1s")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.NodeGroupCacheTTL = 0
+	t.Setenv(envUpCloudNodeGroupCacheTTL, "0s")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudAPIRateLimit, "fast")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.APIRateLimit = 2.5
+	t.Setenv(envUpCloudAPIRateLimit, "2.5")
+	t.Setenv(envUpCloudAPIRetries, "-1")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.APIRetries = 0
+	t.Setenv(envUpCloudAPIRetries, "0")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudRefreshInterval, "often")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.RefreshInterval = 5 * time.Minute
+	t.Setenv(envUpCloudRefreshInterval, "5m")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudDryRun, "maybe")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.DryRun = true
+	t.Setenv(envUpCloudDryRun, "true")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudTemplateSystemPods, "never")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.TemplateSystemPods = true
+	t.Setenv(envUpCloudTemplateSystemPods, "true")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	want.TracingEndpoint = "otel-collector:4317"
+	want.TracingSamplingRatePerMillion = defaultTracingSamplingRate
+	t.Setenv(envUpCloudTracingEndpoint, want.TracingEndpoint)
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudTracingSamplingRate, "2000000")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.TracingSamplingRatePerMillion = 1000
+	t.Setenv(envUpCloudTracingSamplingRate, "1000")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudTemplateConfigMap, "kube-system/")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.TemplateConfigMap = "kube-system/templates"
+	t.Setenv(envUpCloudTemplateConfigMap, want.TemplateConfigMap)
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudAntiAffinityMaxNodes, "-3")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.AntiAffinityMaxNodes = 3
+	t.Setenv(envUpCloudAntiAffinityMaxNodes, "3")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudNodeGroupDefaultMax, "0")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.NodeGroupSizeDefaults = &nodeGroupSizeDefaults{minSize: nodeGroupMinSize, maxSize: 5}
+	t.Setenv(envUpCloudNodeGroupDefaultMax, "5")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Setenv(envUpCloudNodeGroupDefaultMin, "6")
+	_, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.Error(t, err)
+
+	want.NodeGroupSizeDefaults.minSize = 0
+	t.Setenv(envUpCloudNodeGroupDefaultMin, "0")
+	got, err = buildCloudConfig(config.AutoscalingOptions{UserAgent: want.UserAgent})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func TestDetectClusterID(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(uuid.New()).WithNodeGroups(mocks.NewTestNodeGroup("other").WithNodes(1)).Service()
+	c := mocks.NewTestCluster(clusterID).WithNodeGroups(mocks.NewTestNodeGroup("group1").WithNodes(2)).Cluster()
+	svc.Clusters[c.UUID] = c
+
+	client := fake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "master"}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "group1-node-1"}, Spec: v1.NodeSpec{ProviderID: providerIDPrefix + "group1-1"}},
+	)
+	nodeUUIDs, err := kubeNodeUUIDs(context.Background(), client)
+	require.NoError(t, err)
+	require.Equal(t, []string{"group1-1"}, nodeUUIDs)
+
+	got, err := detectClusterID(context.Background(), svc, nodeUUIDs)
+	require.NoError(t, err)
+	require.Equal(t, clusterID.String(), got)
+
+	_, err = detectClusterID(context.Background(), svc, []string{"unknown-0"})
+	require.Error(t, err)
+	_, err = detectClusterID(context.Background(), svc, nil)
+	require.Error(t, err)
+}
+
+func TestNewUpCloudService_APIURL(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1.3/kubernetes/"+clusterID.String() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"uuid":"` + clusterID.String() + `","plan":"dev"}`))
+	}))
+	defer srv.Close()
+
+	svc, err := newUpCloudService(upCloudConfig{Username: "user", Password: "passwd", APIURL: srv.URL})
+	require.NoError(t, err)
+	c, err := svc.GetKubernetesCluster(context.Background(), &request.GetKubernetesClusterRequest{UUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Equal(t, "dev", c.Plan)
 }
 
 func TestUpCloudCloudProvider_GPULabel(t *testing.T) {
 	t.Parallel()
 
 	p := upCloudCloudProvider{}
-	require.Empty(t, p.GPULabel())
+	require.Equal(t, gpuLabel, p.GPULabel())
 }
 
 func TestUpCloudCloudProvider_GetAvailableGPUTypes(t *testing.T) {
 	t.Parallel()
 
-	p := upCloudCloudProvider{}
-	require.Nil(t, p.GetAvailableGPUTypes())
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(
+		mocks.NewTestNodeGroup("cpu").WithNodes(1),
+		mocks.NewTestNodeGroup("gpu").WithNodes(1).WithPlan("GPU-8xCPU-64GB-1xL40S"),
+	).Service()
+	p := newUpCloudCloudProvider(clusterID, svc)
+	require.Empty(t, p.GetAvailableGPUTypes())
+	require.NoError(t, p.Refresh())
+	require.Equal(t, map[string]struct{}{"NVIDIA-L40S": {}}, p.GetAvailableGPUTypes())
 }
 
 func TestUpCloudCloudProvider_Cleanup(t *testing.T) {
@@ -136,6 +340,32 @@ func TestUpCloudCloudProvider_Cleanup(t *testing.T) {
 
 	p := upCloudCloudProvider{}
 	require.Nil(t, p.Cleanup())
+
+	clusterID := uuid.New()
+	svc := newMockService(clusterID)
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	p = upCloudCloudProvider{manager: m}
+	g := m.getNodeGroups()[0]
+
+	// cleanup aborts in-flight polling and later operations
+	svc.SetFaults(mocks.Faults{NodeGroupStates: map[string][]upcloud.KubernetesNodeGroupState{
+		g.name: {upcloud.KubernetesNodeGroupStatePending},
+	}})
+	errs := make(chan error, 1)
+	go func() {
+		_, err := g.waitNodeGroupState(g.lifecycle.context(), upcloud.KubernetesNodeGroupStateRunning, time.Minute)
+		errs <- err
+	}()
+	require.Nil(t, p.Cleanup())
+	select {
+	case err := <-errs:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(10 * time.Second):
+		t.Fatal("node group state polling was not cancelled")
+	}
+	require.Error(t, g.IncreaseSize(1))
 }
 
 func TestUpCloudCloudProvider_GetNodeGpuConfig(t *testing.T) {
@@ -149,22 +379,277 @@ func TestUpCloudCloudProvider_GetNodeGpuConfig(t *testing.T) {
 	}))
 }
 
+func TestUpCloudCloudProvider_HasInstance(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newMockService(clusterID)
+	p := newUpCloudCloudProvider(clusterID, svc)
+	node := func(providerID string) *v1.Node {
+		return &v1.Node{Spec: v1.NodeSpec{ProviderID: providerID}}
+	}
+
+	got, err := p.HasInstance(node("upcloud:////group1-1"))
+	require.NoError(t, err)
+	require.True(t, got)
+
+	got, err = p.HasInstance(node("upcloud:////deleted"))
+	require.NoError(t, err)
+	require.False(t, got)
+
+	_, err = p.HasInstance(node(""))
+	require.ErrorIs(t, err, cloudprovider.ErrNotImplemented)
+
+	// node created after the cache was updated is found once the cache is old enough to be updated
+	require.NoError(t, svc.AppendNodeGroup(context.Background(), clusterID, mocks.NewTestNodeGroup("group3").WithNodes(1).NodeGroup()))
+	got, err = p.HasInstance(node("upcloud:////group3-0"))
+	require.NoError(t, err)
+	require.False(t, got)
+	p.manager.instances.fetchedAt = time.Now().Add(-instanceCacheMinAge)
+	got, err = p.HasInstance(node("upcloud:////group3-0"))
+	require.NoError(t, err)
+	require.True(t, got)
+
+	svc.SetFaults(mocks.Faults{ErrorRate: 1})
+	p.manager.instances.fetchedAt = time.Now().Add(-instanceCacheTTL)
+	got, err = p.HasInstance(node("upcloud:////group1-1"))
+	require.Error(t, err)
+	require.True(t, got)
+}
+
+func TestUpCloudCloudProvider_HasInstanceConcurrentUpdate(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newMockService(clusterID)
+	p := newUpCloudCloudProvider(clusterID, svc)
+	node := func(providerID string) *v1.Node {
+		return &v1.Node{Spec: v1.NodeSpec{ProviderID: providerID}}
+	}
+	got, err := p.HasInstance(node("upcloud:////group1-1"))
+	require.NoError(t, err)
+	require.True(t, got)
+
+	// unknown node updates the slow API, cached node is found without waiting for the update
+	svc.SetFaults(mocks.Faults{Latency: time.Second})
+	p.manager.instances.mu.Lock()
+	p.manager.instances.fetchedAt = time.Now().Add(-instanceCacheMinAge)
+	p.manager.instances.mu.Unlock()
+	updated := make(chan error, 1)
+	go func() {
+		_, err := p.HasInstance(node("upcloud:////unknown"))
+		updated <- err
+	}()
+	require.Eventually(t, func() bool {
+		if !p.manager.instances.updateMu.TryLock() {
+			return true
+		}
+		p.manager.instances.updateMu.Unlock()
+		return false
+	}, 5*time.Second, time.Millisecond)
+	start := time.Now()
+	got, err = p.HasInstance(node("upcloud:////group2-1"))
+	require.NoError(t, err)
+	require.True(t, got)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.NoError(t, <-updated)
+}
+
 func TestUpCloudCloudProvider_ErrNotImplemented(t *testing.T) {
 	t.Parallel()
 
 	p := upCloudCloudProvider{}
 
-	_, err := p.HasInstance(nil)
-	require.ErrorIs(t, err, cloudprovider.ErrNotImplemented)
+	_, aerr := p.Pricing()
+	require.ErrorIs(t, aerr, cloudprovider.ErrNotImplemented)
 
-	_, err = p.Pricing()
-	require.ErrorIs(t, err, cloudprovider.ErrNotImplemented)
+}
 
-	_, err = p.GetAvailableMachineTypes()
-	require.ErrorIs(t, err, cloudprovider.ErrNotImplemented)
+func TestUpCloudCloudProvider_NewNodeGroup(t *testing.T) {
+	t.Parallel()
 
-	_, err = p.NewNodeGroup("", nil, nil, nil, nil)
-	require.ErrorIs(t, err, cloudprovider.ErrNotImplemented)
+	clusterID := uuid.New()
+	svc := newMockService(clusterID)
+	p := newUpCloudCloudProvider(clusterID, svc)
+	p.manager.maxNodesTotal = 10
+
+	plans, err := p.GetAvailableMachineTypes()
+	require.NoError(t, err)
+	require.Contains(t, plans, mocks.TestNodeGroupPlan)
+
+	_, err = p.NewNodeGroup("custom", nil, nil, nil, nil)
+	require.Error(t, err)
+
+	taints := []v1.Taint{{Key: "dedicated", Value: "batch", Effect: v1.TaintEffectNoSchedule}}
+	ng, err := p.NewNodeGroup(mocks.TestNodeGroupPlan, map[string]string{"role": "batch", v1.LabelHostname: "ignored"}, nil, taints, nil)
+	require.NoError(t, err)
+	require.False(t, ng.Exist())
+	require.True(t, ng.Autoprovisioned())
+	require.Equal(t, 0, ng.MinSize())
+	require.Equal(t, 10, ng.MaxSize())
+	nodeInfo, err := ng.TemplateNodeInfo()
+	require.NoError(t, err)
+	require.Equal(t, "batch", nodeInfo.Node().Labels["role"])
+	require.Equal(t, taints, nodeInfo.Node().Spec.Taints)
+
+	created, err := ng.Create()
+	require.NoError(t, err)
+	require.True(t, created.Exist())
+	_, err = created.Create()
+	require.Error(t, err)
+
+	// scale-up is requested as if node group was empty
+	require.NoError(t, created.IncreaseSize(3))
+	size, err := created.TargetSize()
+	require.NoError(t, err)
+	require.Equal(t, 3, size)
+
+	require.NoError(t, p.Refresh())
+	var refreshed cloudprovider.NodeGroup
+	for _, g := range p.NodeGroups() {
+		if g.Id() == created.Id() {
+			refreshed = g
+		}
+	}
+	require.NotNil(t, refreshed)
+	require.True(t, refreshed.Autoprovisioned())
+	require.Equal(t, 0, refreshed.MinSize())
+	g, err := svc.GetKubernetesNodeGroup(context.Background(), &request.GetKubernetesNodeGroupRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        refreshed.(*upCloudNodeGroup).name,
+	})
+	require.NoError(t, err)
+	require.Equal(t, mocks.TestNodeGroupPlan, g.Plan)
+	require.ElementsMatch(t, []upcloud.Label{{Key: labelAutoprovisioned, Value: "true"}, {Key: "role", Value: "batch"}}, g.Labels)
+	require.Equal(t, []upcloud.KubernetesTaint{{Key: "dedicated", Value: "batch", Effect: upcloud.KubernetesClusterTaintEffectNoSchedule}}, g.Taints)
+
+	require.NoError(t, refreshed.Delete())
+	require.NoError(t, p.Refresh())
+	require.Len(t, p.NodeGroups(), 2)
+}
+
+func TestUpCloudCloudProvider_NewNodeGroupAtomicIncreaseSize(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newMockService(clusterID)
+	p := newUpCloudCloudProvider(clusterID, svc)
+	p.manager.maxNodesTotal = 10
+
+	ng, err := p.NewNodeGroup(mocks.TestNodeGroupPlan, nil, nil, nil, nil)
+	require.NoError(t, err)
+	created, err := ng.Create()
+	require.NoError(t, err)
+	require.Equal(t, 1, autoprovisionedInitialSize)
+	size, err := created.TargetSize()
+	require.NoError(t, err)
+	require.Equal(t, autoprovisionedInitialSize, size)
+
+	// atomic scale-up counts the initial node like IncreaseSize does
+	require.NoError(t, created.AtomicIncreaseSize(3))
+	size, err = created.TargetSize()
+	require.NoError(t, err)
+	require.Equal(t, 3, size)
+	g, err := svc.GetKubernetesNodeGroup(context.Background(), &request.GetKubernetesNodeGroupRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        created.(*upCloudNodeGroup).name,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, g.Count)
+
+	// initial nodes count only towards the first scale-up
+	require.NoError(t, created.AtomicIncreaseSize(1))
+	size, err = created.TargetSize()
+	require.NoError(t, err)
+	require.Equal(t, 4, size)
+}
+
+func TestManager_DeleteEmptyAutoprovisionedNodeGroup(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(
+		mocks.NewTestNodeGroup("group1").WithNodes(1).WithLabel(labelAutoprovisioned, "true"),
+		mocks.NewTestNodeGroup("group2").WithLabel(labelAutoprovisioned, "true"),
+		mocks.NewTestNodeGroup("group3"),
+	).Service()
+	p := newUpCloudCloudProvider(clusterID, svc)
+	require.NoError(t, p.Refresh())
+	groups := p.NodeGroups()
+	require.Len(t, groups, 2)
+	require.True(t, groups[0].Autoprovisioned())
+	require.False(t, groups[1].Autoprovisioned())
+	require.Error(t, groups[1].Delete())
+
+	ngs, err := svc.GetKubernetesNodeGroups(context.Background(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Len(t, ngs, 2)
+}
+
+// TestUpCloudCloudProvider_Concurrency runs refresh, read, scale and delete operations concurrently.
+// Run with -race flag to detect data races.
+func TestUpCloudCloudProvider_Concurrency(t *testing.T) {
+	t.Parallel()
+
+	const iterations int = 20
+
+	clusterID := uuid.New()
+	svc := newMockService(clusterID)
+	p := newUpCloudCloudProvider(clusterID, svc)
+	p.manager.maxNodesTotal = mocks.TestClusterPlanMaxNodes
+	require.NoError(t, p.Refresh())
+
+	var wg sync.WaitGroup
+	run := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				fn()
+			}
+		}()
+	}
+	run(func() {
+		require.NoError(t, p.Refresh())
+	})
+	run(func() {
+		for _, g := range p.NodeGroups() {
+			_, _ = g.TargetSize()
+			_, _ = g.Nodes()
+			_ = g.Debug()
+		}
+		_, err := p.NodeGroupForNode(&v1.Node{Spec: v1.NodeSpec{ProviderID: "upcloud:////group1-0"}})
+		require.NoError(t, err)
+	})
+	run(func() {
+		for _, g := range p.NodeGroups() {
+			_ = g.IncreaseSize(1)
+		}
+	})
+	run(func() {
+		for _, g := range p.NodeGroups() {
+			_ = g.DecreaseTargetSize(-1)
+		}
+	})
+	run(func() {
+		for _, g := range p.NodeGroups() {
+			_ = g.DeleteNodes([]*v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "group1-node-0"}}})
+		}
+	})
+	wg.Wait()
+
+	// cached sizes must match API state once operations have finished
+	require.NoError(t, p.Refresh())
+	for _, g := range p.manager.getNodeGroups() {
+		ng, err := svc.GetKubernetesNodeGroup(context.TODO(), &request.GetKubernetesNodeGroupRequest{
+			ClusterUUID: clusterID.String(),
+			Name:        g.name,
+		})
+		require.NoError(t, err)
+		size, err := g.TargetSize()
+		require.NoError(t, err)
+		require.Equal(t, ng.Count, size)
+	}
 }
 
 func newUpCloudCloudProvider(clusterID uuid.UUID, svc *mocks.UpCloudService) upCloudCloudProvider {
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	kube_client "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// detectClusterID returns the UUID of the UKS cluster that has a node with any of the node UUIDs
+func detectClusterID(ctx context.Context, svc upCloudService, nodeUUIDs []string) (string, error) {
+	if len(nodeUUIDs) == 0 {
+		return "", fmt.Errorf("unable to detect cluster ID, Kubernetes cluster doesn't have UpCloud nodes")
+	}
+	clusters, err := svc.GetKubernetesClusters(ctx, &request.GetKubernetesClustersRequest{})
+	if err != nil {
+		return "", fmt.Errorf("unable to detect cluster ID, failed to list clusters: %w", err)
+	}
+	for _, c := range clusters {
+		uuids, err := listClusterNodeUUIDs(ctx, svc, c.UUID)
+		if err != nil {
+			return "", fmt.Errorf("unable to detect cluster ID, failed to list cluster %s nodes: %w", c.UUID, err)
+		}
+		for _, u := range nodeUUIDs {
+			if _, ok := uuids[u]; ok {
+				klog.Infof("detected UKS cluster %s (%s) using node %s", c.Name, c.UUID, u)
+				return c.UUID, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unable to detect cluster ID, none of the %d clusters has Kubernetes cluster nodes", len(clusters))
+}
+
+// kubeNodeUUIDs returns UUIDs of UpCloud nodes using node provider IDs
+func kubeNodeUUIDs(ctx context.Context, client kube_client.Interface) ([]string, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Kubernetes nodes: %w", err)
+	}
+	uuids := make([]string, 0, len(nodes.Items))
+	for _, n := range nodes.Items {
+		if u, ok := strings.CutPrefix(n.Spec.ProviderID, providerIDPrefix); ok && u != "" {
+			uuids = append(uuids, u)
+		}
+	}
+	return uuids, nil
+}
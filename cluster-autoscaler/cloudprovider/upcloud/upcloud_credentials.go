@@ -0,0 +1,82 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// serviceBuilder builds UpCloud service using credentials from the config
+type serviceBuilder func(cfg upCloudConfig) (upCloudService, error)
+
+// credentialFiles reloads API credentials from files, e.g. mounted from Kubernetes secret, so that
+// credentials can be rotated without restarting the autoscaler.
+type credentialFiles struct {
+	// cfg holds currently loaded credentials
+	cfg        upCloudConfig
+	newService serviceBuilder
+}
+
+// newCredentialFiles returns nil if credentials are not loaded from files
+func newCredentialFiles(cfg upCloudConfig, newService serviceBuilder) *credentialFiles {
+	if cfg.UsernameFile == "" && cfg.PasswordFile == "" {
+		return nil
+	}
+	return &credentialFiles{cfg: cfg, newService: newService}
+}
+
+// reload re-reads credential files and returns new service if credentials have changed
+func (c *credentialFiles) reload() (upCloudService, bool, error) {
+	cfg := c.cfg
+	var err error
+	if cfg.UsernameFile != "" {
+		if cfg.Username, err = readCredentialFile(cfg.UsernameFile); err != nil {
+			return nil, false, err
+		}
+	}
+	if cfg.PasswordFile != "" {
+		if cfg.Password, err = readCredentialFile(cfg.PasswordFile); err != nil {
+			return nil, false, err
+		}
+	}
+	if cfg.Username == c.cfg.Username && cfg.Password == c.cfg.Password {
+		return nil, false, nil
+	}
+	svc, err := c.newService(cfg)
+	if err != nil {
+		return nil, false, err
+	}
+	c.cfg = cfg
+	klog.Infof("UpCloud API credentials reloaded from file")
+	return svc, true, nil
+}
+
+func readCredentialFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return "", fmt.Errorf("credentials file %s is empty", path)
+	}
+	return s, nil
+}
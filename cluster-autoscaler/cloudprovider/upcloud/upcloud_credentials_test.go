@@ -0,0 +1,90 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+)
+
+func TestBuildCloudConfig_CredentialFiles(t *testing.T) {
+	dir := t.TempDir()
+	usernameFile := filepath.Join(dir, "username")
+	passwordFile := filepath.Join(dir, "password")
+	t.Setenv(envUpCloudClusterID, uuid.NewString())
+	t.Setenv(envUpCloudUsernameFile, usernameFile)
+	t.Setenv(envUpCloudPasswordFile, passwordFile)
+
+	_, err := buildCloudConfig(config.AutoscalingOptions{})
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(usernameFile, []byte("uks-username\n"), 0o600))
+	require.NoError(t, os.WriteFile(passwordFile, []byte("uks-passwd\n"), 0o600))
+	got, err := buildCloudConfig(config.AutoscalingOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "uks-username", got.Username)
+	require.Equal(t, "uks-passwd", got.Password)
+	require.Equal(t, usernameFile, got.UsernameFile)
+	require.Equal(t, passwordFile, got.PasswordFile)
+}
+
+func TestManager_ReloadCredentials(t *testing.T) {
+	t.Parallel()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("old"), 0o600))
+
+	clusterID := uuid.New()
+	cfg := upCloudConfig{ClusterID: clusterID.String(), Username: "user", Password: "old", PasswordFile: passwordFile}
+	svc := newMockService(clusterID)
+	m, err := newManager(context.Background(), svc, cfg, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+
+	rotated := newMockService(clusterID)
+	built := make([]upCloudConfig, 0)
+	m.credentials = newCredentialFiles(cfg, func(cfg upCloudConfig) (upCloudService, error) {
+		built = append(built, cfg)
+		return rotated, nil
+	})
+
+	// unchanged credentials keep the service
+	require.NoError(t, m.refresh())
+	require.Same(t, svc, unwrapHealthService(t, m.svc))
+	require.Empty(t, built)
+
+	require.NoError(t, os.WriteFile(passwordFile, []byte("new"), 0o600))
+	require.NoError(t, m.refresh())
+	require.Same(t, rotated, unwrapHealthService(t, m.svc))
+	require.Len(t, built, 1)
+	require.Equal(t, "new", built[0].Password)
+	for _, g := range m.getNodeGroups() {
+		require.Same(t, rotated, unwrapHealthService(t, g.svc))
+	}
+
+	// unreadable file keeps the previous credentials
+	require.NoError(t, os.Remove(passwordFile))
+	require.NoError(t, m.refresh())
+	require.Same(t, rotated, unwrapHealthService(t, m.svc))
+	require.Len(t, built, 1)
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+)
+
+// nodeGroupDebug is the JSON document returned by node group Debug
+type nodeGroupDebug struct {
+	ID              string            `json:"id"`
+	MinSize         int               `json:"minSize"`
+	MaxSize         int               `json:"maxSize"`
+	TargetSize      int               `json:"targetSize"`
+	Exists          bool              `json:"exists"`
+	Autoprovisioned bool              `json:"autoprovisioned,omitempty"`
+	ZeroOrMax       bool              `json:"zeroOrMaxNodeScaling,omitempty"`
+	Plan            planDebug         `json:"plan"`
+	Zone            string            `json:"zone,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Taints          []apiv1.Taint     `json:"taints,omitempty"`
+	KubeletArgs     map[string]string `json:"kubeletArgs,omitempty"`
+	Nodes           []nodeDebug       `json:"nodes"`
+	InFlight        *inFlightDebug    `json:"inFlight,omitempty"`
+	LastFailure     *failureDebug     `json:"lastFailure,omitempty"`
+}
+
+type planDebug struct {
+	Name       string `json:"name"`
+	Cores      int64  `json:"cores,omitempty"`
+	MemoryMiB  int64  `json:"memoryMiB,omitempty"`
+	StorageGiB int64  `json:"storageGiB,omitempty"`
+	GPUs       int64  `json:"gpus,omitempty"`
+	GPUType    string `json:"gpuType,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type nodeDebug struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// inFlightDebug describes operations that haven't completed yet
+type inFlightDebug struct {
+	// RequestedSize is the requested size that API doesn't list yet
+	RequestedSize *int   `json:"requestedSize,omitempty"`
+	RequestedAgo  string `json:"requestedAgo,omitempty"`
+	// Placeholders is the number of requested nodes that node group details don't list yet
+	Placeholders int `json:"placeholders,omitempty"`
+	// NotRunning is the number of nodes that are being created, deleted or have failed
+	NotRunning int `json:"notRunning,omitempty"`
+}
+
+// failureDebug describes recent failed scaling operation
+type failureDebug struct {
+	Operation      ScaleOperationType `json:"operation"`
+	Ago            string             `json:"ago"`
+	OutOfResources bool               `json:"outOfResources,omitempty"`
+	Code           string             `json:"code"`
+	Message        string             `json:"message"`
+}
+
+// debug returns current state of the node group
+func (u *upCloudNodeGroup) debug() nodeGroupDebug {
+	d := nodeGroupDebug{
+		ID:              fmt.Sprintf("%s/%s", u.clusterID.String(), u.name),
+		MinSize:         u.minSize,
+		MaxSize:         u.maxSize,
+		Autoprovisioned: u.autoprovisioned,
+		ZeroOrMax:       u.zeroOrMaxNodeScaling,
+		Plan:            planDebug{Name: u.plan},
+		Zone:            u.zone,
+		Labels:          u.labels,
+		Taints:          u.taints,
+		KubeletArgs:     u.kubeletArgs,
+	}
+	if plan, err := u.serverPlan(); err != nil {
+		d.Plan.Error = err.Error()
+	} else {
+		d.Plan.Cores = plan.cores
+		d.Plan.MemoryMiB = plan.memoryMiB
+		d.Plan.StorageGiB = plan.storageGiB
+		d.Plan.GPUs = plan.gpus
+		d.Plan.GPUType = plan.gpuType
+	}
+	inFlight := &inFlightDebug{}
+	if p, ok := u.pending.get(u.name); ok {
+		inFlight.RequestedSize = &p.size
+		inFlight.RequestedAgo = time.Since(p.requestedAt).Round(time.Second).String()
+	}
+	u.mu.RLock()
+	d.TargetSize = u.size
+	d.Exists = u.name != "" && !u.theoretical
+	d.Nodes = make([]nodeDebug, 0, len(u.nodes))
+	for _, n := range u.nodes {
+		nd := nodeDebug{ID: n.Id, State: instanceStateName(n.Status)}
+		if n.Status != nil && n.Status.ErrorInfo != nil {
+			nd.Error = fmt.Sprintf("%s: %s", n.Status.ErrorInfo.ErrorCode, n.Status.ErrorInfo.ErrorMessage)
+		}
+		if isPlaceholder(u.name, n.Id) {
+			inFlight.Placeholders++
+		} else if nd.State != "running" || nd.Error != "" {
+			inFlight.NotRunning++
+		}
+		d.Nodes = append(d.Nodes, nd)
+	}
+	u.mu.RUnlock()
+	if inFlight.RequestedSize != nil || inFlight.Placeholders > 0 || inFlight.NotRunning > 0 {
+		d.InFlight = inFlight
+	}
+	if f, ok := u.failures.get(u.name); ok {
+		d.LastFailure = &failureDebug{
+			Operation:      f.operation,
+			Ago:            time.Since(f.failedAt).Round(time.Second).String(),
+			OutOfResources: f.info.ErrorClass == cloudprovider.OutOfResourcesErrorClass,
+			Code:           f.info.ErrorCode,
+			Message:        f.err.Error(),
+		}
+	}
+	return d
+}
+
+func instanceStateName(s *cloudprovider.InstanceStatus) string {
+	if s == nil {
+		return "unknown"
+	}
+	switch s.State {
+	case cloudprovider.InstanceRunning:
+		return "running"
+	case cloudprovider.InstanceCreating:
+		return "creating"
+	case cloudprovider.InstanceDeleting:
+		return "deleting"
+	default:
+		return "unknown"
+	}
+}
+
+// providerDebug is the JSON document returned by cloud provider Debug
+type providerDebug struct {
+	ClusterID      string           `json:"clusterID"`
+	Zone           string           `json:"zone,omitempty"`
+	MaxNodesTotal  int              `json:"maxNodesTotal"`
+	NodeGroupSpecs []string         `json:"nodeGroupSpecs,omitempty"`
+	Health         string           `json:"health"`
+	NodeGroups     []nodeGroupDebug `json:"nodeGroups"`
+}
+
+func (m *manager) debug() providerDebug {
+	d := providerDebug{
+		ClusterID:     m.clusterID.String(),
+		Zone:          m.zone,
+		MaxNodesTotal: m.maxNodesTotal,
+		Health:        "healthy",
+		NodeGroups:    make([]nodeGroupDebug, 0),
+	}
+	for _, s := range m.nodeGroupSpecs {
+		d.NodeGroupSpecs = append(d.NodeGroupSpecs, fmt.Sprintf("%d:%d:%s", s.MinSize, s.MaxSize, s.Name))
+	}
+	sort.Strings(d.NodeGroupSpecs)
+	if err := m.health.check(); err != nil {
+		d.Health = err.Error()
+	}
+	for _, g := range m.getNodeGroups() {
+		d.NodeGroups = append(d.NodeGroups, g.debug())
+	}
+	return d
+}
+
+// debugJSON returns indented JSON document of v
+func debugJSON(v any) string {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("failed to encode debug information: %v", err)
+	}
+	return string(b)
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+	"k8s.io/klog/v2"
+)
+
+// dryRunService passes read requests to UpCloud API, but logs and skips requests that would change the cluster.
+// Skipped changes are simulated in the responses of later read requests, so that the autoscaler sees the node group
+// sizes it requested and nodes it deleted. Nodes of simulated scale-ups never appear, so they are eventually handled
+// by the autoscaler as failed scale-ups.
+type dryRunService struct {
+	svc   upCloudService
+	state *dryRunState
+}
+
+// dryRunState holds simulated changes, it's shared by services that are rebuilt when credentials change
+type dryRunState struct {
+	mu sync.Mutex
+	// sizes maps cluster/node group to simulated node group size
+	sizes map[string]int
+	// deletedNodes maps cluster/node group to names of simulated deleted nodes
+	deletedNodes map[string]map[string]bool
+	// deletedGroups contains cluster/node group of simulated deleted node groups
+	deletedGroups map[string]bool
+}
+
+func newDryRunState() *dryRunState {
+	return &dryRunState{
+		sizes:         make(map[string]int),
+		deletedNodes:  make(map[string]map[string]bool),
+		deletedGroups: make(map[string]bool),
+	}
+}
+
+func newDryRunService(svc upCloudService, state *dryRunState) *dryRunService {
+	return &dryRunService{svc: svc, state: state}
+}
+
+func dryRunKey(clusterUUID, name string) string {
+	return clusterUUID + "/" + name
+}
+
+// nodeGroups returns groups with simulated changes applied
+func (s *dryRunService) nodeGroups(clusterUUID string, groups []upcloud.KubernetesNodeGroup) []upcloud.KubernetesNodeGroup {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	simulated := make([]upcloud.KubernetesNodeGroup, 0, len(groups))
+	for _, g := range groups {
+		if s.simulate(clusterUUID, &g) {
+			simulated = append(simulated, g)
+		}
+	}
+	return simulated
+}
+
+// simulate applies simulated changes to the node group and returns false if the node group has been deleted.
+// Caller must hold the state lock.
+func (s *dryRunService) simulate(clusterUUID string, g *upcloud.KubernetesNodeGroup) bool {
+	key := dryRunKey(clusterUUID, g.Name)
+	if s.state.deletedGroups[key] {
+		return false
+	}
+	if size, ok := s.state.sizes[key]; ok {
+		g.Count = size
+	}
+	return true
+}
+
+func (s *dryRunService) GetKubernetesClusters(ctx context.Context, r *request.GetKubernetesClustersRequest) ([]upcloud.KubernetesCluster, error) {
+	clusters, err := s.svc.GetKubernetesClusters(ctx, r)
+	for i := range clusters {
+		clusters[i].NodeGroups = s.nodeGroups(clusters[i].UUID, clusters[i].NodeGroups)
+	}
+	return clusters, err
+}
+
+func (s *dryRunService) GetKubernetesCluster(ctx context.Context, r *request.GetKubernetesClusterRequest) (*upcloud.KubernetesCluster, error) {
+	c, err := s.svc.GetKubernetesCluster(ctx, r)
+	if c != nil {
+		c.NodeGroups = s.nodeGroups(r.UUID, c.NodeGroups)
+	}
+	return c, err
+}
+
+func (s *dryRunService) GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) ([]sdkext.KubernetesNodeGroup, error) {
+	groups, err := s.svc.GetKubernetesNodeGroups(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	simulated := make([]sdkext.KubernetesNodeGroup, 0, len(groups))
+	for _, g := range groups {
+		if s.simulate(r.ClusterUUID, &g.KubernetesNodeGroup) {
+			simulated = append(simulated, g)
+		}
+	}
+	return simulated, nil
+}
+
+func (s *dryRunService) GetKubernetesNodeGroup(ctx context.Context, r *request.GetKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroupDetails, error) {
+	key := dryRunKey(r.ClusterUUID, r.Name)
+	s.state.mu.Lock()
+	deleted := s.state.deletedGroups[key]
+	s.state.mu.Unlock()
+	if deleted {
+		return nil, &upcloud.Problem{Status: http.StatusNotFound, Title: fmt.Sprintf("node group %s deleted in dry-run mode", r.Name)}
+	}
+	g, err := s.svc.GetKubernetesNodeGroup(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	if size, ok := s.state.sizes[key]; ok {
+		g.Count = size
+	}
+	if deletedNodes := s.state.deletedNodes[key]; len(deletedNodes) > 0 {
+		nodes := make([]upcloud.KubernetesNode, 0, len(g.Nodes))
+		for _, n := range g.Nodes {
+			if !deletedNodes[n.Name] {
+				nodes = append(nodes, n)
+			}
+		}
+		g.Nodes = nodes
+	}
+	return g, nil
+}
+
+// CreateKubernetesNodeGroup fails, because node groups that don't exist can't be simulated using read requests
+func (s *dryRunService) CreateKubernetesNodeGroup(_ context.Context, r *request.CreateKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error) {
+	klog.InfoS("dry-run: skipped creating node group", logKeyClusterID, r.ClusterUUID, logKeyNodeGroup, r.NodeGroup.Name, "plan", r.NodeGroup.Plan)
+	return nil, fmt.Errorf("creating node group %s is not supported in dry-run mode", r.NodeGroup.Name)
+}
+
+func (s *dryRunService) ModifyKubernetesNodeGroup(ctx context.Context, r *request.ModifyKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error) {
+	g, err := s.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{ClusterUUID: r.ClusterUUID, Name: r.Name})
+	if err != nil {
+		return nil, err
+	}
+	klog.InfoS("dry-run: skipped scaling node group", logKeyClusterID, r.ClusterUUID, logKeyNodeGroup, r.Name, "from", g.Count, "to", r.NodeGroup.Count)
+	s.state.mu.Lock()
+	s.state.sizes[dryRunKey(r.ClusterUUID, r.Name)] = r.NodeGroup.Count
+	s.state.mu.Unlock()
+	g.Count = r.NodeGroup.Count
+	return &g.KubernetesNodeGroup, nil
+}
+
+func (s *dryRunService) DeleteKubernetesNodeGroup(_ context.Context, r *request.DeleteKubernetesNodeGroupRequest) error {
+	klog.InfoS("dry-run: skipped deleting node group", logKeyClusterID, r.ClusterUUID, logKeyNodeGroup, r.Name)
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	s.state.deletedGroups[dryRunKey(r.ClusterUUID, r.Name)] = true
+	return nil
+}
+
+func (s *dryRunService) DeleteKubernetesNodeGroupNode(ctx context.Context, r *request.DeleteKubernetesNodeGroupNodeRequest) error {
+	g, err := s.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{ClusterUUID: r.ClusterUUID, Name: r.Name})
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, n := range g.Nodes {
+		found = found || n.Name == r.NodeName
+	}
+	if !found {
+		return &upcloud.Problem{Status: http.StatusNotFound, Title: fmt.Sprintf("node %s not found", r.NodeName)}
+	}
+	klog.InfoS("dry-run: skipped deleting node", logKeyClusterID, r.ClusterUUID, logKeyNodeGroup, r.Name, "node", r.NodeName)
+	key := dryRunKey(r.ClusterUUID, r.Name)
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	if s.state.deletedNodes[key] == nil {
+		s.state.deletedNodes[key] = make(map[string]bool)
+	}
+	s.state.deletedNodes[key][r.NodeName] = true
+	s.state.sizes[key] = g.Count - 1
+	return nil
+}
+
+func (s *dryRunService) GetKubernetesPlans(ctx context.Context, r *request.GetKubernetesPlansRequest) ([]upcloud.KubernetesPlan, error) {
+	return s.svc.GetKubernetesPlans(ctx, r)
+}
+
+func (s *dryRunService) GetPlans(ctx context.Context, r *sdkext.GetPlansRequest) ([]sdkext.Plan, error) {
+	return s.svc.GetPlans(ctx, r)
+}
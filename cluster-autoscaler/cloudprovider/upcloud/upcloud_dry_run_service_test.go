@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+)
+
+func TestDryRunService(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	mock := newMockService(clusterID)
+	svc := newDryRunService(mock, newDryRunState())
+	ctx := context.Background()
+	detailsRequest := &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group1"}
+
+	_, err := svc.ModifyKubernetesNodeGroup(ctx, &request.ModifyKubernetesNodeGroupRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+		NodeGroup:   request.ModifyKubernetesNodeGroup{Count: 4},
+	})
+	require.NoError(t, err)
+	groups, err := svc.GetKubernetesNodeGroups(ctx, &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Equal(t, 4, groups[0].Count)
+	details, err := svc.GetKubernetesNodeGroup(ctx, detailsRequest)
+	require.NoError(t, err)
+	require.Equal(t, 4, details.Count)
+	require.Len(t, details.Nodes, 2)
+
+	require.NoError(t, svc.DeleteKubernetesNodeGroupNode(ctx, &request.DeleteKubernetesNodeGroupNodeRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+		NodeName:    details.Nodes[0].Name,
+	}))
+	details, err = svc.GetKubernetesNodeGroup(ctx, detailsRequest)
+	require.NoError(t, err)
+	require.Equal(t, 3, details.Count)
+	require.Len(t, details.Nodes, 1)
+	err = svc.DeleteKubernetesNodeGroupNode(ctx, &request.DeleteKubernetesNodeGroupNodeRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+		NodeName:    "group1-node-0",
+	})
+	requireProblemStatus(t, err, http.StatusNotFound)
+
+	_, err = svc.CreateKubernetesNodeGroup(ctx, &request.CreateKubernetesNodeGroupRequest{
+		ClusterUUID: clusterID.String(),
+		NodeGroup:   request.KubernetesNodeGroup{Name: "group3", Count: 1},
+	})
+	require.Error(t, err)
+	require.NoError(t, svc.DeleteKubernetesNodeGroup(ctx, &request.DeleteKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group2"}))
+	cluster, err := svc.GetKubernetesCluster(ctx, &request.GetKubernetesClusterRequest{UUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Len(t, cluster.NodeGroups, 1)
+	_, err = svc.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group2"})
+	requireProblemStatus(t, err, http.StatusNotFound)
+
+	// cluster is unchanged
+	details, err = mock.GetKubernetesNodeGroup(ctx, detailsRequest)
+	require.NoError(t, err)
+	require.Equal(t, 2, details.Count)
+	require.Len(t, details.Nodes, 2)
+	groups, err = mock.GetKubernetesNodeGroups(ctx, &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+}
+
+func TestManager_DryRun(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	mock := newMockService(clusterID)
+	svc := newDryRunService(mock, newDryRunState())
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	g := m.getNodeGroups()[0]
+	require.NoError(t, g.IncreaseSize(1))
+	require.NoError(t, m.refresh())
+	size, err := m.getNodeGroups()[0].TargetSize()
+	require.NoError(t, err)
+	require.Equal(t, 3, size)
+
+	details, err := mock.GetKubernetesNodeGroup(context.Background(), &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group1"})
+	require.NoError(t, err)
+	require.Equal(t, 2, details.Count)
+}
@@ -0,0 +1,129 @@
+//go:build e2e
+
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+)
+
+const (
+	// envUpCloudE2EPlan is the server plan of the node group that e2e tests create
+	envUpCloudE2EPlan string = "UPCLOUD_E2E_PLAN"
+	// e2eDefaultPlan is the smallest plan that UKS node groups can use
+	e2eDefaultPlan string = "1xCPU-2GB"
+)
+
+// TestE2E_NodeGroupLifecycle creates a disposable node group in real UKS cluster, scales it up and down using
+// the provider and deletes it. The node group is deleted even if the test fails.
+func TestE2E_NodeGroupLifecycle(t *testing.T) {
+	cfg, plan := e2eConfig(t)
+	svc, err := newUpCloudService(cfg)
+	require.NoError(t, err)
+	m, err := newManager(context.Background(), svc, cfg, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+
+	g, err := m.newAutoprovisionedNodeGroup(plan, map[string]string{"e2e": "true"}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		deleteE2ENodeGroup(t, m, g.name)
+	})
+
+	// template of a node group that doesn't exist yet is built from the plan
+	nodeInfo, err := g.TemplateNodeInfo()
+	require.NoError(t, err)
+	planDetails, err := m.plans.byName(plan)
+	require.NoError(t, err)
+	require.Equal(t, planDetails.cores, nodeInfo.Node().Status.Capacity.Cpu().Value())
+	require.Equal(t, plan, nodeInfo.Node().Labels[apiv1.LabelInstanceTypeStable])
+	require.Equal(t, "true", nodeInfo.Node().Labels["e2e"])
+
+	_, err = g.Create()
+	require.NoError(t, err)
+	require.True(t, g.Exist())
+	require.NoError(t, m.refresh())
+	g = liveNodeGroup(t, m, g.name)
+	require.Equal(t, autoprovisionedInitialSize, g.size)
+
+	require.NoError(t, g.IncreaseSize(1))
+	_, err = g.waitNodeGroupState(context.Background(), upcloud.KubernetesNodeGroupStateRunning, timeoutWaitNodeGroupState)
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	g = liveNodeGroup(t, m, g.name)
+	require.Equal(t, autoprovisionedInitialSize+1, g.size)
+	nodes, err := g.Nodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, autoprovisionedInitialSize+1)
+	for _, n := range nodes {
+		require.Equal(t, cloudprovider.InstanceRunning, n.Status.State, n.Id)
+	}
+
+	// nodes are deleted by provider ID, like the autoscaler does with Kubernetes nodes
+	node := newestNode(t, m, g.name)
+	require.NoError(t, g.DeleteNodes([]*apiv1.Node{node}))
+	require.NoError(t, m.refresh())
+	g = liveNodeGroup(t, m, g.name)
+	require.Equal(t, autoprovisionedInitialSize, g.size)
+	nodes, err = g.Nodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, autoprovisionedInitialSize)
+
+	require.NoError(t, g.Delete())
+}
+
+func e2eConfig(t *testing.T) (upCloudConfig, string) {
+	t.Helper()
+
+	cfg := liveConfig(t, "e2e")
+	if cfg.ClusterID == "" {
+		t.Skipf("e2e tests require %s to be set", envUpCloudClusterID)
+	}
+	plan := os.Getenv(envUpCloudE2EPlan)
+	if plan == "" {
+		plan = e2eDefaultPlan
+	}
+	return cfg, plan
+}
+
+// deleteE2ENodeGroup deletes the node group unless the test has already deleted it
+func deleteE2ENodeGroup(t *testing.T, m *manager, name string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutModifyNodeGroup)
+	defer cancel()
+	err := m.service().DeleteKubernetesNodeGroup(ctx, &request.DeleteKubernetesNodeGroupRequest{
+		ClusterUUID: m.clusterID.String(),
+		Name:        name,
+	})
+	switch {
+	case err == nil:
+		t.Logf("deleted node group %s", name)
+	case isNotFoundError(err):
+	default:
+		t.Errorf("failed to delete node group %s, delete it manually: %v", name, err)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	caerrors "k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+)
+
+// outOfResourcesErrorCodes are fragments of UpCloud API error codes of requests that fail because account quota
+// or zone capacity is exhausted, e.g. SERVER_CREATING_LIMIT_REACHED, INSUFFICIENT_CREDITS or RESOURCE_QUOTA_EXCEEDED.
+var outOfResourcesErrorCodes = []string{"LIMIT_REACHED", "LIMIT_EXCEEDED", "QUOTA", "INSUFFICIENT", "CAPACITY", "RESOURCES_EXHAUSTED"}
+
+// permissionErrorCodes are fragments of UpCloud API error codes of requests that API user is not allowed to make
+var permissionErrorCodes = []string{"PERMISSION", "FORBIDDEN", "UNAUTHORIZED", "AUTHENTICATION_FAILED"}
+
+// apiErrorInfo classifies UpCloud API error. Errors caused by exhausted quota or capacity are out of resources
+// errors, which CA handles by backing off the node group and trying other node groups.
+func apiErrorInfo(err error) cloudprovider.InstanceErrorInfo {
+	info := cloudprovider.InstanceErrorInfo{
+		ErrorClass:   cloudprovider.OtherErrorClass,
+		ErrorCode:    "UNKNOWN",
+		ErrorMessage: err.Error(),
+	}
+	var p *upcloud.Problem
+	if !errors.As(err, &p) {
+		return info
+	}
+	info.ErrorCode = p.ErrorCode()
+	if info.ErrorCode == "" {
+		info.ErrorCode = strconv.Itoa(p.Status)
+	}
+	if p.Status == http.StatusPaymentRequired || hasErrorCode(info.ErrorCode, outOfResourcesErrorCodes) {
+		info.ErrorClass = cloudprovider.OutOfResourcesErrorClass
+	}
+	return info
+}
+
+// apiError is an autoscaler error of failed UpCloud API request. Error type is used by CA as the reason of failed
+// scaling operation.
+type apiError struct {
+	errorType caerrors.AutoscalerErrorType
+	info      cloudprovider.InstanceErrorInfo
+	msg       string
+	err       error
+}
+
+// toAutoscalerError wraps error of UpCloud API request to autoscaler error, which type and message reflect the
+// cause of the error, e.g. exhausted quota or missing permissions
+func toAutoscalerError(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	e := &apiError{
+		errorType: caerrors.CloudProviderError,
+		info:      apiErrorInfo(err),
+		msg:       fmt.Sprintf(format, args...),
+		err:       err,
+	}
+	var p *upcloud.Problem
+	switch {
+	case e.info.ErrorClass == cloudprovider.OutOfResourcesErrorClass:
+		e.msg = fmt.Sprintf("%s, out of resources (%s)", e.msg, e.info.ErrorCode)
+	case errors.As(err, &p) && (p.Status == http.StatusUnauthorized || p.Status == http.StatusForbidden || hasErrorCode(e.info.ErrorCode, permissionErrorCodes)):
+		e.errorType = caerrors.ConfigurationError
+		e.msg = fmt.Sprintf("%s, permission denied (%s)", e.msg, e.info.ErrorCode)
+	case isTransientError(err, true) || errors.Is(err, context.DeadlineExceeded):
+		e.errorType = caerrors.TransientError
+	}
+	return e
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %v", e.msg, e.err)
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+// Type returns the type of autoscaler error
+func (e *apiError) Type() caerrors.AutoscalerErrorType {
+	return e.errorType
+}
+
+// AddPrefix adds a prefix to error message
+func (e *apiError) AddPrefix(msg string, args ...interface{}) caerrors.AutoscalerError {
+	e.msg = fmt.Sprintf(msg, args...) + e.msg
+	return e
+}
+
+func hasErrorCode(code string, fragments []string) bool {
+	code = strings.ToUpper(code)
+	for _, f := range fragments {
+		if strings.Contains(code, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeGroupErrorInfo returns error info of nodes that node group in failure state has failed to create, nil if
+// node group is not in failure state
+func nodeGroupErrorInfo(state upcloud.KubernetesNodeGroupState) *cloudprovider.InstanceErrorInfo {
+	if state != upcloud.KubernetesNodeGroupStateFailed {
+		return nil
+	}
+	return &cloudprovider.InstanceErrorInfo{
+		ErrorClass:   cloudprovider.OtherErrorClass,
+		ErrorCode:    "NODE_GROUP_" + strings.ToUpper(string(state)),
+		ErrorMessage: fmt.Sprintf("UKS node group is in %s state", state),
+	}
+}
+
+// nodeErrorInfo returns error info of node that is not pending, running or terminating, e.g. node that failed
+func nodeErrorInfo(state upcloud.KubernetesNodeState) *cloudprovider.InstanceErrorInfo {
+	return &cloudprovider.InstanceErrorInfo{
+		ErrorClass:   cloudprovider.OtherErrorClass,
+		ErrorCode:    string(state),
+		ErrorMessage: fmt.Sprintf("UKS node is in %s state", state),
+	}
+}
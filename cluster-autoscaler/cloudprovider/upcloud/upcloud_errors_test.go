@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	caerrors "k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+)
+
+func TestAPIErrorInfo(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		err   error
+		class cloudprovider.InstanceErrorClass
+		code  string
+	}{
+		{&upcloud.Problem{Type: "https://developers.upcloud.com/1.3/errors#ERROR_SERVER_CREATING_LIMIT_REACHED", Status: http.StatusConflict}, cloudprovider.OutOfResourcesErrorClass, "SERVER_CREATING_LIMIT_REACHED"},
+		{&upcloud.Problem{Type: "INSUFFICIENT_CREDITS", Status: http.StatusPaymentRequired}, cloudprovider.OutOfResourcesErrorClass, "INSUFFICIENT_CREDITS"},
+		{&upcloud.Problem{Status: http.StatusPaymentRequired}, cloudprovider.OutOfResourcesErrorClass, "402"},
+		{&upcloud.Problem{Type: "NODE_GROUP_NOT_FOUND", Status: http.StatusNotFound}, cloudprovider.OtherErrorClass, "NODE_GROUP_NOT_FOUND"},
+		{fmt.Errorf("connection refused"), cloudprovider.OtherErrorClass, "UNKNOWN"},
+	} {
+		info := apiErrorInfo(tc.err)
+		require.Equal(t, tc.class, info.ErrorClass, tc.err.Error())
+		require.Equal(t, tc.code, info.ErrorCode, tc.err.Error())
+	}
+}
+
+func TestToAutoscalerError(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, toAutoscalerError(nil, "failed"))
+	for _, tc := range []struct {
+		err error
+		typ caerrors.AutoscalerErrorType
+	}{
+		{&upcloud.Problem{Type: "RESOURCE_QUOTA_EXCEEDED", Status: http.StatusConflict}, caerrors.CloudProviderError},
+		{&upcloud.Problem{Type: "PERMISSION_DENIED", Status: http.StatusForbidden}, caerrors.ConfigurationError},
+		{&upcloud.Problem{Status: http.StatusTooManyRequests}, caerrors.TransientError},
+		{&upcloud.Problem{Status: http.StatusServiceUnavailable}, caerrors.TransientError},
+		{context.DeadlineExceeded, caerrors.TransientError},
+		{&upcloud.Problem{Status: http.StatusBadRequest}, caerrors.CloudProviderError},
+	} {
+		err := toAutoscalerError(tc.err, "failed to scale node group %s", "test")
+		aerr := caerrors.ToAutoscalerError(caerrors.InternalError, err)
+		require.Equal(t, tc.typ, aerr.Type(), tc.err.Error())
+		require.ErrorIs(t, err, tc.err)
+		require.Contains(t, err.Error(), "failed to scale node group test")
+	}
+	err := toAutoscalerError(&upcloud.Problem{Type: "RESOURCE_QUOTA_EXCEEDED", Status: http.StatusConflict}, "failed")
+	require.Contains(t, err.Error(), "out of resources (RESOURCE_QUOTA_EXCEEDED)")
+}
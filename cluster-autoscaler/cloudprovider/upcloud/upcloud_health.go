@@ -0,0 +1,215 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+	"k8s.io/klog/v2"
+)
+
+// healthMaxRefreshAge is the age of the last successful refresh after which the provider is degraded
+const healthMaxRefreshAge time.Duration = 5 * time.Minute
+
+// health tracks the last successful UpCloud API request, validity of API credentials and the last successful refresh.
+// The provider is degraded when API rejects the credentials or node groups haven't been refreshed within
+// healthMaxRefreshAge. Nil health is always healthy.
+type health struct {
+	mu      sync.Mutex
+	started time.Time
+	// lastRequest is the time of the last successful API request
+	lastRequest time.Time
+	// authErr is the error of the last request rejected because of invalid credentials, nil after successful request
+	authErr error
+	// lastRefresh is the time of the last successful refresh
+	lastRefresh time.Time
+	refreshErr  error
+	// degraded is the reported degraded state, which is used to log state changes once
+	degraded error
+}
+
+func newHealth() *health {
+	return &health{started: time.Now()}
+}
+
+// requestDone records completed API request
+func (h *health) requestDone(err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case err == nil:
+		h.lastRequest = time.Now()
+		h.authErr = nil
+		apiLastSuccessTimestamp.SetToCurrentTime()
+		apiAuthenticated.Set(1)
+	case isAuthenticationError(err):
+		h.authErr = err
+		apiAuthenticated.Set(0)
+	}
+	h.update()
+}
+
+// refreshDone records completed refresh
+func (h *health) refreshDone(err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.refreshErr = err
+	if err == nil {
+		h.lastRefresh = time.Now()
+		lastRefreshTimestamp.SetToCurrentTime()
+	}
+	h.update()
+}
+
+// check returns error that describes why the provider is degraded, nil if it's healthy
+func (h *health) check() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.update()
+	return h.degraded
+}
+
+// status returns degraded state of the provider. Caller must hold mu.
+func (h *health) status() error {
+	if h.authErr != nil {
+		return fmt.Errorf("UpCloud API credentials are not valid: %w", h.authErr)
+	}
+	last := h.lastRefresh
+	if last.IsZero() {
+		last = h.started
+	}
+	if age := time.Since(last); age > healthMaxRefreshAge {
+		if h.refreshErr != nil {
+			return fmt.Errorf("node groups have not been refreshed in %s: %w", age.Round(time.Second), h.refreshErr)
+		}
+		return fmt.Errorf("node groups have not been refreshed in %s", age.Round(time.Second))
+	}
+	return nil
+}
+
+// update updates degraded state and logs its changes. Caller must hold mu.
+func (h *health) update() {
+	err := h.status()
+	switch {
+	case err != nil && h.degraded == nil:
+		klog.Warningf("UpCloud cloud provider is degraded: %v", err)
+	case err == nil && h.degraded != nil:
+		klog.Infof("UpCloud cloud provider has recovered")
+	}
+	h.degraded = err
+	if err != nil {
+		providerHealthy.Set(0)
+	} else {
+		providerHealthy.Set(1)
+	}
+}
+
+// isAuthenticationError returns true if API rejected the request because of invalid credentials
+func isAuthenticationError(err error) bool {
+	var p *upcloud.Problem
+	return errors.As(err, &p) && (p.Status == http.StatusUnauthorized || hasErrorCode(p.ErrorCode(), []string{"AUTHENTICATION_FAILED"}))
+}
+
+// healthService records results of UpCloud API requests in health
+type healthService struct {
+	svc    upCloudService
+	health *health
+}
+
+func newHealthService(svc upCloudService, h *health) upCloudService {
+	if h == nil {
+		return svc
+	}
+	return &healthService{svc: svc, health: h}
+}
+
+func (s *healthService) GetKubernetesClusters(ctx context.Context, r *request.GetKubernetesClustersRequest) ([]upcloud.KubernetesCluster, error) {
+	clusters, err := s.svc.GetKubernetesClusters(ctx, r)
+	s.health.requestDone(err)
+	return clusters, err
+}
+
+func (s *healthService) GetKubernetesCluster(ctx context.Context, r *request.GetKubernetesClusterRequest) (*upcloud.KubernetesCluster, error) {
+	cluster, err := s.svc.GetKubernetesCluster(ctx, r)
+	s.health.requestDone(err)
+	return cluster, err
+}
+
+func (s *healthService) GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) ([]sdkext.KubernetesNodeGroup, error) {
+	groups, err := s.svc.GetKubernetesNodeGroups(ctx, r)
+	s.health.requestDone(err)
+	return groups, err
+}
+
+func (s *healthService) GetKubernetesNodeGroup(ctx context.Context, r *request.GetKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroupDetails, error) {
+	group, err := s.svc.GetKubernetesNodeGroup(ctx, r)
+	s.health.requestDone(err)
+	return group, err
+}
+
+func (s *healthService) CreateKubernetesNodeGroup(ctx context.Context, r *request.CreateKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error) {
+	group, err := s.svc.CreateKubernetesNodeGroup(ctx, r)
+	s.health.requestDone(err)
+	return group, err
+}
+
+func (s *healthService) ModifyKubernetesNodeGroup(ctx context.Context, r *request.ModifyKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error) {
+	group, err := s.svc.ModifyKubernetesNodeGroup(ctx, r)
+	s.health.requestDone(err)
+	return group, err
+}
+
+func (s *healthService) DeleteKubernetesNodeGroup(ctx context.Context, r *request.DeleteKubernetesNodeGroupRequest) error {
+	err := s.svc.DeleteKubernetesNodeGroup(ctx, r)
+	s.health.requestDone(err)
+	return err
+}
+
+func (s *healthService) DeleteKubernetesNodeGroupNode(ctx context.Context, r *request.DeleteKubernetesNodeGroupNodeRequest) error {
+	err := s.svc.DeleteKubernetesNodeGroupNode(ctx, r)
+	s.health.requestDone(err)
+	return err
+}
+
+func (s *healthService) GetKubernetesPlans(ctx context.Context, r *request.GetKubernetesPlansRequest) ([]upcloud.KubernetesPlan, error) {
+	plans, err := s.svc.GetKubernetesPlans(ctx, r)
+	s.health.requestDone(err)
+	return plans, err
+}
+
+func (s *healthService) GetPlans(ctx context.Context, r *sdkext.GetPlansRequest) ([]sdkext.Plan, error) {
+	plans, err := s.svc.GetPlans(ctx, r)
+	s.health.requestDone(err)
+	return plans, err
+}
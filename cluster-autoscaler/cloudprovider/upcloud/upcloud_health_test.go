@@ -0,0 +1,95 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/mocks"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+)
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+
+	h := newHealth()
+	require.NoError(t, h.check())
+
+	h.requestDone(&upcloud.Problem{Status: http.StatusUnauthorized})
+	require.ErrorContains(t, h.check(), "credentials are not valid")
+	// other errors don't tell whether credentials are valid
+	h.requestDone(&upcloud.Problem{Status: http.StatusInternalServerError})
+	require.ErrorContains(t, h.check(), "credentials are not valid")
+	h.requestDone(nil)
+	require.NoError(t, h.check())
+	require.False(t, h.lastRequest.IsZero())
+
+	h.refreshDone(nil)
+	require.NoError(t, h.check())
+	h.lastRefresh = time.Now().Add(-healthMaxRefreshAge - time.Second)
+	require.ErrorContains(t, h.check(), "node groups have not been refreshed")
+	h.refreshDone(fmt.Errorf("test"))
+	require.ErrorContains(t, h.check(), "test")
+	h.refreshDone(nil)
+	require.NoError(t, h.check())
+
+	// provider is degraded if it hasn't refreshed since it was started
+	h = newHealth()
+	h.started = time.Now().Add(-healthMaxRefreshAge - time.Second)
+	require.Error(t, h.check())
+
+	var disabled *health
+	disabled.requestDone(fmt.Errorf("test"))
+	disabled.refreshDone(fmt.Errorf("test"))
+	require.NoError(t, disabled.check())
+}
+
+func TestUpCloudCloudProvider_Healthz(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newMockService(clusterID)
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	p := &upCloudCloudProvider{manager: m}
+	require.NoError(t, p.Refresh())
+	require.NoError(t, p.Healthz())
+
+	svc.SetFaults(mocks.Faults{ErrorRate: 1, ErrorStatus: http.StatusUnauthorized})
+	require.Error(t, p.Refresh())
+	require.ErrorContains(t, p.Healthz(), "credentials are not valid")
+
+	svc.SetFaults(mocks.Faults{})
+	require.NoError(t, p.Refresh())
+	require.NoError(t, p.Healthz())
+}
+
+// unwrapHealthService returns service that manager has wrapped to track its health
+func unwrapHealthService(t *testing.T, svc upCloudService) upCloudService {
+	t.Helper()
+	s, ok := svc.(*healthService)
+	require.True(t, ok, "service is not health service")
+	return s.svc
+}
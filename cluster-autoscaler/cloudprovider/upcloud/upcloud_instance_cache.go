@@ -0,0 +1,107 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/klog/v2"
+)
+
+// instanceCache caches UUIDs of cluster nodes that exist in UpCloud. Cache is updated while holding updateMu,
+// but not mu, so that lookups from fresh cache are not blocked by the API requests of an update.
+type instanceCache struct {
+	mu        sync.Mutex
+	uuids     map[string]struct{}
+	fetchedAt time.Time
+	// updateMu serializes updates, so that concurrent lookups of a stale cache update it only once
+	updateMu sync.Mutex
+}
+
+// lookup returns whether node with the UUID is cached and whether the cache is fresh enough to
+// answer the lookup without updating it
+func (c *instanceCache) lookup(nodeUUID string) (found, fresh bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	age := time.Since(c.fetchedAt)
+	_, found = c.uuids[nodeUUID]
+	return found, age < instanceCacheTTL && (found || age < instanceCacheMinAge)
+}
+
+// hasInstance returns whether node with the UUID exists in any of the cluster node groups.
+// Cache is updated when it's older than instanceCacheTTL or when node is not found from cache
+// that is older than instanceCacheMinAge, so that newly created nodes are not reported missing.
+func (m *manager) hasInstance(nodeUUID string) (bool, error) {
+	if found, fresh := m.instances.lookup(nodeUUID); fresh {
+		return found, nil
+	}
+	m.instances.updateMu.Lock()
+	defer m.instances.updateMu.Unlock()
+	// cache may have been updated while waiting for the ongoing update
+	if found, fresh := m.instances.lookup(nodeUUID); fresh {
+		return found, nil
+	}
+	uuids, err := m.clusterNodeUUIDs()
+	if err != nil {
+		return true, err
+	}
+	m.instances.mu.Lock()
+	m.instances.uuids = uuids
+	m.instances.fetchedAt = time.Now()
+	m.instances.mu.Unlock()
+	_, found := uuids[nodeUUID]
+	return found, nil
+}
+
+// clusterNodeUUIDs fetches UUIDs of all cluster nodes
+func (m *manager) clusterNodeUUIDs() (map[string]struct{}, error) {
+	ctx, cancel := m.lifecycle.withTimeout(timeoutGetRequest)
+	defer cancel()
+	uuids, err := listClusterNodeUUIDs(ctx, m.service(), m.clusterID.String())
+	if err != nil {
+		return nil, err
+	}
+	klog.V(logInfo).InfoS("cached cluster instances", logKeyClusterID, m.clusterID.String(), "instances", len(uuids))
+	return uuids, nil
+}
+
+// listClusterNodeUUIDs fetches UUIDs of all nodes in the cluster node groups
+func listClusterNodeUUIDs(ctx context.Context, svc upCloudService, clusterID string) (map[string]struct{}, error) {
+	groups, err := svc.GetKubernetesNodeGroups(ctx, &request.GetKubernetesNodeGroupsRequest{
+		ClusterUUID: clusterID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	uuids := make(map[string]struct{})
+	for _, g := range groups {
+		ng, err := svc.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{
+			ClusterUUID: clusterID,
+			Name:        g.Name,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range ng.Nodes {
+			uuids[n.UUID] = struct{}{}
+		}
+	}
+	return uuids, nil
+}
@@ -0,0 +1,102 @@
+//go:build integration
+
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+)
+
+// envUpCloudTestNodeGroup is the name of existing node group that integration tests are allowed to scale
+const envUpCloudTestNodeGroup string = "UPCLOUD_TEST_NODE_GROUP"
+
+// TestIntegration_RefreshScaleUpScaleDown runs refresh, scale up and scale down cycle against real UKS cluster.
+// Test node group is restored to its original size even if the test fails.
+func TestIntegration_RefreshScaleUpScaleDown(t *testing.T) {
+	cfg, name := integrationConfig(t)
+	svc, err := newUpCloudService(cfg)
+	require.NoError(t, err)
+	m, err := newManager(context.Background(), svc, cfg, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, m.refresh())
+	g := liveNodeGroup(t, m, name)
+	originalSize := g.size
+	originalNodes := len(g.nodes)
+	require.Less(t, originalSize, g.MaxSize(), "test node group is already at max size")
+	t.Cleanup(func() {
+		restoreNodeGroupSize(t, m, name, originalSize)
+	})
+
+	require.NoError(t, g.IncreaseSize(1))
+	_, err = g.waitNodeGroupState(context.Background(), upcloud.KubernetesNodeGroupStateRunning, timeoutWaitNodeGroupState)
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	g = liveNodeGroup(t, m, name)
+	require.Equal(t, originalSize+1, g.size)
+	require.Len(t, g.nodes, originalNodes+1)
+
+	node := newestNode(t, m, name)
+	require.NoError(t, g.DeleteNodes([]*apiv1.Node{node}))
+	require.NoError(t, m.refresh())
+	g = liveNodeGroup(t, m, name)
+	require.Equal(t, originalSize, g.size)
+	require.Len(t, g.nodes, originalNodes)
+}
+
+func integrationConfig(t *testing.T) (upCloudConfig, string) {
+	t.Helper()
+
+	name := os.Getenv(envUpCloudTestNodeGroup)
+	if name == "" {
+		t.Skipf("integration tests require %s to be set", envUpCloudTestNodeGroup)
+	}
+	return liveConfig(t, "integration"), name
+}
+
+func restoreNodeGroupSize(t *testing.T, m *manager, name string, size int) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutModifyNodeGroup)
+	defer cancel()
+	g, err := m.service().GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{
+		ClusterUUID: m.clusterID.String(),
+		Name:        name,
+	})
+	if err != nil {
+		t.Errorf("failed to get node group %s, restore size %d manually: %v", name, size, err)
+		return
+	}
+	if g.Count == size {
+		return
+	}
+	t.Logf("restoring node group %s size from %d to %d", name, g.Count, size)
+	group := &upCloudNodeGroup{clusterID: m.clusterID, name: name, size: g.Count, svc: m.svc}
+	if err := group.scaleNodeGroup(size); err != nil {
+		t.Errorf("failed to restore node group %s size %d: %v", name, size, err)
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"time"
+)
+
+// lifecycle is cancelled when the cloud provider is cleaned up, so that API requests and polling loops of in-flight
+// operations abort instead of blocking the autoscaler shutdown. Nil lifecycle is never cancelled.
+type lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel}
+}
+
+// context returns context that is cancelled on stop
+func (l *lifecycle) context() context.Context {
+	if l == nil {
+		return context.Background()
+	}
+	return l.ctx
+}
+
+// withTimeout returns context that is cancelled on stop or after the timeout
+func (l *lifecycle) withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(l.context(), timeout)
+}
+
+// stop cancels contexts of in-flight operations
+func (l *lifecycle) stop() {
+	if l != nil {
+		l.cancel()
+	}
+}
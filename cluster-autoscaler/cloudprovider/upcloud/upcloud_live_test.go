@@ -0,0 +1,81 @@
+//go:build integration || e2e
+
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+)
+
+// liveConfig returns configuration of tests that use real UKS cluster, or skips the test if UpCloud isn't configured.
+// Kind is the kind of the tests, e.g. integration, which is used in the user agent and skip messages.
+func liveConfig(t *testing.T, kind string) upCloudConfig {
+	t.Helper()
+
+	cfg, err := cloudConfigFromEnv(config.AutoscalingOptions{UserAgent: "cluster-autoscaler-" + kind + "-test"})
+	if err != nil {
+		t.Skipf("%s tests require UpCloud configuration: %v", kind, err)
+	}
+	return cfg
+}
+
+// liveNodeGroup returns refreshed node group of the manager
+func liveNodeGroup(t *testing.T, m *manager, name string) *upCloudNodeGroup {
+	t.Helper()
+
+	for _, g := range m.getNodeGroups() {
+		if g.name == name {
+			return g
+		}
+	}
+	require.FailNowf(t, "node group not found", "node group %s not found from cluster %s", name, m.clusterID.String())
+	return nil
+}
+
+// newestNode returns Kubernetes node object of the node that was added last to the node group, i.e. the pending
+// node or the last node if none of the nodes is pending
+func newestNode(t *testing.T, m *manager, name string) *apiv1.Node {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutGetRequest)
+	defer cancel()
+	details, err := m.service().GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{
+		ClusterUUID: m.clusterID.String(),
+		Name:        name,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, details.Nodes)
+	n := details.Nodes[len(details.Nodes)-1]
+	for _, node := range details.Nodes {
+		if node.State == upcloud.KubernetesNodeStatePending {
+			n = node
+		}
+	}
+	return &apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: n.Name},
+		Spec:       apiv1.NodeSpec{ProviderID: providerIDPrefix + n.UUID},
+	}
+}
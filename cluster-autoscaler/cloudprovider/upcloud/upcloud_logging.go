@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"slices"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Structured log keys used to filter and correlate log messages of scaling operations
+const (
+	logKeyClusterID string = "cluster_id"
+	logKeyNodeGroup string = "node_group"
+	logKeyOperation string = "operation"
+	logKeyDuration  string = "duration"
+)
+
+// operationLogLevels is the log level policy of cloud provider and node group operations. Operations that change
+// the cluster are logged at info level. Other operations are called a lot and are logged at debug level.
+var operationLogLevels = map[string]klog.Level{
+	"CloudProvider.Cleanup":        logInfo,
+	"NodeGroup.IncreaseSize":       logInfo,
+	"NodeGroup.AtomicIncreaseSize": logInfo,
+	"NodeGroup.DecreaseTargetSize": logInfo,
+	"NodeGroup.DeleteNodes":        logInfo,
+	"NodeGroup.ForceDeleteNodes":   logInfo,
+	"NodeGroup.Create":             logInfo,
+	"NodeGroup.Delete":             logInfo,
+}
+
+func operationLogLevel(operation string) klog.Level {
+	if level, ok := operationLogLevels[operation]; ok {
+		return level
+	}
+	return logDebug
+}
+
+// operationLog logs call and completion of an operation
+type operationLog struct {
+	level  klog.Level
+	values []any
+	start  time.Time
+}
+
+// logOperation logs call of the operation and returns log used to log its completion
+func logOperation(operation string, keysAndValues ...any) *operationLog {
+	l := &operationLog{
+		level:  operationLogLevel(operation),
+		values: append([]any{logKeyOperation, operation}, keysAndValues...),
+		start:  time.Now(),
+	}
+	klog.V(l.level).InfoS("UpCloud operation called", l.values...)
+	return l
+}
+
+// done logs completion of the operation and its duration. Err points to the error returned by the operation, so that
+// done can be deferred.
+func (l *operationLog) done(err *error) {
+	values := slices.Concat(l.values, []any{logKeyDuration, time.Since(l.start)})
+	if err != nil && *err != nil {
+		klog.ErrorS(*err, "UpCloud operation failed", values...)
+		return
+	}
+	klog.V(l.level).InfoS("UpCloud operation completed", values...)
+}
+
+// logValues returns structured log key-value pairs of the node group followed by keysAndValues
+func (u *upCloudNodeGroup) logValues(keysAndValues ...any) []any {
+	return append([]any{logKeyClusterID, u.clusterID.String(), logKeyNodeGroup, u.name}, keysAndValues...)
+}
+
+// logOperation logs call of the node group operation
+func (u *upCloudNodeGroup) logOperation(operation string, keysAndValues ...any) *operationLog {
+	return logOperation("NodeGroup."+operation, u.logValues(keysAndValues...)...)
+}
+
+// logOperation logs call of the cloud provider operation
+func (u *upCloudCloudProvider) logOperation(operation string) *operationLog {
+	if u.manager == nil {
+		return logOperation("CloudProvider." + operation)
+	}
+	return logOperation("CloudProvider."+operation, logKeyClusterID, u.manager.clusterID.String())
+}
@@ -21,6 +21,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"path"
+	"regexp"
 	"strings"
 	"sync"
 
@@ -28,37 +30,110 @@ import (
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/autoscaler/cluster-autoscaler/config/dynamic"
+	"k8s.io/component-base/tracing"
 	"k8s.io/klog/v2"
 )
 
+// providerIDPrefix is the prefix of UpCloud node provider IDs, which are followed by node UUID
+const providerIDPrefix string = "upcloud:////"
+
+// placeholderIDPrefix is the prefix of instances that are requested, but not yet listed in node group details
+const placeholderIDPrefix string = "upcloud-placeholder://"
+
+// upCloudService is the subset of the vendored UpCloud SDK service used by the provider.
+// SDK upgrades only need to keep this interface satisfied, the rest of the provider doesn't call the SDK client directly.
 type upCloudService interface {
+	GetKubernetesClusters(ctx context.Context, r *request.GetKubernetesClustersRequest) ([]upcloud.KubernetesCluster, error)
 	GetKubernetesCluster(ctx context.Context, r *request.GetKubernetesClusterRequest) (*upcloud.KubernetesCluster, error)
-	GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) ([]upcloud.KubernetesNodeGroup, error)
+	GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) ([]sdkext.KubernetesNodeGroup, error)
 	GetKubernetesNodeGroup(ctx context.Context, r *request.GetKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroupDetails, error)
+	CreateKubernetesNodeGroup(ctx context.Context, r *request.CreateKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error)
 	ModifyKubernetesNodeGroup(ctx context.Context, r *request.ModifyKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error)
+	DeleteKubernetesNodeGroup(ctx context.Context, r *request.DeleteKubernetesNodeGroupRequest) error
 	DeleteKubernetesNodeGroupNode(ctx context.Context, r *request.DeleteKubernetesNodeGroupNodeRequest) error
 	GetKubernetesPlans(ctx context.Context, r *request.GetKubernetesPlansRequest) ([]upcloud.KubernetesPlan, error)
+	GetPlans(ctx context.Context, r *sdkext.GetPlansRequest) ([]sdkext.Plan, error)
 }
 
 // manager manages node group cache
 type manager struct {
-	clusterID      uuid.UUID
+	clusterID uuid.UUID
+	// zone is the UpCloud zone of the cluster
+	zone           string
 	svc            upCloudService
-	nodeGroups     []*upCloudNodeGroup
 	nodeGroupSpecs map[string]dynamic.NodeGroupSpec
+	// discovery selects managed node groups by labels, all node groups are managed when it's empty
+	discovery []labelSelector
 
 	maxNodesTotal int
+	// sizeDefaults overrides size limits of node groups that specs and labels don't set, nil uses built-in defaults
+	sizeDefaults *nodeGroupSizeDefaults
+	// antiAffinityMaxNodes caps size of anti-affinity node groups, zero doesn't cap the size
+	antiAffinityMaxNodes int
+	// nodeGroupDefaults are autoscaling options that node group labels override
+	nodeGroupDefaults config.NodeGroupAutoscalingOptions
+	hooks             scaleHooks
+	// credentials is set when credentials are loaded from files
+	credentials *credentialFiles
+	instances   instanceCache
+	// details caches node group details between refreshes, nil when caching is disabled
+	details *nodeGroupCache
+	// schedule decides when node groups are listed, nil when every refresh lists node groups
+	schedule *refreshSchedule
+	// lifecycle is cancelled on cleanup
+	lifecycle *lifecycle
+	// opLocks serialize size changing operations of node groups across refreshes
+	opLocks *nodeGroupLocks
+	// pending tracks requested node group sizes until the API lists them
+	pending *pendingSizes
+	// plans caches server plans of node groups
+	plans *planCache
+	// watch shares node group details fetched by state waits with refresh
+	watch *nodeGroupWatch
+	// failures tracks recent failed scaling operations of node groups
+	failures *scaleFailures
+	// pendingNodes tracks how long nodes have been pending
+	pendingNodes *pendingNodes
+	// health tracks API requests and refreshes of the manager
+	health *health
+	// metrics updates node group gauges on refresh
+	metrics *nodeGroupMetrics
+	// tracerProvider exports spans of API requests, nil when tracing is disabled
+	tracerProvider tracing.TracerProvider
+	// templates overrides node group templates, nil when template overrides ConfigMap is not set
+	templates *templateOverrides
+	// systemPods are added to node group templates, nil when system pods are disabled
+	systemPods []systemPod
+
+	// mu guards nodeGroups, which is replaced as a whole on refresh, and svc, which
+	// is replaced when credentials change. svc is only replaced while holding refreshMu.
+	mu         sync.RWMutex
+	nodeGroups []*upCloudNodeGroup
+	// refreshMu serializes refreshes
+	refreshMu sync.Mutex
+}
 
-	mu sync.Mutex
+// getNodeGroups returns snapshot of cached node groups
+func (m *manager) getNodeGroups() []*upCloudNodeGroup {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*upCloudNodeGroup(nil), m.nodeGroups...)
 }
 
-// refresh updates manager's node group cache
+// refresh updates manager's node group cache. Node groups are listed when refresh interval has passed, otherwise
+// only node groups with in-flight operations are updated.
 func (m *manager) refresh() error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutGetRequest)
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+	// node groups are rebuilt when credentials change, so that they use the new service
+	if !m.reloadCredentials() && !m.schedule.full() {
+		m.refreshInFlight()
+		return nil
+	}
+	ctx, cancel := m.lifecycle.withTimeout(timeoutGetRequest)
 	defer cancel()
 	groups := make([]*upCloudNodeGroup, 0)
 	upcloudNodeGroups, err := m.svc.GetKubernetesNodeGroups(ctx, &request.GetKubernetesNodeGroupsRequest{
@@ -67,42 +142,188 @@ func (m *manager) refresh() error {
 	if err != nil {
 		return err
 	}
+	m.details.retain(upcloudNodeGroups)
+	m.pendingNodes.retain(upcloudNodeGroups)
+	if err := m.templates.load(ctx); err != nil {
+		klog.ErrorS(err, "failed to reload template overrides, using previous overrides")
+	}
 	for _, g := range upcloudNodeGroups {
-		nodes, err := nodeGroupNodes(m.svc, m.clusterID, g.Name)
+		labels := nodeGroupLabels(g.Labels)
+		// opted out node groups are never scaled or deleted, including autoprovisioned node groups
+		if optedOut(g.Name, labels) {
+			klog.V(logInfo).InfoS("skipping node group opted out of autoscaling", logKeyClusterID, m.clusterID.String(), logKeyNodeGroup, g.Name)
+			continue
+		}
+		autoprovisioned := isAutoprovisioned(labels)
+		if autoprovisioned && g.Count == 0 && g.State == upcloud.KubernetesNodeGroupStateRunning {
+			m.deleteEmptyNodeGroup(g.Name)
+			continue
+		}
+		// autoprovisioned node groups are managed regardless of the auto-discovery specs, because the autoscaler created them
+		if !autoprovisioned && !discovered(m.discovery, labels) {
+			klog.V(logInfo).InfoS("skipping node group not matching auto-discovery specs", logKeyClusterID, m.clusterID.String(), logKeyNodeGroup, g.Name)
+			continue
+		}
+		nodes, err := nodeGroupNodes(m.lifecycle.context(), m.svc, m.details, m.clusterID, g)
 		if err != nil {
-			klog.ErrorS(err, "failed to get node group nodes")
+			klog.ErrorS(err, "failed to get node group nodes", logKeyClusterID, m.clusterID.String(), logKeyNodeGroup, g.Name)
 			continue
 		}
+		opts := nodeGroupOptions(g.Name, labels, m.nodeGroupDefaults)
+		nodes = m.pendingNodes.observe(g.Name, nodes, opts.MaxNodeProvisionTime)
+		size := m.pending.merge(g.Name, g.Count)
+		defaultMin, defaultMax := m.sizeDefaults.limits(m.maxNodesTotal)
 		group := upCloudNodeGroup{
-			clusterID: m.clusterID,
-			name:      g.Name,
-			size:      g.Count,
-			minSize:   nodeGroupMinSize,
-			maxSize:   m.maxNodesTotal,
-			svc:       m.svc,
-			nodes:     nodes,
-			mu:        sync.Mutex{},
-		}
-		if spec, ok := m.nodeGroupSpecs[group.name]; ok && spec.Name == group.name {
+			clusterID:   m.clusterID,
+			name:        g.Name,
+			size:        size,
+			minSize:     defaultMin,
+			maxSize:     defaultMax,
+			labels:      labels,
+			plan:        g.Plan,
+			customPlan:  g.CustomPlan,
+			zone:        m.zone,
+			taints:      nodeGroupTaints(g.Taints),
+			kubeletArgs: nodeGroupKubeletArgs(g.KubeletArgs),
+			svc:         m.svc,
+			hooks:       m.hooks,
+			details:     m.details,
+			schedule:    m.schedule,
+			lifecycle:   m.lifecycle,
+			opLocks:     m.opLocks,
+			pending:     m.pending,
+			failures:    m.failures,
+			plans:       m.plans,
+			watch:       m.watch,
+			templates:   m.templates,
+			systemPods:  m.systemPods,
+			nodes:       withPlaceholders(g.Name, nodes, size, m.failures.errorInfo(g.Name, g.State)),
+		}
+		group.maxNodeProvisionTime = opts.MaxNodeProvisionTime
+		group.zeroOrMaxNodeScaling = opts.ZeroOrMaxNodeScaling
+		group.minSize, group.maxSize = nodeGroupSizeLimits(g.Name, labels, group.minSize, group.maxSize, m.maxNodesTotal)
+		group.limitSource = limitSourceDefault
+		if group.minSize != defaultMin || group.maxSize != defaultMax {
+			group.limitSource = limitSourceLabel
+		}
+		if autoprovisioned {
+			group.autoprovisioned = true
+			group.minSize = 0
+		}
+		// zero-or-max node groups are scaled down to zero nodes
+		if group.zeroOrMaxNodeScaling {
+			group.minSize = 0
+		}
+		if spec, ok := MatchNodeGroupSpec(m.nodeGroupSpecs, group.name); ok {
 			group.minSize = spec.MinSize
 			group.maxSize = spec.MaxSize
+			group.limitSource = limitSourceSpec
+		} else if group.minSize == defaultMin && group.maxSize == defaultMax && (g.Count < group.minSize || g.Count > group.maxSize) {
+			klog.Warningf("node group %s size %d is outside default size limits min=%d max=%d, set limits using --nodes or node group labels",
+				g.Name, g.Count, group.minSize, group.maxSize)
+		}
+		if g.AntiAffinity {
+			group.antiAffinityMaxNodes = m.antiAffinityMaxNodes
+			if minSize, maxSize := antiAffinitySizeLimits(group.minSize, group.maxSize, group.antiAffinityMaxNodes); minSize != group.minSize || maxSize != group.maxSize {
+				klog.V(logInfo).InfoS("capping anti-affinity node group size limits to the number of hosts",
+					group.logValues("maxSize", group.maxSize, "antiAffinityMaxNodes", group.antiAffinityMaxNodes)...)
+				group.minSize, group.maxSize = minSize, maxSize
+				group.limitSource = limitSourceAntiAffinity
+			}
+			group.nodes = antiAffinityPlaceholders(g.Name, group.nodes, group.antiAffinityMaxNodes)
 		}
-		klog.V(logInfo).Infof("caching cluster %s node group %s size=%d minSize=%d maxSize=%d nodes=%d",
-			m.clusterID.String(), group.name, group.size, group.minSize, group.maxSize, len(nodes))
+		klog.V(logInfo).InfoS("caching node group",
+			group.logValues("size", group.size, "minSize", group.minSize, "maxSize", group.maxSize, "nodes", len(nodes))...)
 		groups = append(groups, &group)
 	}
+	m.mu.Lock()
 	m.nodeGroups = groups
-	klog.V(logInfo).Infof("refreshed node groups (%d)", len(m.nodeGroups))
+	m.mu.Unlock()
+	m.schedule.done()
+	klog.V(logInfo).InfoS("refreshed node groups", logKeyClusterID, m.clusterID.String(), "nodeGroups", len(groups))
 	return nil
 }
 
+// refreshInFlight updates size and nodes of node groups that have in-flight operations, i.e. nodes that are not
+// running yet or are being deleted
+func (m *manager) refreshInFlight() {
+	updated := 0
+	for _, g := range m.getNodeGroups() {
+		if !g.inFlight() {
+			continue
+		}
+		details, ok := m.watch.get(g.name)
+		if ok {
+			klog.V(logDebug).InfoS("using node group details of in-flight state wait", g.logValues()...)
+		} else {
+			var err error
+			if details, err = g.nodeGroupDetails(); err != nil {
+				// node group may have been deleted, list node groups on next refresh
+				klog.ErrorS(err, "failed to refresh node group", g.logValues()...)
+				m.schedule.reset()
+				continue
+			}
+			m.details.set(details)
+		}
+		size := m.pending.merge(g.name, details.Count)
+		g.mu.Lock()
+		g.size = size
+		nodes := m.pendingNodes.observe(g.name, detailsInstances(details), g.maxNodeProvisionTime)
+		g.nodes = antiAffinityPlaceholders(g.name, withPlaceholders(g.name, nodes, size, m.failures.errorInfo(g.name, details.State)), g.antiAffinityMaxNodes)
+		g.mu.Unlock()
+		updated++
+	}
+	klog.V(logInfo).InfoS("refreshed node groups with in-flight operations", logKeyClusterID, m.clusterID.String(), "nodeGroups", updated)
+}
+
+// deleteEmptyNodeGroup deletes autoprovisioned node group that has been scaled down to zero nodes
+func (m *manager) deleteEmptyNodeGroup(name string) {
+	g := upCloudNodeGroup{clusterID: m.clusterID, name: name, svc: m.svc, details: m.details, lifecycle: m.lifecycle}
+	if err := g.delete(); err != nil {
+		klog.ErrorS(err, "failed to delete empty autoprovisioned node group", g.logValues()...)
+		return
+	}
+	klog.InfoS("deleted empty autoprovisioned node group", g.logValues()...)
+}
+
+// reloadCredentials replaces service if credential files have changed. Caller must hold refreshMu.
+func (m *manager) reloadCredentials() bool {
+	if m.credentials == nil {
+		return false
+	}
+	svc, changed, err := m.credentials.reload()
+	if err != nil {
+		klog.ErrorS(err, "failed to reload UpCloud API credentials, using previous credentials")
+		return false
+	}
+	if changed {
+		m.mu.Lock()
+		m.svc = newHealthService(svc, m.health)
+		m.mu.Unlock()
+	}
+	return changed
+}
+
+// service returns current UpCloud service
+func (m *manager) service() upCloudService {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.svc
+}
+
 func newManager(ctx context.Context, svc upCloudService, cfg upCloudConfig, opts config.AutoscalingOptions, do cloudprovider.NodeGroupDiscoveryOptions) (*manager, error) {
 	clusterUUID, err := uuid.Parse(cfg.ClusterID)
 	if err != nil {
 		return nil, fmt.Errorf("cluster ID %s is not valid UUID %w", envUpCloudClusterID, err)
 	}
+	h := newHealth()
+	svc = newHealthService(svc, h)
 
-	maxNodesTotal, err := clusterMaxNodes(ctx, svc, clusterUUID, opts.MaxNodesTotal)
+	cluster, err := getCluster(ctx, svc, clusterUUID)
+	if err != nil {
+		return nil, err
+	}
+	maxNodesTotal, err := clusterMaxNodes(ctx, svc, cluster, opts.MaxNodesTotal)
 	if err != nil {
 		return nil, err
 	}
@@ -110,15 +331,48 @@ func newManager(ctx context.Context, svc upCloudService, cfg upCloudConfig, opts
 	if err != nil {
 		return nil, err
 	}
+	if defaultMin, defaultMax := cfg.NodeGroupSizeDefaults.limits(maxNodesTotal); defaultMax > maxNodesTotal || defaultMin > defaultMax {
+		return nil, fmt.Errorf("failed to validate default node group size limits min=%d max=%d, limits should be between 0 and cluster plan maximum %d",
+			defaultMin, defaultMax, maxNodesTotal)
+	}
+	discovery, err := parseAutoDiscoverySpecs(do.NodeGroupAutoDiscoverySpecs)
+	if err != nil {
+		return nil, err
+	}
+	var systemPods []systemPod
+	if cfg.TemplateSystemPods {
+		systemPods = uksSystemPods
+	}
 
-	return &manager{
-		clusterID:      clusterUUID,
-		maxNodesTotal:  maxNodesTotal,
-		svc:            svc,
-		nodeGroups:     make([]*upCloudNodeGroup, 0),
-		nodeGroupSpecs: nodeGroupSpecs,
-		mu:             sync.Mutex{},
-	}, nil
+	m := &manager{
+		clusterID:            clusterUUID,
+		zone:                 cluster.Zone,
+		maxNodesTotal:        maxNodesTotal,
+		sizeDefaults:         cfg.NodeGroupSizeDefaults,
+		antiAffinityMaxNodes: cfg.AntiAffinityMaxNodes,
+		svc:                  svc,
+		nodeGroups:           make([]*upCloudNodeGroup, 0),
+		nodeGroupSpecs:       nodeGroupSpecs,
+		discovery:            discovery,
+		nodeGroupDefaults:    opts.NodeGroupDefaults,
+		hooks:                newScaleHooks(),
+		details:              newNodeGroupCache(cfg.NodeGroupCacheTTL),
+		schedule:             newRefreshSchedule(cfg.RefreshInterval),
+		lifecycle:            newLifecycle(),
+		opLocks:              newNodeGroupLocks(),
+		pending:              newPendingSizes(),
+		failures:             newScaleFailures(),
+		plans:                newPlanCache(planCacheRefreshInterval),
+		watch:                newNodeGroupWatch(nodeGroupWatchMaxAge),
+		pendingNodes:         newPendingNodes(),
+		health:               h,
+		metrics:              newNodeGroupMetrics(),
+		systemPods:           systemPods,
+	}
+	if err := m.plans.load(ctx, svc); err != nil {
+		klog.ErrorS(err, "failed to load UpCloud server plans, resources of node group plans are parsed from plan names")
+	}
+	return m, nil
 }
 
 func nodeGroupSpecsFromDiscoveryOptions(do *cloudprovider.NodeGroupDiscoveryOptions, supportScaleToZero bool, maxNodesTotal int) (map[string]dynamic.NodeGroupSpec, error) {
@@ -134,28 +388,75 @@ func nodeGroupSpecsFromDiscoveryOptions(do *cloudprovider.NodeGroupDiscoveryOpti
 		if s.MaxSize > maxNodesTotal {
 			return specs, fmt.Errorf("failed to validate node group spec, max size %d is greater than cluster plan maximum %d`", s.MaxSize, maxNodesTotal)
 		}
+		if _, err := nodeGroupSpecPattern(s.Name); err != nil {
+			return specs, fmt.Errorf("failed to parse node group spec %s name pattern: %v", spec, err)
+		}
 		specs[s.Name] = *s
 	}
 	return specs, nil
 }
 
-func clusterMaxNodes(ctx context.Context, svc upCloudService, clusterID uuid.UUID, requestedMaxNodesTotal int) (int, error) {
+// nodeGroupSpecPattern returns matcher of node group spec name, or nil if the name matches only the node group with
+// the same name. Names in format /<regexp>/ are regular expressions that match the whole node group name, and names
+// containing *, ? or [ are shell patterns.
+func nodeGroupSpecPattern(name string) (func(string) bool, error) {
+	if len(name) > 2 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/") {
+		re, err := regexp.Compile("^(?:" + name[1:len(name)-1] + ")$")
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	if strings.ContainsAny(name, "*?[") {
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, err
+		}
+		return func(s string) bool {
+			ok, _ := path.Match(name, s)
+			return ok
+		}, nil
+	}
+	return nil, nil
+}
+
+// MatchNodeGroupSpec returns spec of the node group from specs keyed by spec name. Spec with the node group name takes
+// precedence over patterns, and from the matching patterns the longest one is used.
+func MatchNodeGroupSpec(specs map[string]dynamic.NodeGroupSpec, name string) (dynamic.NodeGroupSpec, bool) {
+	if spec, ok := specs[name]; ok && spec.Name == name {
+		return spec, true
+	}
+	var match dynamic.NodeGroupSpec
+	found := false
+	for pattern, spec := range specs {
+		matches, err := nodeGroupSpecPattern(pattern)
+		if err != nil || matches == nil || !matches(name) {
+			continue
+		}
+		if !found || len(pattern) > len(match.Name) || (len(pattern) == len(match.Name) && pattern < match.Name) {
+			match, found = spec, true
+		}
+	}
+	return match, found
+}
+
+func getCluster(ctx context.Context, svc upCloudService, clusterID uuid.UUID) (*upcloud.KubernetesCluster, error) {
 	cluster, err := svc.GetKubernetesCluster(ctx, &request.GetKubernetesClusterRequest{
 		UUID: clusterID.String(),
 	})
 	if err != nil {
 		var p *upcloud.Problem
-		if !errors.As(err, &p) {
-			return requestedMaxNodesTotal, err
+		if errors.As(err, &p) && p.Status == http.StatusForbidden {
+			return nil, fmt.Errorf("unable to get cluster %s info, permission denied", clusterID.String())
 		}
-		if p.Status == http.StatusForbidden {
-			return requestedMaxNodesTotal, fmt.Errorf("unable to get cluster %s info, permission denied", clusterID.String())
-		}
-		if p.Status == http.StatusNotFound {
-			return requestedMaxNodesTotal, fmt.Errorf("cluster %s not found", clusterID.String())
+		if errors.As(err, &p) && p.Status == http.StatusNotFound {
+			return nil, fmt.Errorf("cluster %s not found", clusterID.String())
 		}
+		return nil, err
 	}
+	return cluster, nil
+}
 
+func clusterMaxNodes(ctx context.Context, svc upCloudService, cluster *upcloud.KubernetesCluster, requestedMaxNodesTotal int) (int, error) {
 	plan, err := clusterPlanByName(ctx, svc, cluster.Plan)
 	if err != nil {
 		return requestedMaxNodesTotal, err
@@ -183,26 +484,63 @@ func clusterPlanByName(ctx context.Context, svc upCloudService, name string) (up
 	return upcloud.KubernetesPlan{}, fmt.Errorf("can't get cluster plan by name '%s'", name)
 }
 
-func nodeGroupNodes(svc upCloudService, clusterID uuid.UUID, name string) ([]cloudprovider.Instance, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutGetRequest)
-	defer cancel()
+// nodeGroupNodes returns instances of the listed node group using cached node group details when possible
+func nodeGroupNodes(ctx context.Context, svc upCloudService, cache *nodeGroupCache, clusterID uuid.UUID, g sdkext.KubernetesNodeGroup) ([]cloudprovider.Instance, error) {
 	instances := make([]cloudprovider.Instance, 0)
-	klog.V(logInfo).Infof("fetching node group %s/%s details", clusterID.String(), name)
-	ng, err := svc.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{
-		ClusterUUID: clusterID.String(),
-		Name:        name,
-	})
-	if err != nil {
-		return instances, err
+	ng, ok := cache.get(g)
+	if ok {
+		klog.V(logDebug).InfoS("using cached node group details", logKeyClusterID, clusterID.String(), logKeyNodeGroup, g.Name)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, timeoutGetRequest)
+		defer cancel()
+		klog.V(logInfo).InfoS("fetching node group details", logKeyClusterID, clusterID.String(), logKeyNodeGroup, g.Name)
+		var err error
+		ng, err = svc.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{
+			ClusterUUID: clusterID.String(),
+			Name:        g.Name,
+		})
+		if err != nil {
+			return instances, err
+		}
+		cache.set(ng)
 	}
+	return detailsInstances(ng), nil
+}
+
+// detailsInstances returns instances of the node group nodes
+func detailsInstances(ng *upcloud.KubernetesNodeGroupDetails) []cloudprovider.Instance {
+	instances := make([]cloudprovider.Instance, 0, len(ng.Nodes))
 	for i := range ng.Nodes {
 		node := ng.Nodes[i]
 		instances = append(instances, cloudprovider.Instance{
-			Id:     fmt.Sprintf("upcloud:////%s", node.UUID),
+			Id:     providerIDPrefix + node.UUID,
 			Status: nodeStateToInstanceStatus(node.State),
 		})
 	}
-	return instances, err
+	return instances
+}
+
+// withPlaceholders returns nodes with placeholder instances for nodes that are missing from requested size.
+// Placeholders have the error info when node group has failed to create the missing nodes.
+func withPlaceholders(name string, nodes []cloudprovider.Instance, size int, errorInfo *cloudprovider.InstanceErrorInfo) []cloudprovider.Instance {
+	n := make([]cloudprovider.Instance, 0, max(size, len(nodes)))
+	for _, i := range nodes {
+		if !strings.HasPrefix(i.Id, placeholderIDPrefix) {
+			n = append(n, i)
+		}
+	}
+	for i := len(n); i < size; i++ {
+		n = append(n, cloudprovider.Instance{
+			Id:     fmt.Sprintf("%s%s/%d", placeholderIDPrefix, name, i),
+			Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceCreating, ErrorInfo: errorInfo},
+		})
+	}
+	return n
+}
+
+// isPlaceholder returns true if instance ID is ID of the node group's placeholder instance
+func isPlaceholder(name, id string) bool {
+	return strings.HasPrefix(id, placeholderIDPrefix+name+"/")
 }
 
 func nodeStateToInstanceStatus(nodeState upcloud.KubernetesNodeState) *cloudprovider.InstanceStatus {
@@ -216,10 +554,7 @@ func nodeStateToInstanceStatus(nodeState upcloud.KubernetesNodeState) *cloudprov
 	case upcloud.KubernetesNodeStatePending:
 		s = cloudprovider.InstanceCreating
 	default:
-		e = &cloudprovider.InstanceErrorInfo{
-			ErrorClass: cloudprovider.OtherErrorClass,
-			ErrorCode:  string(nodeState),
-		}
+		e = nodeErrorInfo(nodeState)
 	}
 	return &cloudprovider.InstanceStatus{
 		State:     s,
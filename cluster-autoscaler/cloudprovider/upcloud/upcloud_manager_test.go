@@ -18,13 +18,24 @@ package upcloud
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/cassette"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/mocks"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/client"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/autoscaler/cluster-autoscaler/config/dynamic"
 )
@@ -34,17 +45,22 @@ func TestClusterMaxNodes(t *testing.T) {
 
 	clusterID := uuid.New()
 	mock := newMockService(clusterID)
+	cluster, err := getCluster(context.TODO(), mock, clusterID)
+	require.NoError(t, err)
 	want := 10
-	got, err := clusterMaxNodes(context.TODO(), mock, clusterID, 10)
+	got, err := clusterMaxNodes(context.TODO(), mock, cluster, 10)
 	require.NoError(t, err)
 	require.Equal(t, want, got)
 
-	got, err = clusterMaxNodes(context.TODO(), mock, clusterID, 0)
+	got, err = clusterMaxNodes(context.TODO(), mock, cluster, 0)
 	require.NoError(t, err)
 	require.Equal(t, mock.Plans[0].MaxNodes, got)
 
-	_, err = clusterMaxNodes(context.TODO(), mock, clusterID, 100)
+	_, err = clusterMaxNodes(context.TODO(), mock, cluster, 100)
 	require.Error(t, err)
+
+	_, err = getCluster(context.TODO(), mock, uuid.New())
+	require.ErrorContains(t, err, "not found")
 }
 
 func TestClusterPlanByName(t *testing.T) {
@@ -79,6 +95,7 @@ func TestManager(t *testing.T) {
 	)
 	require.NoError(t, err)
 	require.Equal(t, upCfg.ClusterID, m.clusterID.String())
+	require.Equal(t, mocks.TestZone, m.zone)
 	require.Equal(t, dynamic.NodeGroupSpec{Name: "one", MinSize: 1, MaxSize: 2}, m.nodeGroupSpecs["one"])
 	require.Equal(t, dynamic.NodeGroupSpec{Name: "two", MinSize: 11, MaxSize: 20}, m.nodeGroupSpecs["two"])
 	require.NoError(t, m.refresh())
@@ -86,29 +103,662 @@ func TestManager(t *testing.T) {
 	require.Equal(t, len(svc.Clusters[clusterID.String()].NodeGroups), len(m.nodeGroups))
 }
 
-func newMockService(clusterID uuid.UUID) *mocks.UpCloudService {
-	return &mocks.UpCloudService{
-		Clusters: map[string]upcloud.KubernetesCluster{
-			clusterID.String(): {
-				UUID: clusterID.String(),
-				Plan: "dev",
-				NodeGroups: []upcloud.KubernetesNodeGroup{
-					{
-						Count: 2,
-						Name:  "group1",
-						State: upcloud.KubernetesNodeGroupStateRunning,
-					},
-					{
-						Count: 3,
-						Name:  "group2",
-						State: upcloud.KubernetesNodeGroupStateRunning,
-					},
-				},
-			},
-		},
-		Plans: []upcloud.KubernetesPlan{{
-			Name:     "dev",
-			MaxNodes: 20,
-		}},
+func TestManager_NodeGroupSpecPatterns(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(
+		mocks.NewTestNodeGroup("worker-1").WithNodes(1),
+		mocks.NewTestNodeGroup("worker-2").WithNodes(1),
+		mocks.NewTestNodeGroup("worker-gpu-1").WithNodes(1),
+		mocks.NewTestNodeGroup("db-1").WithNodes(1),
+		mocks.NewTestNodeGroup("other").WithNodes(1),
+	).Service()
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{},
+		cloudprovider.NodeGroupDiscoveryOptions{
+			NodeGroupSpecs: []string{"1:10:worker-*", "2:4:worker-gpu-*", "1:2:worker-1", "3:5:/db-[0-9]+/"},
+		})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+
+	limits := make(map[string][2]int)
+	for _, g := range m.getNodeGroups() {
+		limits[g.name] = [2]int{g.MinSize(), g.MaxSize()}
+	}
+	require.Equal(t, map[string][2]int{
+		"worker-1":     {1, 2},
+		"worker-2":     {1, 10},
+		"worker-gpu-1": {2, 4},
+		"db-1":         {3, 5},
+		"other":        {nodeGroupMinSize, mocks.TestClusterPlanMaxNodes},
+	}, limits)
+
+	for _, spec := range []string{"1:2:worker-[", "1:2:/db-(/"} {
+		_, err = newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{},
+			cloudprovider.NodeGroupDiscoveryOptions{NodeGroupSpecs: []string{spec}})
+		require.Error(t, err, spec)
+	}
+}
+
+func TestManager_NodeGroupSizeDefaults(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(
+		mocks.NewTestNodeGroup("default").WithNodes(2),
+		mocks.NewTestNodeGroup("spec").WithNodes(2),
+	).Service()
+	cfg := upCloudConfig{ClusterID: clusterID.String(), NodeGroupSizeDefaults: &nodeGroupSizeDefaults{minSize: 0, maxSize: 4}}
+	do := cloudprovider.NodeGroupDiscoveryOptions{NodeGroupSpecs: []string{"1:3:spec"}}
+	m, err := newManager(context.Background(), svc, cfg, config.AutoscalingOptions{}, do)
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	got := make(map[string][2]int)
+	for _, g := range m.getNodeGroups() {
+		got[g.name] = [2]int{g.MinSize(), g.MaxSize()}
+	}
+	require.Equal(t, map[string][2]int{
+		"default": {0, 4},
+		"spec":    {1, 3},
+	}, got)
+
+	// autoprovisioned node groups use default max size
+	g, err := m.newAutoprovisionedNodeGroup(mocks.TestNodeGroupPlan, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, 4, g.MaxSize())
+
+	// defaults can't exceed cluster plan maximum
+	cfg.NodeGroupSizeDefaults.maxSize = mocks.TestClusterPlanMaxNodes + 1
+	_, err = newManager(context.Background(), svc, cfg, config.AutoscalingOptions{}, do)
+	require.Error(t, err)
+}
+
+func TestManager_NodeGroupSizeDefaultsWithLabels(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(
+		mocks.NewTestNodeGroup("default").WithNodes(2),
+		mocks.NewTestNodeGroup("max").WithLabel(labelMaxSize, "3").WithNodes(2),
+		mocks.NewTestNodeGroup("both").WithLabel(labelMinSize, "2").WithLabel(labelMaxSize, "5").WithNodes(2),
+		mocks.NewTestNodeGroup("zero").WithLabel(labelMinSize, "0").WithNodes(2),
+		mocks.NewTestNodeGroup("invalid").WithLabel(labelMinSize, "-1").WithNodes(2),
+	).Service()
+	cfg := upCloudConfig{ClusterID: clusterID.String(), NodeGroupSizeDefaults: &nodeGroupSizeDefaults{minSize: 0, maxSize: 4}}
+	m, err := newManager(context.Background(), svc, cfg, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	type limits struct {
+		min, max int
+		source   string
+	}
+	got := make(map[string]limits)
+	for _, g := range m.getNodeGroups() {
+		got[g.name] = limits{g.MinSize(), g.MaxSize(), g.SizeLimitSource()}
+	}
+	require.Equal(t, map[string]limits{
+		"default": {0, 4, limitSourceDefault},
+		"max":     {0, 3, limitSourceLabel},
+		"both":    {2, 5, limitSourceLabel},
+		"zero":    {0, 4, limitSourceDefault},
+		"invalid": {0, 4, limitSourceDefault},
+	}, got)
+}
+
+func TestManager_NodeGroupAutoDiscovery(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(
+		mocks.NewTestNodeGroup("managed").WithNodes(2).WithLabel("autoscaling", "enabled").WithLabel(labelMinSize, "2").WithLabel(labelMaxSize, "5"),
+		mocks.NewTestNodeGroup("invalid-limits").WithNodes(1).WithLabel("autoscaling", "enabled").WithLabel(labelMaxSize, "100"),
+		mocks.NewTestNodeGroup("team").WithNodes(1).WithLabel("team", "a").WithLabel("env", "dev"),
+		mocks.NewTestNodeGroup("other-team").WithNodes(1).WithLabel("team", "a"),
+		mocks.NewTestNodeGroup("unmanaged").WithNodes(1),
+	).Service()
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{},
+		cloudprovider.NodeGroupDiscoveryOptions{
+			NodeGroupSpecs:              []string{"1:3:team"},
+			NodeGroupAutoDiscoverySpecs: []string{"label:autoscaling=enabled", "label:team=a,env=dev"},
+		})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+
+	limits := make(map[string][2]int)
+	for _, g := range m.getNodeGroups() {
+		limits[g.name] = [2]int{g.MinSize(), g.MaxSize()}
+	}
+	require.Equal(t, map[string][2]int{
+		"managed":        {2, 5},
+		"invalid-limits": {nodeGroupMinSize, mocks.TestClusterPlanMaxNodes},
+		"team":           {1, 3},
+	}, limits)
+
+	for _, spec := range []string{"autoscaling=enabled", "label:", "label:autoscaling", "label:=enabled"} {
+		_, err = newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{},
+			cloudprovider.NodeGroupDiscoveryOptions{NodeGroupAutoDiscoverySpecs: []string{spec}})
+		require.Error(t, err, spec)
+	}
+}
+
+func TestManager_NodeGroupOptOut(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(
+		mocks.NewTestNodeGroup("autoscaled").WithNodes(1),
+		mocks.NewTestNodeGroup("enabled").WithNodes(1).WithLabel(labelEnabled, "true"),
+		mocks.NewTestNodeGroup("invalid").WithNodes(1).WithLabel(labelEnabled, "no"),
+		mocks.NewTestNodeGroup("gpu").WithNodes(1).WithLabel(labelEnabled, "false"),
+		mocks.NewTestNodeGroup("ca-empty").WithNodes(0).WithLabel(labelAutoprovisioned, "true").WithLabel(labelEnabled, "false"),
+	).Service()
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+
+	names := make([]string, 0)
+	for _, g := range m.getNodeGroups() {
+		names = append(names, g.name)
+	}
+	require.ElementsMatch(t, []string{"autoscaled", "enabled", "invalid"}, names)
+
+	// empty autoprovisioned node group that opted out is not deleted
+	groups, err := svc.GetKubernetesNodeGroups(context.Background(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Len(t, groups, 5)
+}
+
+func TestManager_CustomPlan(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(mocks.NewTestNodeGroup("custom").WithCustomPlan(2, 6144, 50).WithNodes(1)).Service()
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	require.Len(t, m.getNodeGroups(), 1)
+
+	nodeInfo, err := m.getNodeGroups()[0].TemplateNodeInfo()
+	require.NoError(t, err)
+	capacity := nodeInfo.Node().Status.Capacity
+	require.Equal(t, "2", capacity.Cpu().String())
+	require.Equal(t, "6Gi", capacity.Memory().String())
+	require.Equal(t, "50Gi", capacity.StorageEphemeral().String())
+	require.Equal(t, customPlanName, nodeInfo.Node().Labels[apiv1.LabelInstanceTypeStable])
+	require.Same(t, m.plans, m.getNodeGroups()[0].plans)
+}
+
+func TestManager_NodeGroupCache(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := &detailsCountingService{upCloudService: newMockService(clusterID)}
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String(), NodeGroupCacheTTL: time.Hour},
+		config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, m.refresh())
+	groups := len(m.getNodeGroups())
+	require.Equal(t, groups, svc.detailCalls())
+
+	// steady-state refresh is served from cache
+	require.NoError(t, m.refresh())
+	require.Equal(t, groups, svc.detailCalls())
+
+	// scaling invalidates cached details of the node group
+	g := m.getNodeGroups()[0]
+	require.NoError(t, g.IncreaseSize(1))
+	require.NoError(t, m.refresh())
+	require.Equal(t, groups+1, svc.detailCalls())
+	require.Equal(t, g.targetSize(), len(m.getNodeGroups()[0].nodes))
+}
+
+func TestManager_RefreshInterval(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := &detailsCountingService{upCloudService: newMockService(clusterID)}
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String(), RefreshInterval: time.Hour},
+		config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, m.refresh())
+	groups := len(m.getNodeGroups())
+	require.Equal(t, 1, svc.listCalls())
+	require.Equal(t, groups, svc.detailCalls())
+
+	// node groups without in-flight operations are not fetched between full refreshes
+	require.NoError(t, m.refresh())
+	require.Equal(t, 1, svc.listCalls())
+	require.Equal(t, groups, svc.detailCalls())
+
+	// scaled node group is updated until its nodes are running
+	g := m.getNodeGroups()[0]
+	require.NoError(t, g.IncreaseSize(1))
+	require.True(t, g.inFlight())
+	require.NoError(t, m.refresh())
+	require.Equal(t, 1, svc.listCalls())
+	require.Equal(t, groups+1, svc.detailCalls())
+	require.False(t, g.inFlight())
+	require.NoError(t, m.refresh())
+	require.Equal(t, groups+1, svc.detailCalls())
+
+	// node groups are listed after node group is created or deleted
+	m.schedule.reset()
+	require.NoError(t, m.refresh())
+	require.Equal(t, 2, svc.listCalls())
+}
+
+func TestManager_RefreshInFlightWatch(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	mock := newMockService(clusterID)
+	mock.SetFaults(mocks.Faults{ProvisioningTimes: map[string]time.Duration{"": time.Hour}})
+	svc := &detailsCountingService{upCloudService: mock}
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String(), RefreshInterval: time.Hour},
+		config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	g := m.getNodeGroups()[0]
+	require.NoError(t, g.IncreaseSize(1))
+	calls := svc.detailCalls()
+
+	// refresh uses details that state wait of the node group has fetched
+	m.watch.start(g.name)
+	details, err := g.nodeGroupDetails()
+	require.NoError(t, err)
+	m.watch.observe(details)
+	require.NoError(t, m.refresh())
+	require.Equal(t, calls+1, svc.detailCalls())
+	require.True(t, g.inFlight())
+	require.Len(t, g.nodes, 3)
+
+	// details older than max age are not used
+	m.watch.mu.Lock()
+	m.watch.watches[g.name].fetchedAt = time.Now().Add(-2 * nodeGroupWatchMaxAge)
+	m.watch.mu.Unlock()
+	require.NoError(t, m.refresh())
+	require.Equal(t, calls+2, svc.detailCalls())
+
+	// details are not shared after the wait has stopped
+	m.watch.stop(g.name)
+	_, ok := m.watch.get(g.name)
+	require.False(t, ok)
+	require.NoError(t, m.refresh())
+	require.Equal(t, calls+3, svc.detailCalls())
+}
+
+func TestManager_AntiAffinity(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(
+		mocks.NewTestNodeGroup("group1").WithNodes(2),
+		mocks.NewTestNodeGroup("spread").WithAntiAffinity().WithNodes(2),
+	).Service()
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String(), AntiAffinityMaxNodes: 3}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	groups := make(map[string]*upCloudNodeGroup)
+	for _, g := range m.getNodeGroups() {
+		groups[g.name] = g
+	}
+	require.Equal(t, m.maxNodesTotal, groups["group1"].MaxSize())
+	require.Equal(t, 3, groups["spread"].MaxSize())
+	require.Equal(t, nodeGroupMinSize, groups["spread"].MinSize())
+	require.Error(t, groups["spread"].IncreaseSize(2))
+	require.NoError(t, groups["spread"].IncreaseSize(1))
+}
+
+func TestManager_SizeLimitSource(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(
+		mocks.NewTestNodeGroup("default").WithNodes(1),
+		mocks.NewTestNodeGroup("labeled").WithLabel(labelMaxSize, "5").WithNodes(1),
+		mocks.NewTestNodeGroup("dev").WithLabel(labelMaxSize, "5").WithNodes(2),
+		mocks.NewTestNodeGroup("spread").WithAntiAffinity().WithNodes(2),
+		mocks.NewTestNodeGroup("small").WithAntiAffinity().WithLabel(labelMaxSize, "2").WithNodes(2),
+	).Service()
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String(), AntiAffinityMaxNodes: 3}, config.AutoscalingOptions{},
+		cloudprovider.NodeGroupDiscoveryOptions{NodeGroupSpecs: []string{"2:3:dev"}})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	sources := make(map[string]string)
+	for _, g := range m.getNodeGroups() {
+		sources[g.name] = g.SizeLimitSource()
+	}
+	require.Equal(t, map[string]string{
+		"default": limitSourceDefault,
+		"labeled": limitSourceLabel,
+		"dev":     limitSourceSpec,
+		"spread":  limitSourceAntiAffinity,
+		// anti-affinity cap doesn't change limits below it
+		"small": limitSourceLabel,
+	}, sources)
+}
+
+func TestAntiAffinityPlaceholders(t *testing.T) {
+	t.Parallel()
+
+	nodes := withPlaceholders("spread", []cloudprovider.Instance{{Id: "upcloud:////node1"}}, 4, nil)
+	nodes = antiAffinityPlaceholders("spread", nodes, 2)
+	require.Len(t, nodes, 4)
+	require.Nil(t, nodes[1].Status.ErrorInfo)
+	for _, n := range nodes[2:] {
+		require.Equal(t, cloudprovider.InstanceCreating, n.Status.State)
+		require.Equal(t, cloudprovider.OutOfResourcesErrorClass, n.Status.ErrorInfo.ErrorClass)
+		require.Equal(t, antiAffinityErrorCode, n.Status.ErrorInfo.ErrorCode)
+	}
+
+	// zero max nodes doesn't mark placeholders
+	nodes = antiAffinityPlaceholders("spread", withPlaceholders("spread", nil, 4, nil), 0)
+	for _, n := range nodes {
+		require.Nil(t, n.Status.ErrorInfo)
+	}
+}
+
+func TestManager_FailedScaleUp(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(mocks.NewTestNodeGroup("group1").WithNodes(1)).Service()
+	svc.SetFaults(mocks.Faults{FailedScaleUps: map[string]bool{"group1": true}})
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	require.NoError(t, m.getNodeGroups()[0].IncreaseSize(2))
+
+	// nodes that failed node group didn't create are reported as instance errors
+	require.NoError(t, m.refresh())
+	g := m.getNodeGroups()[0]
+	require.Equal(t, 3, g.targetSize())
+	nodes, err := g.Nodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 3)
+	require.Nil(t, nodes[0].Status.ErrorInfo)
+	failed := make([]*apiv1.Node, 0)
+	for _, n := range nodes[1:] {
+		require.Equal(t, cloudprovider.InstanceCreating, n.Status.State)
+		require.Equal(t, "NODE_GROUP_FAILED", n.Status.ErrorInfo.ErrorCode)
+		failed = append(failed, &apiv1.Node{ObjectMeta: metav1.ObjectMeta{Name: n.Id}, Spec: apiv1.NodeSpec{ProviderID: n.Id}})
+	}
+
+	// deleting failed instances resets target size
+	require.NoError(t, g.DeleteNodes(failed))
+	require.Equal(t, 1, g.targetSize())
+	require.NoError(t, m.refresh())
+	g = m.getNodeGroups()[0]
+	require.Equal(t, 1, g.targetSize())
+	require.False(t, g.inFlight())
+}
+
+func TestManager_ScaleFailures(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(mocks.NewTestNodeGroup("group1").WithNodes(1)).Service()
+	failedScaleUps := map[string]bool{"group1": true}
+	svc.SetFaults(mocks.Faults{FailedScaleUps: failedScaleUps})
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	g := m.getNodeGroups()[0]
+	require.NoError(t, g.IncreaseSize(1))
+
+	// failure is recorded with the error class of the API error
+	svc.SetFaults(mocks.Faults{FailedScaleUps: failedScaleUps, ErrorRate: 1, ErrorStatus: http.StatusPaymentRequired})
+	require.Error(t, g.IncreaseSize(1))
+	failure, ok := m.failures.get("group1")
+	require.True(t, ok)
+	require.Equal(t, ScaleOperationIncreaseSize, failure.operation)
+	require.Equal(t, cloudprovider.OutOfResourcesErrorClass, failure.info.ErrorClass)
+	require.Equal(t, 2, g.targetSize())
+	svc.SetFaults(mocks.Faults{FailedScaleUps: failedScaleUps})
+
+	// nodes that node group didn't create are reported with the class of the failure
+	require.NoError(t, m.refresh())
+	nodes, err := m.getNodeGroups()[0].Nodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+	require.Nil(t, nodes[0].Status.ErrorInfo)
+	require.Equal(t, cloudprovider.OutOfResourcesErrorClass, nodes[1].Status.ErrorInfo.ErrorClass)
+	d := m.getNodeGroups()[0].debug()
+	require.NotNil(t, d.LastFailure)
+	require.True(t, d.LastFailure.OutOfResources)
+
+	// other failures are reported with other error class
+	f := newScaleFailures()
+	f.done("group1", ScaleOperationIncreaseSize, errors.New("timeout"))
+	require.Equal(t, cloudprovider.OtherErrorClass, f.errorInfo("group1", upcloud.KubernetesNodeGroupStateRunning).ErrorClass)
+	f.done("group1", ScaleOperationDeleteNodes, nil)
+	_, ok = f.get("group1")
+	require.True(t, ok)
+	f.done("group1", ScaleOperationIncreaseSize, nil)
+	require.Nil(t, f.errorInfo("group1", upcloud.KubernetesNodeGroupStateRunning))
+}
+
+func TestManager_PendingNodes(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(mocks.NewTestNodeGroup("group1").WithNodes(1)).Service()
+	svc.SetFaults(mocks.Faults{ProvisioningTimes: map[string]time.Duration{"": time.Hour}})
+	opts := config.AutoscalingOptions{NodeGroupDefaults: config.NodeGroupAutoscalingOptions{MaxNodeProvisionTime: time.Minute}}
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, opts, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	require.NoError(t, m.getNodeGroups()[0].IncreaseSize(1))
+	pendingNode := func() cloudprovider.Instance {
+		t.Helper()
+		require.NoError(t, m.refresh())
+		nodes, err := m.getNodeGroups()[0].Nodes()
+		require.NoError(t, err)
+		require.Len(t, nodes, 2)
+		require.Nil(t, nodes[0].Status.ErrorInfo)
+		require.False(t, isPlaceholder("group1", nodes[1].Id))
+		return nodes[1]
+	}
+	n := pendingNode()
+	require.Equal(t, cloudprovider.InstanceCreating, n.Status.State)
+	require.Nil(t, n.Status.ErrorInfo)
+
+	// node pending longer than max node provision time is reported as failed
+	m.pendingNodes.mu.Lock()
+	m.pendingNodes.firstSeen["group1"][n.Id] = time.Now().Add(-2 * time.Minute)
+	m.pendingNodes.mu.Unlock()
+	n = pendingNode()
+	require.Equal(t, cloudprovider.InstanceCreating, n.Status.State)
+	require.Equal(t, pendingNodeErrorCode, n.Status.ErrorInfo.ErrorCode)
+
+	// nodes that are no longer pending are forgotten
+	m.pendingNodes.observe("group1", nil, time.Minute)
+	require.Empty(t, m.pendingNodes.firstSeen)
+}
+
+func TestManager_PendingSizes(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := &staleListService{upCloudService: newMockService(clusterID)}
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	targetSize := func() int {
+		t.Helper()
+		for _, g := range m.getNodeGroups() {
+			if g.name == "group1" {
+				return g.targetSize()
+			}
+		}
+		t.Fatal("node group group1 not found")
+		return 0
+	}
+	require.Equal(t, 2, targetSize())
+
+	// requested size is kept while the API lists the previous size
+	svc.freeze(context.Background(), clusterID)
+	require.NoError(t, m.getNodeGroups()[0].IncreaseSize(2))
+	require.NoError(t, m.refresh())
+	require.Equal(t, 4, targetSize())
+	require.Len(t, m.getNodeGroups()[0].nodes, 4)
+
+	// listed size replaces requested size when the API confirms it
+	svc.unfreeze()
+	require.NoError(t, m.refresh())
+	require.Equal(t, 4, targetSize())
+	require.Empty(t, m.pending.sizes)
+
+	// unconfirmed size expires
+	m.pending.sizes["group1"] = pendingSize{size: 7, requestedAt: time.Now().Add(-2 * pendingSizeTimeout)}
+	require.NoError(t, m.refresh())
+	require.Equal(t, 4, targetSize())
+	require.Empty(t, m.pending.sizes)
+}
+
+func TestManager_OperationLocks(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	m, err := newManager(context.Background(), newMockService(clusterID), upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	old := m.getNodeGroups()[0]
+
+	// operation of node group replaced by refresh waits for the operation of the previous node group object
+	unlock := old.opLocks.lock(old.name)
+	m.schedule.reset()
+	require.NoError(t, m.refresh())
+	g := m.getNodeGroups()[0]
+	require.Equal(t, old.name, g.name)
+	require.NotSame(t, old, g)
+	done := make(chan error, 1)
+	go func() {
+		done <- g.IncreaseSize(1)
+	}()
+	select {
+	case <-done:
+		t.Fatal("node group operation was not serialized with the previous node group object")
+	case <-time.After(200 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("node group operation did not continue after the lock was released")
+	}
+}
+
+// staleListService lists node groups with the sizes they had when the list was frozen, like API that doesn't
+// reflect size changes yet
+type staleListService struct {
+	upCloudService
+
+	mu     sync.Mutex
+	frozen []sdkext.KubernetesNodeGroup
+}
+
+func (s *staleListService) freeze(ctx context.Context, clusterID uuid.UUID) {
+	groups, _ := s.upCloudService.GetKubernetesNodeGroups(ctx, &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frozen = groups
+}
+
+func (s *staleListService) unfreeze() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frozen = nil
+}
+
+func (s *staleListService) GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) ([]sdkext.KubernetesNodeGroup, error) {
+	s.mu.Lock()
+	frozen := s.frozen
+	s.mu.Unlock()
+	if frozen != nil {
+		return frozen, nil
+	}
+	return s.upCloudService.GetKubernetesNodeGroups(ctx, r)
+}
+
+// detailsCountingService counts node group list and details requests
+type detailsCountingService struct {
+	upCloudService
+
+	mu    sync.Mutex
+	calls int
+	lists int
+}
+
+func (s *detailsCountingService) GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) ([]sdkext.KubernetesNodeGroup, error) {
+	s.mu.Lock()
+	s.lists++
+	s.mu.Unlock()
+	return s.upCloudService.GetKubernetesNodeGroups(ctx, r)
+}
+
+func (s *detailsCountingService) listCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lists
+}
+
+func (s *detailsCountingService) GetKubernetesNodeGroup(ctx context.Context, r *request.GetKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroupDetails, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	return s.upCloudService.GetKubernetesNodeGroup(ctx, r)
+}
+
+func (s *detailsCountingService) detailCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// TestManager_Cassette replays recorded API interactions. Run with UPCLOUD_CASSETTE_RECORD=1 and
+// UPCLOUD_USERNAME, UPCLOUD_PASSWORD and UPCLOUD_CLUSTER_ID set to re-record the cassette against real API.
+func TestManager_Cassette(t *testing.T) {
+	const cassetteClusterID string = "0ddab8f4-97c0-4222-91ba-85a4fff7499b"
+
+	clusterID := cassetteClusterID
+	mode := cassette.ModeFromEnv()
+	if mode == cassette.ModeRecord {
+		clusterID = os.Getenv(envUpCloudClusterID)
+	}
+	rec, err := cassette.New("testdata/cassettes/manager_refresh.json", mode, nil, cassette.ReplaceString(clusterID, cassetteClusterID))
+	require.NoError(t, err)
+	svc := sdkext.NewService(client.New(
+		os.Getenv(envUpCloudUsername),
+		os.Getenv(envUpCloudPassword),
+		client.WithBaseURL(client.APIBaseURL),
+		client.WithHTTPClient(&http.Client{Transport: rec}),
+	))
+
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	require.NoError(t, rec.Stop())
+	if mode == cassette.ModeRecord {
+		return
 	}
+	require.Empty(t, rec.Unused())
+	require.Equal(t, 10, m.maxNodesTotal)
+	require.Len(t, m.nodeGroups, 2)
+	require.Equal(t, "default", m.nodeGroups[0].name)
+	require.Equal(t, 2, m.nodeGroups[0].size)
+	require.Len(t, m.nodeGroups[0].nodes, 2)
+	require.Equal(t, "upcloud:////00ed3237-f2ba-4a57-9d4a-0aa94ce3d721", m.nodeGroups[0].nodes[0].Id)
+	require.Equal(t, "monitor", m.nodeGroups[1].name)
+	require.Len(t, m.nodeGroups[1].nodes, 1)
+}
+
+func newMockService(clusterID uuid.UUID) *mocks.UpCloudService {
+	return mocks.NewTestCluster(clusterID).WithNodeGroups(
+		mocks.NewTestNodeGroup("group1").WithNodes(2),
+		mocks.NewTestNodeGroup("group2").WithNodes(3),
+	).Service()
 }
@@ -0,0 +1,285 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	k8smetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	caNamespace = "cluster_autoscaler"
+
+	// node states of upcloud_node_group_nodes metric
+	nodeStateRunning  = "running"
+	nodeStateCreating = "creating"
+	nodeStateDeleting = "deleting"
+	nodeStateFailed   = "failed"
+)
+
+var (
+	nodeStates      = []string{nodeStateRunning, nodeStateCreating, nodeStateDeleting, nodeStateFailed}
+	scaleOperations = []ScaleOperationType{
+		ScaleOperationIncreaseSize,
+		ScaleOperationDecreaseTargetSize,
+		ScaleOperationDeleteNodes,
+		ScaleOperationForceDeleteNodes,
+	}
+)
+
+var (
+	apiRequestsTotal = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_api_requests_total",
+			Help:      "Counter of UpCloud API requests for each service method, including retries.",
+		}, []string{"method"},
+	)
+
+	apiRequestErrorsTotal = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_api_request_errors_total",
+			Help:      "Counter of failed UpCloud API requests for each service method and error code.",
+		}, []string{"method", "code"},
+	)
+
+	apiRequestDuration = k8smetrics.NewHistogramVec(
+		&k8smetrics.HistogramOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_api_request_duration_seconds",
+			Help:      "Latency of UpCloud API requests for each service method.",
+			Buckets:   k8smetrics.DefBuckets,
+		}, []string{"method"},
+	)
+
+	apiLastSuccessTimestamp = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_api_last_success_timestamp_seconds",
+			Help:      "Unix time of the last successful UpCloud API request.",
+		},
+	)
+
+	apiAuthenticated = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_api_authenticated",
+			Help:      "Whether UpCloud API accepts the credentials, 0 after API has rejected them.",
+		},
+	)
+
+	lastRefreshTimestamp = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_last_refresh_timestamp_seconds",
+			Help:      "Unix time of the last successful refresh of UpCloud node groups.",
+		},
+	)
+
+	providerHealthy = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_healthy",
+			Help:      "Whether UpCloud cloud provider is healthy, 0 when it's degraded.",
+		},
+	)
+
+	nodeGroupCurrentSizeGauge = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_node_group_current_size",
+			Help:      "Number of nodes that UpCloud API lists for each node group.",
+		}, []string{"node_group"},
+	)
+
+	nodeGroupTargetSizeGauge = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_node_group_target_size",
+			Help:      "Target size of each node group, including requested nodes that don't exist yet.",
+		}, []string{"node_group"},
+	)
+
+	nodeGroupMinSizeGauge = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_node_group_min_size",
+			Help:      "Min size of each node group.",
+		}, []string{"node_group"},
+	)
+
+	nodeGroupMaxSizeGauge = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_node_group_max_size",
+			Help:      "Max size of each node group.",
+		}, []string{"node_group"},
+	)
+
+	nodeGroupNodesGauge = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_node_group_nodes",
+			Help:      "Number of nodes of each node group by state, which is running, creating, deleting or failed.",
+		}, []string{"node_group", "state"},
+	)
+
+	nodeGroupLastScaleTimestamp = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "upcloud_node_group_last_scale_timestamp_seconds",
+			Help:      "Unix time of the last successful scaling operation of each node group by operation.",
+		}, []string{"node_group", "operation"},
+	)
+)
+
+// RegisterMetrics registers all UpCloud metrics.
+func RegisterMetrics() {
+	legacyregistry.MustRegister(apiRequestsTotal)
+	legacyregistry.MustRegister(apiRequestErrorsTotal)
+	legacyregistry.MustRegister(apiRequestDuration)
+	legacyregistry.MustRegister(apiLastSuccessTimestamp)
+	legacyregistry.MustRegister(apiAuthenticated)
+	legacyregistry.MustRegister(lastRefreshTimestamp)
+	legacyregistry.MustRegister(providerHealthy)
+	legacyregistry.MustRegister(nodeGroupCurrentSizeGauge)
+	legacyregistry.MustRegister(nodeGroupTargetSizeGauge)
+	legacyregistry.MustRegister(nodeGroupMinSizeGauge)
+	legacyregistry.MustRegister(nodeGroupMaxSizeGauge)
+	legacyregistry.MustRegister(nodeGroupNodesGauge)
+	legacyregistry.MustRegister(nodeGroupLastScaleTimestamp)
+}
+
+// registerRequest registers completed UpCloud API request
+func registerRequest(method string, start time.Time, err error) {
+	apiRequestsTotal.WithLabelValues(method).Inc()
+	apiRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		apiRequestErrorsTotal.WithLabelValues(method, errorCode(err)).Inc()
+	}
+}
+
+// errorCode returns metric label of the request error, which is HTTP status code of API errors
+func errorCode(err error) string {
+	var p *upcloud.Problem
+	switch {
+	case errors.As(err, &p):
+		return strconv.Itoa(p.Status)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
+
+// registerScaleOperation registers successful scaling operation of the node group
+func registerScaleOperation(name string, operation ScaleOperationType) {
+	nodeGroupLastScaleTimestamp.WithLabelValues(name, string(operation)).SetToCurrentTime()
+}
+
+// nodeGroupMetrics updates node group gauges on refresh and removes gauges of node groups that are no longer
+// managed. Nil nodeGroupMetrics doesn't update gauges.
+type nodeGroupMetrics struct {
+	mu sync.Mutex
+	// names are the node groups that have gauges
+	names map[string]bool
+}
+
+func newNodeGroupMetrics() *nodeGroupMetrics {
+	return &nodeGroupMetrics{names: make(map[string]bool)}
+}
+
+// update sets gauges of the node groups
+func (m *nodeGroupMetrics) update(groups []*upCloudNodeGroup) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		names[g.name] = true
+		g.mu.RLock()
+		nodes := append([]cloudprovider.Instance(nil), g.nodes...)
+		g.mu.RUnlock()
+		counts := nodeStateCounts(nodes)
+		current := 0
+		for _, n := range nodes {
+			if !isPlaceholder(g.name, n.Id) {
+				current++
+			}
+		}
+		nodeGroupCurrentSizeGauge.WithLabelValues(g.name).Set(float64(current))
+		nodeGroupTargetSizeGauge.WithLabelValues(g.name).Set(float64(g.targetSize()))
+		nodeGroupMinSizeGauge.WithLabelValues(g.name).Set(float64(g.minSize))
+		nodeGroupMaxSizeGauge.WithLabelValues(g.name).Set(float64(g.maxSize))
+		for _, state := range nodeStates {
+			nodeGroupNodesGauge.WithLabelValues(g.name, state).Set(float64(counts[state]))
+		}
+	}
+	for name := range m.names {
+		if !names[name] {
+			deleteNodeGroupMetrics(name)
+		}
+	}
+	m.names = names
+}
+
+// nodeStateCounts returns number of nodes in each state, nodes that have error info are failed
+func nodeStateCounts(nodes []cloudprovider.Instance) map[string]int {
+	counts := make(map[string]int, len(nodeStates))
+	for _, n := range nodes {
+		switch {
+		case n.Status == nil:
+			continue
+		case n.Status.ErrorInfo != nil:
+			counts[nodeStateFailed]++
+		case n.Status.State == cloudprovider.InstanceRunning:
+			counts[nodeStateRunning]++
+		case n.Status.State == cloudprovider.InstanceCreating:
+			counts[nodeStateCreating]++
+		case n.Status.State == cloudprovider.InstanceDeleting:
+			counts[nodeStateDeleting]++
+		}
+	}
+	return counts
+}
+
+func deleteNodeGroupMetrics(name string) {
+	labels := map[string]string{"node_group": name}
+	nodeGroupCurrentSizeGauge.Delete(labels)
+	nodeGroupTargetSizeGauge.Delete(labels)
+	nodeGroupMinSizeGauge.Delete(labels)
+	nodeGroupMaxSizeGauge.Delete(labels)
+	for _, state := range nodeStates {
+		nodeGroupNodesGauge.Delete(map[string]string{"node_group": name, "state": state})
+	}
+	for _, op := range scaleOperations {
+		nodeGroupLastScaleTimestamp.Delete(map[string]string{"node_group": name, "operation": string(op)})
+	}
+}
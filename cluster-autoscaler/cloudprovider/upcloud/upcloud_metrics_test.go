@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/mocks"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	k8smetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+// TestAPIMetrics is not parallel because metrics are global
+func TestAPIMetrics(t *testing.T) {
+	registry := testutil.NewFakeKubeRegistry("1.31.0")
+	registry.MustRegister(apiRequestsTotal, apiRequestErrorsTotal, apiRequestDuration)
+
+	clusterID := uuid.New()
+	mock := newMockService(clusterID)
+	svc := newTestRetryService(mock, 2)
+	const method = "GetKubernetesNodeGroups"
+	requests := counterValue(t, apiRequestsTotal.WithLabelValues(method))
+	throttled := counterValue(t, apiRequestErrorsTotal.WithLabelValues(method, "429"))
+
+	mock.SetFaults(mocks.Faults{RateLimitedCalls: 1})
+	_, err := svc.GetKubernetesNodeGroups(context.Background(), &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Equal(t, requests+2, counterValue(t, apiRequestsTotal.WithLabelValues(method)))
+	require.Equal(t, throttled+1, counterValue(t, apiRequestErrorsTotal.WithLabelValues(method, "429")))
+
+	h, err := testutil.GetHistogramVecFromGatherer(registry, "cluster_autoscaler_upcloud_api_request_duration_seconds", map[string]string{"method": method})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, h.GetAggregatedSampleCount(), uint64(2))
+}
+
+// TestNodeGroupMetrics is not parallel because metrics are global
+func TestNodeGroupMetrics(t *testing.T) {
+	registry := testutil.NewFakeKubeRegistry("1.31.0")
+	registry.MustRegister(nodeGroupCurrentSizeGauge, nodeGroupTargetSizeGauge, nodeGroupMinSizeGauge, nodeGroupMaxSizeGauge,
+		nodeGroupNodesGauge, nodeGroupLastScaleTimestamp)
+
+	clusterID := uuid.New()
+	svc := newMockService(clusterID)
+	p := newUpCloudCloudProvider(clusterID, svc)
+	p.manager.maxNodesTotal = 10
+	p.manager.metrics = newNodeGroupMetrics()
+	require.NoError(t, p.Refresh())
+	require.Equal(t, 2.0, gaugeValue(t, nodeGroupCurrentSizeGauge.WithLabelValues("group1")))
+	require.Equal(t, 3.0, gaugeValue(t, nodeGroupTargetSizeGauge.WithLabelValues("group2")))
+	require.Equal(t, float64(nodeGroupMinSize), gaugeValue(t, nodeGroupMinSizeGauge.WithLabelValues("group1")))
+	require.Equal(t, 10.0, gaugeValue(t, nodeGroupMaxSizeGauge.WithLabelValues("group1")))
+	require.Equal(t, 2.0, gaugeValue(t, nodeGroupNodesGauge.WithLabelValues("group1", nodeStateRunning)))
+
+	group := p.manager.getNodeGroups()[0]
+	require.Equal(t, "group1", group.name)
+	require.NoError(t, group.IncreaseSize(1))
+	require.Positive(t, gaugeValue(t, nodeGroupLastScaleTimestamp.WithLabelValues("group1", string(ScaleOperationIncreaseSize))))
+	p.manager.metrics.update(p.manager.getNodeGroups())
+	require.Equal(t, 2.0, gaugeValue(t, nodeGroupCurrentSizeGauge.WithLabelValues("group1")))
+	require.Equal(t, 3.0, gaugeValue(t, nodeGroupTargetSizeGauge.WithLabelValues("group1")))
+	require.Equal(t, 1.0, gaugeValue(t, nodeGroupNodesGauge.WithLabelValues("group1", nodeStateCreating)))
+
+	// gauges of node groups that are no longer managed are removed
+	p.manager.metrics.update(p.manager.getNodeGroups()[1:])
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			require.False(t, testutil.LabelsMatch(m, map[string]string{"node_group": "group1"}), f.GetName())
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "404", errorCode(fmt.Errorf("wrapped: %w", &upcloud.Problem{Status: http.StatusNotFound})))
+	require.Equal(t, "timeout", errorCode(context.DeadlineExceeded))
+	require.Equal(t, "canceled", errorCode(context.Canceled))
+	require.Equal(t, "unknown", errorCode(fmt.Errorf("failed")))
+}
+
+func counterValue(t *testing.T, c k8smetrics.CounterMetric) float64 {
+	t.Helper()
+	v, err := testutil.GetCounterMetricValue(c)
+	require.NoError(t, err)
+	return v
+}
+
+func gaugeValue(t *testing.T, g k8smetrics.GaugeMetric) float64 {
+	t.Helper()
+	v, err := testutil.GetGaugeMetricValue(g)
+	require.NoError(t, err)
+	return v
+}
@@ -18,76 +18,205 @@ package upcloud
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/klog/v2"
 	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
 )
 
+// nodeGroupStateBackoff is the delay between node group state checks
+var nodeGroupStateBackoff = wait.Backoff{
+	Duration: nodeGroupStateBackoffInitial,
+	Factor:   2,
+	Jitter:   0.5,
+	Steps:    math.MaxInt32,
+	Cap:      nodeGroupStateBackoffMax,
+}
+
 // upCloudNodeGroup implements cloudprovide.NodeGroup interfaces
 type upCloudNodeGroup struct {
 	clusterID uuid.UUID
 	name      string
-	size      int
 	minSize   int
 	maxSize   int
+	// limitSource tells where minSize and maxSize come from
+	limitSource string
+	// labels are UpCloud node group labels
+	labels map[string]string
+	plan   string
+	// customPlan is set when node group uses custom plan
+	customPlan *sdkext.KubernetesNodeGroupCustomPlan
+	// zone is the UpCloud zone of the cluster
+	zone   string
+	taints []apiv1.Taint
+	// kubeletArgs are UpCloud node group kubelet arguments
+	kubeletArgs map[string]string
+	// autoprovisioned is set for node groups created by the autoscaler
+	autoprovisioned bool
+	// zeroOrMaxNodeScaling node group is scaled from zero to max size and back to zero all at once
+	zeroOrMaxNodeScaling bool
+	// antiAffinityMaxNodes caps nodes of anti-affinity node group to the number of hosts, zero doesn't cap nodes
+	antiAffinityMaxNodes int
+	// maxNodeProvisionTime is the time atomic scale-up waits for new nodes
+	maxNodeProvisionTime time.Duration
 
-	nodes []cloudprovider.Instance
 	svc   upCloudService
+	hooks scaleHooks
+	// details is the manager's node group details cache, which is invalidated after scaling operations
+	details *nodeGroupCache
+	// schedule is the manager's refresh schedule, which is reset when node group is created or deleted
+	schedule *refreshSchedule
+	// lifecycle is the manager's lifecycle, which aborts operations when the provider is cleaned up
+	lifecycle *lifecycle
+	// opLocks are the manager's node group operation locks
+	opLocks *nodeGroupLocks
+	// pending is the manager's tracker of requested node group sizes
+	pending *pendingSizes
+	// failures is the manager's tracker of failed scaling operations
+	failures *scaleFailures
+	// plans is the manager's server plan cache
+	plans *planCache
+	// watch shares details fetched by state waits with the manager
+	watch *nodeGroupWatch
+	// templates are the manager's template overrides
+	templates *templateOverrides
+	// systemPods are added to the template node
+	systemPods []systemPod
+
+	// mu guards size, nodes, theoretical and initialNodes
+	mu    sync.RWMutex
+	size  int
+	nodes []cloudprovider.Instance
+	// theoretical is set until autoprovisioned node group is created
+	theoretical bool
 
-	mu sync.Mutex
+	// initialNodes is the number of nodes created together with the node group. They count
+	// towards the first scale-up, which is requested as if the node group was empty.
+	initialNodes int
 }
 
 // Id returns an unique identifier of the node group.
 func (u *upCloudNodeGroup) Id() string { //nolint: stylecheck
 	id := fmt.Sprintf("%s/%s", u.clusterID.String(), u.name)
-	// set log level higher because this get called a lot
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.Id called", id)
+	u.logOperation("Id")
 	return id
 }
 
 // MinSize returns minimum size of the node group.
 func (u *upCloudNodeGroup) MinSize() int {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.MinSize called", u.Id())
+	u.logOperation("MinSize")
 	return u.minSize
 }
 
 // MaxSize returns maximum size of the node group.
 func (u *upCloudNodeGroup) MaxSize() int {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.MaxSize called", u.Id())
+	u.logOperation("MaxSize")
 	return u.maxSize
 }
 
+// SizeLimitSource returns where min and max size of the node group come from: "default", "label", "--nodes" or
+// "anti-affinity". It's used by upcloud-provider-check to explain the limits.
+func (u *upCloudNodeGroup) SizeLimitSource() string {
+	if u.limitSource == "" {
+		return limitSourceDefault
+	}
+	return u.limitSource
+}
+
 // TargetSize returns the current target size of the node group. It is possible that the
 // number of nodes in Kubernetes is different at the moment but should be equal
 // to Size() once everything stabilizes (new nodes finish startup and registration or
 // removed nodes are deleted completely). Implementation required.
 func (u *upCloudNodeGroup) TargetSize() (int, error) {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.TargetSize called (%d)", u.Id(), u.size)
-	return u.size, nil
+	size := u.targetSize()
+	u.logOperation("TargetSize", "size", size)
+	return size, nil
+}
+
+func (u *upCloudNodeGroup) targetSize() int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.size
+}
+
+// setTargetSize sets node group size returned by the API, which replaces requested size
+func (u *upCloudNodeGroup) setTargetSize(size int) {
+	u.pending.clear(u.name)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.size = size
 }
 
 // IncreaseSize increases the size of the node group. To delete a node you need
 // to explicitly name it and use DeleteNode. This function should wait until
 // node group size is updated. Implementation required.
-func (u *upCloudNodeGroup) IncreaseSize(delta int) error {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.IncreaseSize(%d) called", u.Id(), delta)
+// Size change is submitted without waiting for the new nodes, which are represented by placeholder
+// instances until they are listed in node group details.
+func (u *upCloudNodeGroup) IncreaseSize(delta int) (err error) {
+	defer u.logOperation("IncreaseSize", "delta", delta).done(&err)
 	if delta <= 0 {
 		return fmt.Errorf("failed to increase node group size, delta=%d", delta)
 	}
-	size := u.size + delta
+	defer u.opLocks.lock(u.name)()
+	current, size := u.increasedSize(delta)
 	if size > u.MaxSize() {
-		return fmt.Errorf("failed to increase node group size, current=%d want=%d max=%d", u.size, size, u.MaxSize())
+		return fmt.Errorf("failed to increase node group size, current=%d want=%d max=%d", current, size, u.MaxSize())
 	}
-	return u.scaleNodeGroup(size)
+	if size <= current {
+		return nil
+	}
+	if err := u.validateZeroOrMaxSize(current, size); err != nil {
+		return err
+	}
+	return u.withScaleHooks(u.newScaleOperation(ScaleOperationIncreaseSize, current, size), func() error {
+		return u.requestSize(size)
+	})
+}
+
+// increasedSize returns current target size and the size that increasing it by delta requests. Nodes created
+// together with the node group count towards the first increase, which CA requests as if the node group was empty.
+// Caller must hold the node group operation lock.
+func (u *upCloudNodeGroup) increasedSize(delta int) (int, int) {
+	current := u.targetSize()
+	u.mu.Lock()
+	initialNodes := u.initialNodes
+	u.initialNodes = 0
+	u.mu.Unlock()
+	return current, current + delta - initialNodes
+}
+
+// requestSize submits node group size change without waiting for it, and updates placeholder instances of the
+// pending nodes. Caller must hold the node group operation lock.
+func (u *upCloudNodeGroup) requestSize(size int) error {
+	ctx, cancel := u.lifecycle.withTimeout(timeoutModifyNodeGroup)
+	defer cancel()
+	klog.V(logInfo).InfoS("requesting node group size change", u.logValues("from", u.targetSize(), "to", size)...)
+	if _, err := u.svc.ModifyKubernetesNodeGroup(ctx, &request.ModifyKubernetesNodeGroupRequest{
+		ClusterUUID: u.clusterID.String(),
+		Name:        u.name,
+		NodeGroup:   request.ModifyKubernetesNodeGroup{Count: size},
+	}); err != nil {
+		return toAutoscalerError(err, "failed to scale node group %s", u.name)
+	}
+	u.pending.set(u.name, size)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.size = size
+	u.nodes = withPlaceholders(u.name, u.nodes, size, nil)
+	return nil
 }
 
 // DecreaseTargetSize decreases the target size of the node group. This function
@@ -95,24 +224,63 @@ func (u *upCloudNodeGroup) IncreaseSize(delta int) error {
 // request for new nodes that have not been yet fulfilled. Delta should be negative.
 // It is assumed that cloud provider will not delete the existing nodes when there
 // is an option to just decrease the target. Implementation required.
-func (u *upCloudNodeGroup) DecreaseTargetSize(delta int) error {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.DecreaseTargetSize(%d) called", u.Id(), delta)
+// Provisioned nodes are checked from node group details, because cached nodes may be outdated and decreasing
+// node group count below the number of provisioned nodes would delete them.
+func (u *upCloudNodeGroup) DecreaseTargetSize(delta int) (err error) {
+	defer u.logOperation("DecreaseTargetSize", "delta", delta).done(&err)
 	if delta >= 0 {
 		return fmt.Errorf("failed to increase node group size, delta=%d", delta)
 	}
-	size := u.size + delta
+	defer u.opLocks.lock(u.name)()
+	current := u.targetSize()
+	size := current + delta
 	if size < u.MinSize() {
-		return fmt.Errorf("failed to decrease node group size, current=%d want=%d min=%d", u.size, size, u.MinSize())
+		return fmt.Errorf("failed to decrease node group size, current=%d want=%d min=%d", current, size, u.MinSize())
+	}
+	details, err := u.nodeGroupDetails()
+	if err != nil {
+		return err
 	}
-	return u.scaleNodeGroup(size)
+	if provisioned := len(details.Nodes); size < provisioned {
+		return fmt.Errorf("failed to decrease node group size, current=%d want=%d provisioned=%d, use DeleteNodes to delete provisioned nodes",
+			current, size, provisioned)
+	}
+	return u.withScaleHooks(u.newScaleOperation(ScaleOperationDecreaseTargetSize, current, size), func() error {
+		return u.scaleNodeGroup(size)
+	})
 }
 
+func (u *upCloudNodeGroup) newScaleOperation(t ScaleOperationType, current, target int) *ScaleOperation {
+	return &ScaleOperation{
+		Type:        t,
+		ClusterID:   u.clusterID.String(),
+		NodeGroup:   u.name,
+		CurrentSize: current,
+		TargetSize:  target,
+		Annotations: make(map[string]string),
+	}
+}
+
+// withScaleHooks runs operation fn unless it's vetoed by scale hooks
+func (u *upCloudNodeGroup) withScaleHooks(op *ScaleOperation, fn func() error) error {
+	if err := u.hooks.pre(u.lifecycle.context(), op); err != nil {
+		return err
+	}
+	err := fn()
+	u.details.invalidate(u.name)
+	u.failures.done(u.name, op.Type, err)
+	if err == nil {
+		registerScaleOperation(u.name, op.Type)
+	}
+	u.hooks.post(op, err)
+	return err
+}
+
+// scaleNodeGroup sets node group size and waits until node group is running. Caller must hold the node group operation lock.
 func (u *upCloudNodeGroup) scaleNodeGroup(size int) error {
-	u.mu.Lock()
-	defer u.mu.Unlock()
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutModifyNodeGroup)
+	ctx, cancel := u.lifecycle.withTimeout(timeoutModifyNodeGroup)
 	defer cancel()
-	klog.V(logInfo).Infof("scaling node group %s from %d to %d", u.Id(), u.size, size)
+	klog.V(logInfo).InfoS("scaling node group", u.logValues("from", u.targetSize(), "to", size)...)
 	_, err := u.svc.ModifyKubernetesNodeGroup(ctx, &request.ModifyKubernetesNodeGroupRequest{
 		ClusterUUID: u.clusterID.String(),
 		Name:        u.name,
@@ -121,66 +289,303 @@ func (u *upCloudNodeGroup) scaleNodeGroup(size int) error {
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to scale node group %s, %w", u.name, err)
+		return toAutoscalerError(err, "failed to scale node group %s", u.name)
 	}
-	nodeGroup, err := u.waitNodeGroupState(upcloud.KubernetesNodeGroupStateRunning, timeoutWaitNodeGroupState)
+	nodeGroup, err := u.waitNodeGroupState(u.lifecycle.context(), upcloud.KubernetesNodeGroupStateRunning, timeoutWaitNodeGroupState)
 	if err != nil {
 		return err
 	}
-	u.size = nodeGroup.Count
+	u.setTargetSize(nodeGroup.Count)
 	return nil
 }
 
-func (u *upCloudNodeGroup) waitNodeGroupState(state upcloud.KubernetesNodeGroupState, timeout time.Duration) (*upcloud.KubernetesNodeGroupDetails, error) {
-	deadline := time.Now().Add(timeout)
-	i := 1
-	klog.V(logInfo).Infof("waiting node group %s state %s", u.Id(), state)
-	for time.Now().Before(deadline) {
-		ctx, cancel := context.WithTimeout(context.Background(), timeoutGetRequest)
-		defer cancel()
-
-		g, err := u.svc.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{
+// waitNodeGroupState polls node group until it's in the state. Delay between polls grows exponentially with jitter
+// up to the cap of nodeGroupStateBackoff.
+func (u *upCloudNodeGroup) waitNodeGroupState(ctx context.Context, state upcloud.KubernetesNodeGroupState, timeout time.Duration) (*upcloud.KubernetesNodeGroupDetails, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	backoff := nodeGroupStateBackoff
+	u.watch.start(u.name)
+	defer u.watch.stop(u.name)
+	klog.V(logInfo).InfoS("waiting node group state", u.logValues("state", state)...)
+	for i := 1; ; i++ {
+		reqCtx, reqCancel := context.WithTimeout(ctx, timeoutGetRequest)
+		g, err := u.svc.GetKubernetesNodeGroup(reqCtx, &request.GetKubernetesNodeGroupRequest{
 			ClusterUUID: u.clusterID.String(),
 			Name:        u.name,
 		})
+		reqCancel()
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("node group %s state check (%d) stopped, %w", u.Id(), i, ctx.Err())
+			}
 			return g, fmt.Errorf("failed to fetch node group %s, %w", u.Id(), err)
 		}
+		u.watch.observe(g)
 		if g.State == state {
 			return g, nil
 		}
-		klog.V(logInfo).Infof("waiting(%d) node group %s state %s (%s)", i, u.Id(), state, g.State)
-		time.Sleep(3 * time.Second)
-		i++
+		delay := backoff.Step()
+		klog.V(logInfo).InfoS("waiting node group state", u.logValues("state", state, "currentState", g.State, "check", i, "nextCheck", delay)...)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("node group %s state check (%d) stopped, %w", u.Id(), i, ctx.Err())
+		case <-time.After(delay):
+		}
 	}
-	return nil, fmt.Errorf("node group %s state check (%d) timed out", u.Id(), i)
 }
 
 // DeleteNodes deletes nodes from this node group. Error is returned either on
 // failure or if the given node doesn't belong to this node group. This function
 // should wait until node group size is updated. Implementation required.
-func (u *upCloudNodeGroup) DeleteNodes(nodes []*apiv1.Node) error {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.DeleteNodes called", u.Id())
-	u.mu.Lock()
-	defer u.mu.Unlock()
+func (u *upCloudNodeGroup) DeleteNodes(nodes []*apiv1.Node) (err error) {
+	defer u.logOperation("DeleteNodes", "nodes", len(nodes)).done(&err)
+	defer u.opLocks.lock(u.name)()
 
-	for i := range nodes {
-		if err := u.deleteNode(nodes[i].GetName()); err != nil {
+	if err := u.validateMembership(nodes); err != nil {
+		return err
+	}
+	current := u.targetSize()
+	if u.zeroOrMaxNodeScaling {
+		if err := u.validateZeroOrMaxDeletion(nodes); err != nil {
 			return err
 		}
-		nodeGroup, err := u.waitNodeGroupState(upcloud.KubernetesNodeGroupStateRunning, timeoutWaitNodeGroupState)
-		if err != nil {
+	}
+	op := u.newScaleOperation(ScaleOperationDeleteNodes, current, current-len(nodes))
+	for i := range nodes {
+		op.Nodes = append(op.Nodes, nodes[i].GetName())
+	}
+	return u.withScaleHooks(op, func() error {
+		if u.zeroOrMaxNodeScaling {
+			// all nodes are deleted together by scaling the node group to zero
+			return u.scaleNodeGroup(0)
+		}
+		nodes, placeholders := u.splitPlaceholders(nodes)
+		if placeholders > 0 {
+			// placeholders of nodes that node group failed to create are removed by decreasing node group size
+			if err := u.requestSize(max(u.targetSize()-placeholders, u.createdNodes())); err != nil {
+				return err
+			}
+		}
+		if len(nodes) == 0 {
+			return nil
+		}
+		deleted, err := u.deleteNodes(nodes, false)
+		if deleted == 0 {
 			return err
 		}
-		u.size = nodeGroup.Count
+		nodeGroup, waitErr := u.waitNodeGroupState(u.lifecycle.context(), upcloud.KubernetesNodeGroupStateRunning, timeoutWaitNodeGroupState)
+		if waitErr != nil {
+			return errors.Join(err, waitErr)
+		}
+		u.setTargetSize(nodeGroup.Count)
+		return err
+	})
+}
+
+// ForceDeleteNodes deletes nodes from the group regardless of constraints. Nodes whose server is already gone
+// are tolerated, and the method doesn't wait for the node group to become running, because stuck nodes may keep
+// the node group from reaching running state.
+func (u *upCloudNodeGroup) ForceDeleteNodes(nodes []*apiv1.Node) (err error) {
+	defer u.logOperation("ForceDeleteNodes", "nodes", len(nodes)).done(&err)
+	defer u.opLocks.lock(u.name)()
+
+	current := u.targetSize()
+	op := u.newScaleOperation(ScaleOperationForceDeleteNodes, current, max(current-len(nodes), 0))
+	for i := range nodes {
+		op.Nodes = append(op.Nodes, nodes[i].GetName())
+	}
+	return u.withScaleHooks(op, func() error {
+		nodes, placeholders := u.splitPlaceholders(nodes)
+		if placeholders > 0 {
+			if err := u.requestSize(max(u.targetSize()-placeholders, u.createdNodes())); err != nil {
+				return err
+			}
+		}
+		if len(nodes) == 0 {
+			return nil
+		}
+		deleted, err := u.deleteNodes(nodes, true)
+		if deleted > 0 {
+			// node group is listed on next refresh instead of waiting for it, nodes being deleted are not counted
+			u.setTargetSize(max(u.targetSize()-deleted, 0))
+			u.schedule.reset()
+		}
+		return err
+	})
+}
+
+// validateMembership returns an error if some of the nodes don't belong to the node group. Nodes are matched by
+// provider ID against cached nodes of the node group, and nodes that are not cached are checked from node group details
+// using provider ID or, if node doesn't have provider ID, node name.
+func (u *upCloudNodeGroup) validateMembership(nodes []*apiv1.Node) error {
+	u.mu.RLock()
+	cached := make(map[string]bool, len(u.nodes))
+	for _, i := range u.nodes {
+		cached[i.Id] = true
+	}
+	u.mu.RUnlock()
+
+	unknown := make([]*apiv1.Node, 0)
+	for _, n := range nodes {
+		if isPlaceholder(u.name, n.Spec.ProviderID) {
+			continue
+		}
+		if n.Spec.ProviderID == "" || !cached[n.Spec.ProviderID] {
+			unknown = append(unknown, n)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	details, err := u.nodeGroupDetails()
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]bool, len(details.Nodes))
+	names := make(map[string]bool, len(details.Nodes))
+	for _, n := range details.Nodes {
+		ids[providerIDPrefix+n.UUID] = true
+		names[n.Name] = true
+	}
+	for _, n := range unknown {
+		if n.Spec.ProviderID != "" && !ids[n.Spec.ProviderID] || n.Spec.ProviderID == "" && !names[n.GetName()] {
+			return fmt.Errorf("node %s doesn't belong to node group %s", n.GetName(), u.Id())
+		}
 	}
 	return nil
 }
 
+// validateZeroOrMaxSize returns an error if zero-or-max node group would be scaled to other size than max size
+func (u *upCloudNodeGroup) validateZeroOrMaxSize(current, size int) error {
+	if u.zeroOrMaxNodeScaling && size != u.MaxSize() {
+		return fmt.Errorf("failed to increase node group size, zero-or-max node group %s can only be scaled to max size, current=%d want=%d max=%d",
+			u.Id(), current, size, u.MaxSize())
+	}
+	return nil
+}
+
+// validateZeroOrMaxDeletion returns an error unless nodes include all created nodes of the node group, because
+// nodes of zero-or-max node group are deleted together
+func (u *upCloudNodeGroup) validateZeroOrMaxDeletion(nodes []*apiv1.Node) error {
+	if u.MinSize() > 0 {
+		return fmt.Errorf("failed to delete nodes, zero-or-max node group %s min size is %d", u.Id(), u.MinSize())
+	}
+	ids := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		ids[n.Spec.ProviderID] = true
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	for _, i := range u.nodes {
+		if !isPlaceholder(u.name, i.Id) && !ids[i.Id] {
+			return fmt.Errorf("failed to delete nodes, all nodes of zero-or-max node group %s must be deleted together, %s is missing", u.Id(), i.Id)
+		}
+	}
+	return nil
+}
+
+// splitPlaceholders returns nodes that are not placeholder instances and the number of placeholders
+func (u *upCloudNodeGroup) splitPlaceholders(nodes []*apiv1.Node) ([]*apiv1.Node, int) {
+	n := make([]*apiv1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !isPlaceholder(u.name, node.Spec.ProviderID) {
+			n = append(n, node)
+		}
+	}
+	return n, len(nodes) - len(n)
+}
+
+// createdNodes returns the number of cached nodes that are not placeholders
+func (u *upCloudNodeGroup) createdNodes() int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	created := 0
+	for _, n := range u.nodes {
+		if !isPlaceholder(u.name, n.Id) {
+			created++
+		}
+	}
+	return created
+}
+
+// deleteNodes deletes nodes concurrently and returns the number of deleted nodes. When tolerateMissing is set,
+// nodes that node group doesn't have are skipped without an error and they are not counted as deleted.
+func (u *upCloudNodeGroup) deleteNodes(nodes []*apiv1.Node, tolerateMissing bool) (int, error) {
+	names, err := u.upCloudNodeNames(nodes)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		deleted int
+		errs    []error
+	)
+	sem := make(chan struct{}, deleteNodesParallelism)
+	for _, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := u.deleteNode(name)
+			if err != nil && tolerateMissing && isNotFoundError(err) {
+				klog.V(logInfo).InfoS("node is already deleted", u.logValues("node", name)...)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, toAutoscalerError(err, "failed to delete node %s", name))
+				return
+			}
+			deleted++
+		}()
+	}
+	wg.Wait()
+	return deleted, errors.Join(errs...)
+}
+
+// upCloudNodeNames returns UpCloud node names of the nodes. Names are resolved from node group details by node UUID
+// of the provider ID, because Kubernetes node name may differ from UpCloud node name, e.g. when node has custom
+// hostname. Kubernetes node name is used when node doesn't have UpCloud provider ID or node group details don't
+// list the node UUID, e.g. because node is already deleted.
+func (u *upCloudNodeGroup) upCloudNodeNames(nodes []*apiv1.Node) ([]string, error) {
+	names := make([]string, len(nodes))
+	var byUUID map[string]string
+	for i, n := range nodes {
+		names[i] = n.GetName()
+		nodeUUID, ok := strings.CutPrefix(n.Spec.ProviderID, providerIDPrefix)
+		if !ok || nodeUUID == "" {
+			continue
+		}
+		if byUUID == nil {
+			details, err := u.nodeGroupDetails()
+			if err != nil {
+				return nil, err
+			}
+			byUUID = make(map[string]string, len(details.Nodes))
+			for _, d := range details.Nodes {
+				byUUID[d.UUID] = d.Name
+			}
+		}
+		if name, ok := byUUID[nodeUUID]; ok {
+			if name != names[i] {
+				klog.V(logInfo).InfoS("resolved UpCloud node name from provider ID", u.logValues("node", names[i], "upcloudNode", name)...)
+			}
+			names[i] = name
+		}
+	}
+	return names, nil
+}
+
 func (u *upCloudNodeGroup) deleteNode(nodeName string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutDeleteNode)
+	ctx, cancel := u.lifecycle.withTimeout(timeoutDeleteNode)
 	defer cancel()
-	klog.V(logInfo).Infof("deleting UpCloud %s/node %s", u.Id(), nodeName)
+	klog.V(logInfo).InfoS("deleting node", u.logValues("node", nodeName)...)
 	return u.svc.DeleteKubernetesNodeGroupNode(ctx, &request.DeleteKubernetesNodeGroupNodeRequest{
 		ClusterUUID: u.clusterID.String(),
 		Name:        u.name,
@@ -193,50 +598,83 @@ func (u *upCloudNodeGroup) deleteNode(nodeName string) error {
 // Other fields are optional.
 // This list should include also instances that might have not become a kubernetes node yet.
 func (u *upCloudNodeGroup) Nodes() ([]cloudprovider.Instance, error) {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.Nodes called", u.Id())
-	return u.nodes, nil
+	u.logOperation("Nodes")
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return append([]cloudprovider.Instance(nil), u.nodes...), nil
+}
+
+// inFlight returns true if node group has nodes that are not running yet or are being deleted
+func (u *upCloudNodeGroup) inFlight() bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	if len(u.nodes) != u.size {
+		return true
+	}
+	for _, n := range u.nodes {
+		if n.Status == nil || n.Status.State != cloudprovider.InstanceRunning || n.Status.ErrorInfo != nil {
+			return true
+		}
+	}
+	return false
 }
 
 // Autoprovisioned returns true if the node group is autoprovisioned. An autoprovisioned group
 // was created by CA and can be deleted when scaled to 0.
 func (u *upCloudNodeGroup) Autoprovisioned() bool {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.Autoprovisioned called", u.Id())
-	return false
+	u.logOperation("Autoprovisioned")
+	return u.autoprovisioned
 }
 
 // Create creates the node group on the cloud provider side. Implementation optional.
-func (u *upCloudNodeGroup) Create() (cloudprovider.NodeGroup, error) {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.Create called", u.Id())
-	return nil, cloudprovider.ErrNotImplemented
+func (u *upCloudNodeGroup) Create() (_ cloudprovider.NodeGroup, err error) {
+	defer u.logOperation("Create", "plan", u.plan).done(&err)
+	defer u.opLocks.lock(u.name)()
+	if u.Exist() {
+		return nil, fmt.Errorf("node group %s already exists", u.Id())
+	}
+	if err := u.create(); err != nil {
+		return nil, err
+	}
+	return u, nil
 }
 
 // Delete deletes the node group on the cloud provider side.
 // This will be executed only for autoprovisioned node groups, once their size drops to 0.
 // Implementation optional.
-func (u *upCloudNodeGroup) Delete() error {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.Delete called", u.Id())
-	return cloudprovider.ErrNotImplemented
+func (u *upCloudNodeGroup) Delete() (err error) {
+	defer u.logOperation("Delete").done(&err)
+	if !u.autoprovisioned {
+		return fmt.Errorf("node group %s is not autoprovisioned", u.Id())
+	}
+	defer u.opLocks.lock(u.name)()
+	return u.delete()
 }
 
 // GetOptions returns NodeGroupAutoscalingOptions that should be used for this particular
 // NodeGroup. Returning a nil will result in using default options.
 // Implementation optional.
-func (u *upCloudNodeGroup) GetOptions(_ config.NodeGroupAutoscalingOptions) (*config.NodeGroupAutoscalingOptions, error) {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.GetOptions called", u.Id())
-	return nil, cloudprovider.ErrNotImplemented
+// Options can be overridden using node group labels with autoscaler.upcloud.com/ prefix.
+func (u *upCloudNodeGroup) GetOptions(defaults config.NodeGroupAutoscalingOptions) (*config.NodeGroupAutoscalingOptions, error) {
+	u.logOperation("GetOptions")
+	opts := nodeGroupOptions(u.name, u.labels, defaults)
+	return &opts, nil
 }
 
 // Debug returns a string containing all information regarding this node group.
+// It's a JSON document of node group limits, plan, labels, taints, nodes and in-flight operations.
 func (u *upCloudNodeGroup) Debug() string {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.Debug called", u.Id())
-	return fmt.Sprintf("Node group ID: %s (min:%d max:%d)", u.Id(), u.MinSize(), u.MaxSize())
+	u.logOperation("Debug")
+	return debugJSON(u.debug())
 }
 
 // Exist checks if the node group really exists on the cloud provider side. Allows to tell the
 // theoretical node group from the real one. Implementation required.
 func (u *upCloudNodeGroup) Exist() bool {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.Exist called", u.Id())
-	return u.name != ""
+	u.logOperation("Exist")
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.name != "" && !u.theoretical
 }
 
 // TemplateNodeInfo returns a schedulerframework.NodeInfo structure of an empty
@@ -246,8 +684,15 @@ func (u *upCloudNodeGroup) Exist() bool {
 // capacity and allocatable information as well as all pods that are started on
 // the node by default, using manifest (most likely only kube-proxy). Implementation optional.
 func (u *upCloudNodeGroup) TemplateNodeInfo() (*schedulerframework.NodeInfo, error) {
-	klog.V(logDebug).Infof("UpCloud %s/NodeGroup.TemplateNodeInfo called", u.Id())
-	return nil, cloudprovider.ErrNotImplemented
+	u.logOperation("TemplateNodeInfo")
+	node, err := u.templateNode()
+	if err != nil {
+		return nil, err
+	}
+	pods := append([]*apiv1.Pod{cloudprovider.BuildKubeProxy(u.name)}, buildSystemPods(node.Name, u.systemPods)...)
+	nodeInfo := schedulerframework.NewNodeInfo(pods...)
+	nodeInfo.SetNode(node)
+	return nodeInfo, nil
 }
 
 // AtomicIncreaseSize tries to increase the size of the node group atomically.
@@ -260,6 +705,23 @@ func (u *upCloudNodeGroup) TemplateNodeInfo() (*schedulerframework.NodeInfo, err
 // Implementation is optional. If implemented, CA will take advantage of the method while scaling up
 // GenericScaleUp ProvisioningClass, guaranteeing that all instances required for such a ProvisioningRequest
 // are provisioned atomically.
-func (u *upCloudNodeGroup) AtomicIncreaseSize(_ int) error {
-	return cloudprovider.ErrNotImplemented
+func (u *upCloudNodeGroup) AtomicIncreaseSize(delta int) (err error) {
+	defer u.logOperation("AtomicIncreaseSize", "delta", delta).done(&err)
+	if delta <= 0 {
+		return fmt.Errorf("failed to increase node group size, delta=%d", delta)
+	}
+	defer u.opLocks.lock(u.name)()
+	current, size := u.increasedSize(delta)
+	if size > u.MaxSize() {
+		return fmt.Errorf("failed to increase node group size, current=%d want=%d max=%d", current, size, u.MaxSize())
+	}
+	if size <= current {
+		return nil
+	}
+	if err := u.validateZeroOrMaxSize(current, size); err != nil {
+		return err
+	}
+	return u.withScaleHooks(u.newScaleOperation(ScaleOperationIncreaseSize, current, size), func() error {
+		return u.atomicScaleUp(current, size)
+	})
 }
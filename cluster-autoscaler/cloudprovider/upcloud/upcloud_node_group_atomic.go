@@ -0,0 +1,159 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/klog/v2"
+)
+
+// atomicScaleUp scales node group to size and waits until all nodes are running. If nodes are not running
+// within provision time, nodes created by the scale-up are deleted. Caller must hold the node group
+// operation lock.
+func (u *upCloudNodeGroup) atomicScaleUp(current, size int) error {
+	before, err := u.nodeGroupDetails()
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]struct{}, len(before.Nodes))
+	for _, n := range before.Nodes {
+		existing[n.Name] = struct{}{}
+	}
+
+	ctx, cancel := u.lifecycle.withTimeout(timeoutModifyNodeGroup)
+	defer cancel()
+	klog.V(logInfo).InfoS("atomically scaling node group", u.logValues("from", current, "to", size)...)
+	if _, err := u.svc.ModifyKubernetesNodeGroup(ctx, &request.ModifyKubernetesNodeGroupRequest{
+		ClusterUUID: u.clusterID.String(),
+		Name:        u.name,
+		NodeGroup:   request.ModifyKubernetesNodeGroup{Count: size},
+	}); err != nil {
+		return toAutoscalerError(err, "failed to scale node group %s", u.name)
+	}
+
+	timeout := u.maxNodeProvisionTime
+	if timeout <= 0 {
+		timeout = timeoutWaitNodeGroupState
+	}
+	if err := u.waitRunningNodes(size, timeout); err != nil {
+		klog.ErrorS(err, "rolling back node group atomic scale-up", u.logValues()...)
+		if rollbackErr := u.rollbackScaleUp(existing, current); rollbackErr != nil {
+			return fmt.Errorf("atomic scale-up of node group %s failed: %w, rollback failed: %v", u.Id(), err, rollbackErr)
+		}
+		return fmt.Errorf("atomic scale-up of node group %s failed and was rolled back: %w", u.Id(), err)
+	}
+	u.setTargetSize(size)
+	return nil
+}
+
+// waitRunningNodes waits until node group is running with at least size running nodes. Waiting is stopped when
+// the provider is cleaned up.
+func (u *upCloudNodeGroup) waitRunningNodes(size int, timeout time.Duration) error {
+	ctx, cancel := u.lifecycle.withTimeout(timeout)
+	defer cancel()
+	backoff := nodeGroupStateBackoff
+	u.watch.start(u.name)
+	defer u.watch.stop(u.name)
+	running := 0
+	for i := 1; ; i++ {
+		reqCtx, reqCancel := context.WithTimeout(ctx, timeoutGetRequest)
+		g, err := u.svc.GetKubernetesNodeGroup(reqCtx, &request.GetKubernetesNodeGroupRequest{
+			ClusterUUID: u.clusterID.String(),
+			Name:        u.name,
+		})
+		reqCancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("%d/%d nodes running when node check (%d) stopped, %w", running, size, i, ctx.Err())
+			}
+			return fmt.Errorf("failed to fetch node group %s, %w", u.Id(), err)
+		}
+		u.watch.observe(g)
+		if g.State == upcloud.KubernetesNodeGroupStateFailed {
+			return fmt.Errorf("node group %s is in %s state", u.Id(), g.State)
+		}
+		running = 0
+		for _, n := range g.Nodes {
+			switch n.State {
+			case upcloud.KubernetesNodeStateRunning:
+				running++
+			case upcloud.KubernetesNodeStateFailed:
+				return fmt.Errorf("node %s is in %s state", n.Name, n.State)
+			}
+		}
+		if g.State == upcloud.KubernetesNodeGroupStateRunning && running >= size {
+			return nil
+		}
+		delay := backoff.Step()
+		klog.V(logInfo).InfoS("waiting node group nodes running", u.logValues("running", running, "size", size, "state", g.State, "check", i, "nextCheck", delay)...)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d/%d nodes running when node check (%d) stopped, %w", running, size, i, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// rollbackScaleUp deletes nodes that are not in existing nodes and makes sure that node group size is restored
+func (u *upCloudNodeGroup) rollbackScaleUp(existing map[string]struct{}, size int) error {
+	g, err := u.nodeGroupDetails()
+	if err != nil {
+		return err
+	}
+	for _, n := range g.Nodes {
+		if _, ok := existing[n.Name]; ok {
+			continue
+		}
+		if err := u.deleteNode(n.Name); err != nil {
+			return err
+		}
+	}
+	if g, err = u.nodeGroupDetails(); err != nil {
+		return err
+	}
+	if g.Count > size {
+		ctx, cancel := u.lifecycle.withTimeout(timeoutModifyNodeGroup)
+		defer cancel()
+		if _, err := u.svc.ModifyKubernetesNodeGroup(ctx, &request.ModifyKubernetesNodeGroupRequest{
+			ClusterUUID: u.clusterID.String(),
+			Name:        u.name,
+			NodeGroup:   request.ModifyKubernetesNodeGroup{Count: size},
+		}); err != nil {
+			return toAutoscalerError(err, "failed to scale node group %s", u.name)
+		}
+	}
+	u.setTargetSize(size)
+	return nil
+}
+
+func (u *upCloudNodeGroup) nodeGroupDetails() (*upcloud.KubernetesNodeGroupDetails, error) {
+	ctx, cancel := u.lifecycle.withTimeout(timeoutGetRequest)
+	defer cancel()
+	g, err := u.svc.GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{
+		ClusterUUID: u.clusterID.String(),
+		Name:        u.name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch node group %s, %w", u.Id(), err)
+	}
+	return g, nil
+}
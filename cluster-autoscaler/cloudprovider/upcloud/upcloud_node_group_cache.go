@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+)
+
+// nodeGroupCache caches node group details between refreshes, so that steady-state refresh only needs to list node groups.
+// Nil cache doesn't cache anything.
+type nodeGroupCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]nodeGroupCacheEntry
+}
+
+type nodeGroupCacheEntry struct {
+	details   *upcloud.KubernetesNodeGroupDetails
+	fetchedAt time.Time
+}
+
+func newNodeGroupCache(ttl time.Duration) *nodeGroupCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &nodeGroupCache{ttl: ttl, entries: make(map[string]nodeGroupCacheEntry)}
+}
+
+// get returns cached details of the listed node group. Details are not returned if they are older than TTL,
+// node group is not running or listed node group doesn't match the cached details, e.g. when node group
+// has been scaled outside of the autoscaler.
+func (c *nodeGroupCache) get(g sdkext.KubernetesNodeGroup) (*upcloud.KubernetesNodeGroupDetails, bool) {
+	if c == nil || g.State != upcloud.KubernetesNodeGroupStateRunning {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[g.Name]
+	if !ok || time.Since(e.fetchedAt) >= c.ttl || e.details.State != g.State || e.details.Count != g.Count {
+		return nil, false
+	}
+	return e.details, true
+}
+
+// set caches node group details
+func (c *nodeGroupCache) set(details *upcloud.KubernetesNodeGroupDetails) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[details.Name] = nodeGroupCacheEntry{details: details, fetchedAt: time.Now()}
+}
+
+// invalidate removes node group from the cache, which is needed after operations that change the node group
+func (c *nodeGroupCache) invalidate(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, name)
+}
+
+// retain removes node groups that are not listed anymore
+func (c *nodeGroupCache) retain(groups []sdkext.KubernetesNodeGroup) {
+	if c == nil {
+		return
+	}
+	names := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		names[g.Name] = struct{}{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range c.entries {
+		if _, ok := names[name]; !ok {
+			delete(c.entries, name)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// autoDiscoveryLabelPrefix is the prefix of --node-group-auto-discovery specs that select node groups by labels
+	autoDiscoveryLabelPrefix string = "label:"
+
+	// Node group labels that override size limits of discovered node groups
+	labelMinSize string = labelPrefix + "min-size"
+	labelMaxSize string = labelPrefix + "max-size"
+
+	// labelEnabled set to false excludes the node group from autoscaling, e.g. manually managed GPU or system node groups
+	labelEnabled string = labelPrefix + "enabled"
+)
+
+// labelSelector matches node groups that have all the labels
+type labelSelector map[string]string
+
+func (s labelSelector) matches(labels map[string]string) bool {
+	for k, v := range s {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAutoDiscoverySpecs parses node group auto-discovery specs in format label:<key>=<value>[,<key>=<value>]
+func parseAutoDiscoverySpecs(specs []string) ([]labelSelector, error) {
+	selectors := make([]labelSelector, 0, len(specs))
+	for _, spec := range specs {
+		labels, ok := strings.CutPrefix(spec, autoDiscoveryLabelPrefix)
+		if !ok || labels == "" {
+			return nil, fmt.Errorf("failed to parse node group auto-discovery spec %s, format should be `label:<key>=<value>[,<key>=<value>]`", spec)
+		}
+		selector := make(labelSelector)
+		for _, label := range strings.Split(labels, ",") {
+			k, v, ok := strings.Cut(label, "=")
+			if !ok || k == "" {
+				return nil, fmt.Errorf("failed to parse node group auto-discovery spec %s, label %s should be in format `<key>=<value>`", spec, label)
+			}
+			selector[k] = v
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+// discovered returns whether node group labels match any of the selectors. All node groups are discovered
+// when there are no selectors.
+func discovered(selectors []labelSelector, labels map[string]string) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+	for _, s := range selectors {
+		if s.matches(labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// optedOut returns whether node group is excluded from autoscaling with labelEnabled. Invalid values are logged and
+// ignored.
+func optedOut(name string, labels map[string]string) bool {
+	value, ok := labels[labelEnabled]
+	if !ok {
+		return false
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		klog.Warningf("ignoring node group %s label %s: %v", name, labelEnabled, err)
+		return false
+	}
+	return !enabled
+}
+
+// Sources of node group size limits
+const (
+	limitSourceDefault      string = "default"
+	limitSourceLabel        string = "label"
+	limitSourceSpec         string = "--nodes"
+	limitSourceAntiAffinity string = "anti-affinity"
+)
+
+// nodeGroupSizeLimits returns minSize and maxSize overridden by node group labels. Invalid values are logged and ignored.
+// Limits are only validated if node group has size labels, so that default limits are never ignored.
+func nodeGroupSizeLimits(name string, labels map[string]string, minSize, maxSize, maxNodesTotal int) (int, int) {
+	newMin, newMax := minSize, maxSize
+	parsed := false
+	for key, v := range map[string]*int{labelMinSize: &newMin, labelMaxSize: &newMax} {
+		value, ok := labels[key]
+		if !ok {
+			continue
+		}
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			klog.Warningf("ignoring node group %s label %s: %v", name, key, err)
+			continue
+		}
+		*v = i
+		parsed = true
+	}
+	if !parsed {
+		return minSize, maxSize
+	}
+	if newMin < 0 || newMax > maxNodesTotal || newMin > newMax {
+		klog.Warningf("ignoring node group %s size limits min=%d max=%d, limits should be between 0 and %d",
+			name, newMin, newMax, maxNodesTotal)
+		return minSize, maxSize
+	}
+	return newMin, newMax
+}
+
+// nodeGroupSizeDefaults are size limits of node groups that --nodes specs and node group labels don't set
+type nodeGroupSizeDefaults struct {
+	minSize int
+	// maxSize is the default max size, zero uses the cluster plan maximum
+	maxSize int
+}
+
+// limits returns default min and max size of node groups. Nil defaults use nodeGroupMinSize and the cluster plan
+// maximum.
+func (d *nodeGroupSizeDefaults) limits(maxNodesTotal int) (int, int) {
+	if d == nil {
+		return nodeGroupMinSize, maxNodesTotal
+	}
+	if d.maxSize == 0 {
+		return d.minSize, maxNodesTotal
+	}
+	return d.minSize, d.maxSize
+}
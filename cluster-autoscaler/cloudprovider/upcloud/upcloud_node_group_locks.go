@@ -0,0 +1,42 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import "sync"
+
+// nodeGroupLocks serializes operations that change node group size by node group name. It's owned by the manager and
+// shared by its node groups, so that operations of a node group stay serialized when refresh replaces the node group
+// objects. Locks of deleted node groups are kept, so that a node group created again with the same name uses the same
+// lock. Nil nodeGroupLocks doesn't serialize operations.
+type nodeGroupLocks struct {
+	locks sync.Map
+}
+
+func newNodeGroupLocks() *nodeGroupLocks {
+	return &nodeGroupLocks{}
+}
+
+// lock locks operations of the node group and returns function that unlocks them
+func (l *nodeGroupLocks) lock(name string) func() {
+	if l == nil {
+		return func() {}
+	}
+	v, _ := l.locks.LoadOrStore(name, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/klog/v2"
+)
+
+// Node group labels that override autoscaling options of the node group
+const (
+	labelPrefix string = "autoscaler.upcloud.com/"
+
+	labelScaleDownUtilizationThreshold    string = labelPrefix + "scale-down-utilization-threshold"
+	labelScaleDownGpuUtilizationThreshold string = labelPrefix + "scale-down-gpu-utilization-threshold"
+	labelScaleDownUnneededTime            string = labelPrefix + "scale-down-unneeded-time"
+	labelScaleDownUnreadyTime             string = labelPrefix + "scale-down-unready-time"
+	labelMaxNodeProvisionTime             string = labelPrefix + "max-node-provision-time"
+	labelIgnoreDaemonSetsUtilization      string = labelPrefix + "ignore-daemonsets-utilization"
+	labelScaleDownDisabled                string = labelPrefix + "scale-down-disabled"
+	labelZeroOrMaxNodeScaling             string = labelPrefix + "zero-or-max-node-scaling"
+)
+
+// scaleDownDisabledTime is the unneeded and unready time of node groups with scale-down disabled, nodes are never
+// considered unneeded or unready long enough to be removed
+const scaleDownDisabledTime time.Duration = math.MaxInt64
+
+func nodeGroupLabels(labels []upcloud.Label) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(labels))
+	for _, l := range labels {
+		m[l.Key] = l.Value
+	}
+	return m
+}
+
+// nodeGroupOptions returns defaults overridden by node group labels. Invalid values are logged and ignored.
+func nodeGroupOptions(name string, labels map[string]string, defaults config.NodeGroupAutoscalingOptions) config.NodeGroupAutoscalingOptions {
+	opts := defaults
+	parsers := map[string]func(string) error{
+		labelScaleDownUtilizationThreshold:    ratioOption(&opts.ScaleDownUtilizationThreshold),
+		labelScaleDownGpuUtilizationThreshold: ratioOption(&opts.ScaleDownGpuUtilizationThreshold),
+		labelScaleDownUnneededTime:            durationOption(&opts.ScaleDownUnneededTime),
+		labelScaleDownUnreadyTime:             durationOption(&opts.ScaleDownUnreadyTime),
+		labelMaxNodeProvisionTime:             durationOption(&opts.MaxNodeProvisionTime),
+		labelIgnoreDaemonSetsUtilization:      boolOption(&opts.IgnoreDaemonSetsUtilization),
+		labelZeroOrMaxNodeScaling:             boolOption(&opts.ZeroOrMaxNodeScaling),
+	}
+	for key, parse := range parsers {
+		value, ok := labels[key]
+		if !ok {
+			continue
+		}
+		if err := parse(value); err != nil {
+			klog.Warningf("ignoring node group %s label %s: %v", name, key, err)
+		}
+	}
+	// disabled scale-down takes precedence over the scale-down times set with labels
+	var disabled bool
+	if value, ok := labels[labelScaleDownDisabled]; ok {
+		if err := boolOption(&disabled)(value); err != nil {
+			klog.Warningf("ignoring node group %s label %s: %v", name, labelScaleDownDisabled, err)
+		}
+	}
+	if disabled {
+		opts.ScaleDownUnneededTime = scaleDownDisabledTime
+		opts.ScaleDownUnreadyTime = scaleDownDisabledTime
+	}
+	return opts
+}
+
+func ratioOption(v *float64) func(string) error {
+	return func(s string) error {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		if f < 0 || f > 1 {
+			return fmt.Errorf("value %s is not between 0 and 1", s)
+		}
+		*v = f
+		return nil
+	}
+}
+
+func durationOption(v *time.Duration) func(string) error {
+	return func(s string) error {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("duration %s is not positive", s)
+		}
+		*v = d
+		return nil
+	}
+}
+
+func boolOption(v *bool) func(string) error {
+	return func(s string) error {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*v = b
+		return nil
+	}
+}
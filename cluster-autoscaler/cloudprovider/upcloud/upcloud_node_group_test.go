@@ -17,15 +17,29 @@ limitations under the License.
 package upcloud
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/mocks"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/core/utils"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/gpu"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/taints"
 )
 
 func TestUpCloudNodeGroup_Id(t *testing.T) {
@@ -60,39 +74,256 @@ func TestUpCloudNodeGroup_TargetSize(t *testing.T) {
 
 func TestUpCloudNodeGroup_IncreaseSize(t *testing.T) {
 	t.Parallel()
+
 	clusterID := uuid.New()
-	svc := newMockService(clusterID)
-	g := &upCloudNodeGroup{size: 1, maxSize: 20, name: "group1", svc: svc, clusterID: clusterID}
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(1)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	g := newTestNodeGroup(clusterID, svc, fixture)
 	require.NoError(t, g.IncreaseSize(1))
 	size, _ := g.TargetSize()
 	require.Equal(t, 2, size)
 }
 
+func TestUpCloudNodeGroup_IncreaseSizeAsync(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(1)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	svc.SetFaults(mocks.Faults{ProvisioningTimes: map[string]time.Duration{"": time.Hour}})
+	g := newTestNodeGroup(clusterID, svc, fixture)
+
+	start := time.Now()
+	require.NoError(t, g.IncreaseSize(2))
+	require.Less(t, time.Since(start), timeoutModifyNodeGroup)
+	require.Equal(t, 3, g.targetSize())
+	nodes, err := g.Nodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 3)
+	require.Equal(t, cloudprovider.InstanceRunning, nodes[0].Status.State)
+	for i, n := range nodes[1:] {
+		require.Equal(t, fmt.Sprintf("%sgroup1/%d", placeholderIDPrefix, i+1), n.Id)
+		require.Equal(t, cloudprovider.InstanceCreating, n.Status.State)
+	}
+
+	// next scale-up counts the placeholders instead of requesting the same nodes again
+	require.NoError(t, g.IncreaseSize(1))
+	require.Equal(t, 4, g.targetSize())
+	nodes, err = g.Nodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 4)
+	require.Equal(t, placeholderIDPrefix+"group1/3", nodes[3].Id)
+}
+
+func TestWithPlaceholders(t *testing.T) {
+	t.Parallel()
+
+	running := cloudprovider.Instance{Id: providerIDPrefix + "1", Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceRunning}}
+	nodes := withPlaceholders("group1", []cloudprovider.Instance{running}, 3, nil)
+	require.Len(t, nodes, 3)
+	require.Equal(t, running, nodes[0])
+	require.Equal(t, placeholderIDPrefix+"group1/2", nodes[2].Id)
+
+	// placeholders are replaced by listed nodes
+	pending := cloudprovider.Instance{Id: providerIDPrefix + "2", Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceCreating}}
+	nodes = withPlaceholders("group1", append(nodes, pending), 3, nil)
+	require.Len(t, nodes, 3)
+	require.Equal(t, []cloudprovider.Instance{running, pending}, nodes[:2])
+	require.Equal(t, placeholderIDPrefix+"group1/2", nodes[2].Id)
+
+	// placeholders are removed when size decreases
+	require.Equal(t, []cloudprovider.Instance{running, pending}, withPlaceholders("group1", nodes, 1, nil))
+}
+
 func TestUpCloudNodeGroup_DecreaseTargetSize(t *testing.T) {
 	t.Parallel()
 
 	clusterID := uuid.New()
-	svc := newMockService(clusterID)
-	g := &upCloudNodeGroup{size: 3, maxSize: 20, name: "group2", svc: svc, clusterID: clusterID}
-	require.NoError(t, g.DecreaseTargetSize(-1))
+	fixture := mocks.NewTestNodeGroup("group2").WithNodes(3)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	svc.SetFaults(mocks.Faults{FailedScaleUps: map[string]bool{"group2": true}})
+	g := newTestNodeGroup(clusterID, svc, fixture)
+	require.NoError(t, g.IncreaseSize(2))
+
+	// provisioned nodes are not deleted even if cached nodes are outdated
+	g.mu.Lock()
+	g.nodes = nil
+	g.mu.Unlock()
+	require.Error(t, g.DecreaseTargetSize(-3))
+	require.NoError(t, g.DecreaseTargetSize(-2))
 	size, _ := g.TargetSize()
-	require.Equal(t, 2, size)
+	require.Equal(t, 3, size)
+	details, err := g.nodeGroupDetails()
+	require.NoError(t, err)
+	require.Len(t, details.Nodes, 3)
 }
 
 func TestUpCloudNodeGroup_DeleteNodes(t *testing.T) {
 	t.Parallel()
 
 	clusterID := uuid.New()
-	svc := newMockService(clusterID)
-	kng := svc.Clusters[clusterID.String()].NodeGroups[0]
-	g := &upCloudNodeGroup{size: kng.Count, maxSize: 20, name: kng.Name, svc: svc, clusterID: clusterID}
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(2)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	g := newTestNodeGroup(clusterID, svc, fixture)
 	size, _ := g.TargetSize()
-	require.Equal(t, kng.Count, size)
+	require.Equal(t, 2, size)
 	require.NoError(t, g.DeleteNodes([]*v1.Node{
 		{ObjectMeta: metav1.ObjectMeta{Name: "group1-node-1"}},
 	}))
 	size, _ = g.TargetSize()
-	require.Equal(t, kng.Count-1, size)
+	require.Equal(t, 1, size)
+}
+
+func TestUpCloudNodeGroup_DeleteNodesByProviderID(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(3)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	g := newTestNodeGroup(clusterID, svc, fixture)
+
+	// UpCloud node name is resolved from provider ID when Kubernetes node has custom hostname
+	require.NoError(t, g.DeleteNodes([]*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "custom-hostname"},
+		Spec:       v1.NodeSpec{ProviderID: providerIDPrefix + "group1-1"},
+	}}))
+	require.Equal(t, 2, g.targetSize())
+	details, err := g.nodeGroupDetails()
+	require.NoError(t, err)
+	for _, n := range details.Nodes {
+		require.NotEqual(t, "group1-node-1", n.Name)
+	}
+
+	// Kubernetes node name is used when provider ID is not listed
+	names, err := g.upCloudNodeNames([]*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "group1-node-0"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "group1-node-1"}, Spec: v1.NodeSpec{ProviderID: providerIDPrefix + "group1-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "custom-hostname"}, Spec: v1.NodeSpec{ProviderID: providerIDPrefix + "group1-2"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"group1-node-0", "group1-node-1", "group1-node-2"}, names)
+}
+
+func TestUpCloudNodeGroup_DeleteNodesBatch(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(10)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	g := newTestNodeGroup(clusterID, svc, fixture)
+	nodes := make([]*v1.Node, 0)
+	for i := 0; i < 8; i++ {
+		nodes = append(nodes, &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("group1-node-%d", i)},
+			Spec:       v1.NodeSpec{ProviderID: fmt.Sprintf("%sgroup1-%d", providerIDPrefix, i)},
+		})
+	}
+	require.NoError(t, g.DeleteNodes(nodes[:6]))
+	require.Equal(t, 4, g.targetSize())
+
+	// size is updated from the final state when some of the deletions fail, e.g. because cached node was
+	// already deleted
+	require.NoError(t, svc.DeleteKubernetesNodeGroupNode(context.Background(), &request.DeleteKubernetesNodeGroupNodeRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+		NodeName:    "group1-node-7",
+	}))
+	require.ErrorContains(t, g.DeleteNodes(nodes[6:8]), "group1-node-7")
+	require.Equal(t, 2, g.targetSize())
+}
+
+func TestUpCloudNodeGroup_ForceDeleteNodes(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(3)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	// node group stuck in pending state doesn't block force deletion
+	svc.SetFaults(mocks.Faults{NodeGroupStates: map[string][]upcloud.KubernetesNodeGroupState{
+		"group1": {upcloud.KubernetesNodeGroupStatePending},
+	}})
+	g := newTestNodeGroup(clusterID, svc, fixture)
+
+	// node whose server is already gone is tolerated
+	require.NoError(t, svc.DeleteKubernetesNodeGroupNode(context.Background(), &request.DeleteKubernetesNodeGroupNodeRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+		NodeName:    "group1-node-2",
+	}))
+	start := time.Now()
+	require.NoError(t, g.ForceDeleteNodes([]*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "group1-node-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "group1-node-2"}},
+	}))
+	require.Less(t, time.Since(start), timeoutWaitNodeGroupState)
+	require.Equal(t, 2, g.targetSize())
+	details, err := g.nodeGroupDetails()
+	require.NoError(t, err)
+	require.Len(t, details.Nodes, 1)
+
+	// other errors are returned
+	svc.SetFaults(mocks.Faults{ErrorRate: 1, ErrorStatus: http.StatusForbidden})
+	require.Error(t, g.ForceDeleteNodes([]*v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "group1-node-0"}}}))
+}
+
+func TestUpCloudNodeGroup_DeleteNodesMembership(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	group1 := mocks.NewTestNodeGroup("group1").WithNodes(2)
+	group2 := mocks.NewTestNodeGroup("group2").WithNodes(2)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(group1, group2).Service()
+	g := newTestNodeGroup(clusterID, svc, group1)
+
+	foreign := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "group2-node-0"},
+		Spec:       v1.NodeSpec{ProviderID: providerIDPrefix + "group2-0"},
+	}
+	require.ErrorContains(t, g.DeleteNodes([]*v1.Node{foreign}), "doesn't belong to node group")
+	// foreign node with matching name is refused by provider ID
+	foreign.Name = "group1-node-0"
+	require.ErrorContains(t, g.DeleteNodes([]*v1.Node{foreign}), "doesn't belong to node group")
+	require.ErrorContains(t, g.DeleteNodes([]*v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "group2-node-1"}}}), "doesn't belong to node group")
+	require.Equal(t, 2, g.targetSize())
+
+	// node missing from cached nodes is checked from node group details
+	g.nodes = nil
+	require.NoError(t, g.DeleteNodes([]*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "group1-node-1"},
+		Spec:       v1.NodeSpec{ProviderID: providerIDPrefix + "group1-1"},
+	}}))
+	require.Equal(t, 1, g.targetSize())
+}
+
+func TestUpCloudNodeGroup_WaitNodeGroupState(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(1)
+	mock := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	svc := &detailsCountingService{upCloudService: mock}
+	g := newTestNodeGroup(clusterID, svc, fixture)
+
+	mock.SetFaults(mocks.Faults{NodeGroupStates: map[string][]upcloud.KubernetesNodeGroupState{
+		"group1": {upcloud.KubernetesNodeGroupStatePending, upcloud.KubernetesNodeGroupStateScalingUp, upcloud.KubernetesNodeGroupStateRunning},
+	}})
+	start := time.Now()
+	details, err := g.waitNodeGroupState(context.Background(), upcloud.KubernetesNodeGroupStateRunning, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, upcloud.KubernetesNodeGroupStateRunning, details.State)
+	require.Equal(t, 3, svc.detailCalls())
+	// delay grows from the initial delay, jitter only adds to it
+	require.GreaterOrEqual(t, time.Since(start), 3*nodeGroupStateBackoffInitial)
+
+	// cancellation stops polling between checks
+	mock.SetFaults(mocks.Faults{NodeGroupStates: map[string][]upcloud.KubernetesNodeGroupState{
+		"group1": {upcloud.KubernetesNodeGroupStatePending},
+	}})
+	ctx, cancel := context.WithTimeout(context.Background(), nodeGroupStateBackoffInitial/2)
+	defer cancel()
+	_, err = g.waitNodeGroupState(ctx, upcloud.KubernetesNodeGroupStateRunning, time.Minute)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 4, svc.detailCalls())
 }
 
 func TestUpCloudNodeGroup_Nodes(t *testing.T) {
@@ -114,35 +345,104 @@ func TestUpCloudNodeGroup_Autoprovisioned(t *testing.T) {
 	require.False(t, g.Autoprovisioned())
 }
 
-func TestUpCloudNodeGroup_Create(t *testing.T) {
+func TestUpCloudNodeGroup_GetOptions(t *testing.T) {
 	t.Parallel()
 
+	defaults := config.NodeGroupAutoscalingOptions{
+		ScaleDownUtilizationThreshold:    0.5,
+		ScaleDownGpuUtilizationThreshold: 0.5,
+		ScaleDownUnneededTime:            10 * time.Minute,
+		ScaleDownUnreadyTime:             20 * time.Minute,
+		MaxNodeProvisionTime:             15 * time.Minute,
+	}
 	g := &upCloudNodeGroup{}
-	_, err := g.Create()
-	require.ErrorIs(t, err, cloudprovider.ErrNotImplemented)
-}
+	got, err := g.GetOptions(defaults)
+	require.NoError(t, err)
+	require.Equal(t, defaults, *got)
 
-func TestUpCloudNodeGroup_Delete(t *testing.T) {
-	t.Parallel()
+	clusterID := uuid.New()
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(1).
+		WithLabel(labelScaleDownUtilizationThreshold, "0.3").
+		WithLabel(labelScaleDownGpuUtilizationThreshold, "1.5").
+		WithLabel(labelScaleDownUnneededTime, "5m").
+		WithLabel(labelScaleDownUnreadyTime, "-1m").
+		WithLabel(labelMaxNodeProvisionTime, "invalid").
+		WithLabel(labelIgnoreDaemonSetsUtilization, "true")
+	m := &manager{clusterID: clusterID, svc: mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()}
+	require.NoError(t, m.refresh())
+	got, err = m.getNodeGroups()[0].GetOptions(defaults)
+	require.NoError(t, err)
+	want := defaults
+	want.ScaleDownUtilizationThreshold = 0.3
+	want.ScaleDownUnneededTime = 5 * time.Minute
+	want.IgnoreDaemonSetsUtilization = true
+	require.Equal(t, want, *got)
+
+	// disabled scale-down overrides scale-down times, invalid value is ignored
+	labels := map[string]string{labelScaleDownDisabled: "true", labelScaleDownUnneededTime: "5m"}
+	got, err = (&upCloudNodeGroup{labels: labels}).GetOptions(defaults)
+	require.NoError(t, err)
+	want = defaults
+	want.ScaleDownUnneededTime = scaleDownDisabledTime
+	want.ScaleDownUnreadyTime = scaleDownDisabledTime
+	require.Equal(t, want, *got)
+	require.False(t, time.Now().Add(-24*time.Hour).Add(got.ScaleDownUnneededTime).Before(time.Now()))
 
-	g := &upCloudNodeGroup{}
-	err := g.Delete()
-	require.ErrorIs(t, err, cloudprovider.ErrNotImplemented)
+	got, err = (&upCloudNodeGroup{labels: map[string]string{labelScaleDownDisabled: "maybe"}}).GetOptions(defaults)
+	require.NoError(t, err)
+	require.Equal(t, defaults, *got)
 }
 
-func TestUpCloudNodeGroup_GetOptions(t *testing.T) {
+func TestUpCloudNodeGroup_Debug(t *testing.T) {
 	t.Parallel()
 
-	g := &upCloudNodeGroup{}
-	_, err := g.GetOptions(config.NodeGroupAutoscalingOptions{})
-	require.ErrorIs(t, err, cloudprovider.ErrNotImplemented)
+	g := &upCloudNodeGroup{name: "test"}
+	require.NotEmpty(t, g.Debug())
+
+	clusterID := uuid.New()
+	svc := newMockService(clusterID)
+	g = newTestNodeGroup(clusterID, svc, mocks.NewTestNodeGroup("group1").WithNodes(2))
+	g.labels = map[string]string{"role": "test"}
+	g.plan = "2xCPU-4GB"
+	g.pending = newPendingSizes()
+	require.NoError(t, g.IncreaseSize(1))
+
+	var d nodeGroupDebug
+	require.NoError(t, json.Unmarshal([]byte(g.Debug()), &d))
+	require.Equal(t, g.Id(), d.ID)
+	require.Equal(t, 3, d.TargetSize)
+	require.True(t, d.Exists)
+	require.Equal(t, planDebug{Name: "2xCPU-4GB", Cores: 2, MemoryMiB: 4096, StorageGiB: 80}, d.Plan)
+	require.Equal(t, g.labels, d.Labels)
+	require.Len(t, d.Nodes, 3)
+	require.Equal(t, "running", d.Nodes[0].State)
+	require.Equal(t, "creating", d.Nodes[2].State)
+	require.NotNil(t, d.InFlight)
+	require.Equal(t, 3, *d.InFlight.RequestedSize)
+	require.Equal(t, 1, d.InFlight.Placeholders)
 }
 
-func TestUpCloudNodeGroup_Debug(t *testing.T) {
+func TestUpCloudCloudProvider_Debug(t *testing.T) {
 	t.Parallel()
 
-	g := &upCloudNodeGroup{name: "test"}
-	require.NotEmpty(t, g.Debug())
+	clusterID := uuid.New()
+	m, err := newManager(context.Background(), newMockService(clusterID), upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{
+		NodeGroupSpecs: []string{"1:5:group2", "1:3:group1"},
+	})
+	require.NoError(t, err)
+	p := &upCloudCloudProvider{manager: m}
+	require.NoError(t, p.Refresh())
+
+	var d providerDebug
+	require.NoError(t, json.Unmarshal([]byte(p.Debug()), &d))
+	require.Equal(t, clusterID.String(), d.ClusterID)
+	require.Equal(t, mocks.TestZone, d.Zone)
+	require.Equal(t, []string{"1:3:group1", "1:5:group2"}, d.NodeGroupSpecs)
+	require.Equal(t, "healthy", d.Health)
+	require.Len(t, d.NodeGroups, 2)
+	require.Nil(t, d.NodeGroups[0].InFlight)
+
+	require.Equal(t, "null", (&upCloudCloudProvider{}).Debug())
 }
 
 func TestUpCloudNodeGroup_Exist(t *testing.T) {
@@ -155,14 +455,419 @@ func TestUpCloudNodeGroup_Exist(t *testing.T) {
 func TestUpCloudNodeGroup_TemplateNodeInfo(t *testing.T) {
 	t.Parallel()
 
-	g := &upCloudNodeGroup{}
+	g := &upCloudNodeGroup{name: "custom", plan: "custom"}
 	_, err := g.TemplateNodeInfo()
-	require.ErrorIs(t, err, cloudprovider.ErrNotImplemented)
+	require.Error(t, err)
+
+	g = &upCloudNodeGroup{
+		name:   "gpu",
+		plan:   "GPU-8xCPU-64GB-1xL40S",
+		zone:   mocks.TestZone,
+		labels: map[string]string{"role": "ml"},
+		taints: []v1.Taint{{Key: "nvidia.com/gpu", Effect: v1.TaintEffectNoSchedule}},
+	}
+	nodeInfo, err := g.TemplateNodeInfo()
+	require.NoError(t, err)
+	node := nodeInfo.Node()
+	require.Len(t, nodeInfo.Pods, 1)
+	require.Equal(t, "8", node.Status.Capacity.Cpu().String())
+	require.Equal(t, "64Gi", node.Status.Capacity.Memory().String())
+	// 90m tiered CPU reservation, 5.48GiB tiered memory reservation and 100Mi eviction threshold
+	require.Equal(t, "7910m", node.Status.Allocatable.Cpu().String())
+	require.InDelta(t, 64<<30-5.48*(1<<30)-100<<20, node.Status.Allocatable.Memory().Value(), 1)
+	gpus := node.Status.Allocatable[gpu.ResourceNvidiaGPU]
+	require.Equal(t, int64(1), gpus.Value())
+	require.Equal(t, "NVIDIA-L40S", node.Labels[gpuLabel])
+	require.Equal(t, "ml", node.Labels["role"])
+	require.Equal(t, "GPU-8xCPU-64GB-1xL40S", node.Labels[v1.LabelInstanceTypeStable])
+	require.Equal(t, mocks.TestZone, node.Labels[v1.LabelTopologyZone])
+	require.Equal(t, mocks.TestZone, node.Labels[v1.LabelTopologyRegion])
+	require.Equal(t, cloudprovider.DefaultArch, node.Labels[v1.LabelArchStable])
+	require.Equal(t, cloudprovider.DefaultOS, node.Labels[v1.LabelOSStable])
+	require.Equal(t, g.taints, node.Spec.Taints)
+	_, ok := node.Status.Capacity[v1.ResourceEphemeralStorage]
+	require.False(t, ok, "GPU plan storage size is not known")
+
+	g = &upCloudNodeGroup{name: "storage", plan: "2xCPU-4GB"}
+	nodeInfo, err = g.TemplateNodeInfo()
+	require.NoError(t, err)
+	require.Equal(t, "80Gi", nodeInfo.Node().Status.Capacity.StorageEphemeral().String())
+	require.Equal(t, "72Gi", nodeInfo.Node().Status.Allocatable.StorageEphemeral().String())
+
+	g.labels = map[string]string{labelEphemeralStorage: "200Gi"}
+	nodeInfo, err = g.TemplateNodeInfo()
+	require.NoError(t, err)
+	require.Equal(t, "200Gi", nodeInfo.Node().Status.Capacity.StorageEphemeral().String())
+
+	// invalid override is ignored
+	g.labels = map[string]string{labelEphemeralStorage: "lots"}
+	nodeInfo, err = g.TemplateNodeInfo()
+	require.NoError(t, err)
+	require.Equal(t, "80Gi", nodeInfo.Node().Status.Capacity.StorageEphemeral().String())
+}
+
+func TestUpCloudNodeGroup_TemplateNodeInfoSystemPods(t *testing.T) {
+	t.Parallel()
+
+	g := &upCloudNodeGroup{name: "small", plan: "1xCPU-2GB", systemPods: uksSystemPods}
+	nodeInfo, err := g.TemplateNodeInfo()
+	require.NoError(t, err)
+	require.Len(t, nodeInfo.Pods, len(uksSystemPods)+1)
+	// kube-proxy and system pods requests
+	require.Equal(t, int64(230), nodeInfo.Requested.MilliCPU)
+	require.Equal(t, int64(224<<20), nodeInfo.Requested.Memory)
+	for _, p := range nodeInfo.Pods {
+		require.Equal(t, "kube-system", p.Pod.Namespace)
+	}
+}
+
+func TestUpCloudNodeGroup_TemplateNodeInfoDaemonSets(t *testing.T) {
+	t.Parallel()
+
+	daemonSets := make([]*appsv1.DaemonSet, 0, len(uksSystemPods))
+	for _, s := range uksSystemPods {
+		daemonSets = append(daemonSets, &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: "kube-system", UID: types.UID(s.name)},
+			Spec: appsv1.DaemonSetSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{
+				Name:      s.name,
+				Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: s.cpu, v1.ResourceMemory: s.memory}},
+			}}}}},
+		})
+	}
+	taintConfig := taints.NewTaintConfig(config.AutoscalingOptions{})
+
+	// DaemonSet pods are added by the autoscaler, so default template has only kube-proxy
+	clusterID := uuid.New()
+	m, err := newManager(context.Background(), mocks.NewTestCluster(clusterID).WithNodeGroups(mocks.NewTestNodeGroup("small").WithPlan("1xCPU-2GB").WithNodes(1)).Service(),
+		upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	nodeInfo, err := utils.GetNodeInfoFromTemplate(m.getNodeGroups()[0], daemonSets, taintConfig)
+	require.NoError(t, err)
+	require.Len(t, nodeInfo.Pods, len(uksSystemPods)+1)
+	// kube-proxy and DaemonSet pods requests, each system pod is counted once
+	require.Equal(t, int64(230), nodeInfo.Requested.MilliCPU)
+	require.Equal(t, int64(224<<20), nodeInfo.Requested.Memory)
+
+	// system pods stand in for DaemonSets that the autoscaler can't list
+	g := &upCloudNodeGroup{name: "small", plan: "1xCPU-2GB", systemPods: uksSystemPods}
+	nodeInfo, err = utils.GetNodeInfoFromTemplate(g, nil, taintConfig)
+	require.NoError(t, err)
+	require.Equal(t, int64(230), nodeInfo.Requested.MilliCPU)
+	require.Equal(t, int64(224<<20), nodeInfo.Requested.Memory)
+}
+
+func TestUpCloudNodeGroup_MaxPods(t *testing.T) {
+	t.Parallel()
+
+	g := &upCloudNodeGroup{name: "pods", plan: "2xCPU-4GB"}
+	require.Equal(t, templateNodeMaxPods, g.maxPods())
+
+	g.kubeletArgs = map[string]string{kubeletArgMaxPods: "60"}
+	require.Equal(t, int64(60), g.maxPods())
+	g.labels = map[string]string{labelMaxPods: "30"}
+	require.Equal(t, int64(30), g.maxPods())
+	nodeInfo, err := g.TemplateNodeInfo()
+	require.NoError(t, err)
+	require.Equal(t, "30", nodeInfo.Node().Status.Capacity.Pods().String())
+	require.Equal(t, "30", nodeInfo.Node().Status.Allocatable.Pods().String())
+
+	// invalid values are ignored
+	g.labels = map[string]string{labelMaxPods: "0"}
+	require.Equal(t, int64(60), g.maxPods())
+	g.kubeletArgs = map[string]string{kubeletArgMaxPods: "many"}
+	require.Equal(t, templateNodeMaxPods, g.maxPods())
+}
+
+func TestAllocatable(t *testing.T) {
+	t.Parallel()
+
+	capacity := v1.ResourceList{
+		v1.ResourceCPU:              resource.MustParse("2"),
+		v1.ResourceMemory:           resource.MustParse("4Gi"),
+		v1.ResourcePods:             resource.MustParse("110"),
+		v1.ResourceEphemeralStorage: resource.MustParse("100Gi"),
+	}
+	a := allocatable("test", capacity, nil)
+	require.Equal(t, "1930m", a.Cpu().String())
+	require.Equal(t, "2972Mi", a.Memory().String())
+	require.Equal(t, "90Gi", a.StorageEphemeral().String())
+	require.Equal(t, "110", a.Pods().String())
+
+	a = allocatable("test", capacity, map[string]string{
+		kubeletArgKubeReserved:   "cpu=200m,memory=512Mi,ephemeral-storage=1Gi",
+		kubeletArgSystemReserved: "cpu=100m",
+		kubeletArgEvictionHard:   "nodefs.available<5Gi,memory.available<5%",
+	})
+	require.Equal(t, "1700m", a.Cpu().String())
+	require.InDelta(t, 4<<30-512<<20-0.05*(4<<30), a.Memory().Value(), 1)
+	require.Equal(t, "94Gi", a.StorageEphemeral().String())
+
+	// invalid arguments are ignored
+	require.Equal(t, allocatable("test", capacity, nil), allocatable("test", capacity, map[string]string{
+		kubeletArgKubeReserved: "cpu",
+		kubeletArgEvictionHard: "memory.available<lots",
+	}))
+}
+
+func TestParseServerPlan(t *testing.T) {
+	t.Parallel()
+
+	for name, want := range map[string]serverPlan{
+		"2xCPU-4GB":             {name: "2xCPU-4GB", cores: 2, memoryMiB: 4096, storageGiB: 80},
+		"DEV-1xCPU-1GB-10GB":    {name: "DEV-1xCPU-1GB-10GB", cores: 1, memoryMiB: 1024, storageGiB: 10},
+		"HIMEM-4xCPU-32GB":      {name: "HIMEM-4xCPU-32GB", cores: 4, memoryMiB: 32768},
+		"GPU-8xCPU-64GB-1xL40S": {name: "GPU-8xCPU-64GB-1xL40S", cores: 8, memoryMiB: 65536, gpus: 1, gpuType: "L40S"},
+	} {
+		got, err := parseServerPlan(name)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	_, err := parseServerPlan("custom")
+	require.Error(t, err)
+
+	_, err = customServerPlan(&sdkext.KubernetesNodeGroupCustomPlan{Cores: 2})
+	require.Error(t, err)
+	got, err := customServerPlan(&sdkext.KubernetesNodeGroupCustomPlan{Cores: 2, Memory: 6144, StorageSize: 50})
+	require.NoError(t, err)
+	require.Equal(t, serverPlan{name: customPlanName, cores: 2, memoryMiB: 6144, storageGiB: 50}, got)
+}
+
+func TestUpCloudNodeGroup_TemplateNodeInfoListedGPUPlan(t *testing.T) {
+	t.Parallel()
+
+	// GPUs are read from the listed plan, the plan name doesn't encode them
+	clusterID := uuid.New()
+	svc := mocks.NewTestCluster(clusterID).
+		WithServerPlans(sdkext.Plan{Name: "ML-8", CoreNumber: 8, MemoryAmount: 65536, StorageSize: 300, GPUAmount: 2, GPUModel: "NVIDIA A100"}).
+		WithNodeGroups(mocks.NewTestNodeGroup("ml").WithPlan("ML-8").WithNodes(1)).
+		Service()
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.refresh())
+	nodeInfo, err := m.getNodeGroups()[0].TemplateNodeInfo()
+	require.NoError(t, err)
+	node := nodeInfo.Node()
+	require.Equal(t, "8", node.Status.Capacity.Cpu().String())
+	require.Equal(t, "300Gi", node.Status.Capacity.StorageEphemeral().String())
+	gpus := node.Status.Allocatable[gpu.ResourceNvidiaGPU]
+	require.Equal(t, int64(2), gpus.Value())
+	require.Equal(t, "NVIDIA-A100", node.Labels[gpuLabel])
+	p := upCloudCloudProvider{manager: m}
+	require.Equal(t, map[string]struct{}{"NVIDIA-A100": {}}, p.GetAvailableGPUTypes())
+
+	_, err = parseServerPlan("ML-8")
+	require.Error(t, err)
+}
+
+func TestPlanCache(t *testing.T) {
+	t.Parallel()
+
+	svc := mocks.NewTestCluster(uuid.New()).WithServerPlans(sdkext.Plan{Name: "CLOUDNATIVE-2xCPU-6GB", CoreNumber: 2, MemoryAmount: 6144, StorageSize: 60}).Service()
+	c := newPlanCache(time.Hour)
+	// plans that are not listed are parsed from plan names
+	plan, err := c.byName("2xCPU-4GB")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), plan.cores)
+	_, err = c.byName("unknown")
+	require.Error(t, err)
+	require.Len(t, c.parsed, 2)
+
+	require.NoError(t, c.load(context.TODO(), svc))
+	require.Empty(t, c.parsed)
+	plan, err = c.byName("CLOUDNATIVE-2xCPU-6GB")
+	require.NoError(t, err)
+	require.Equal(t, serverPlan{name: "CLOUDNATIVE-2xCPU-6GB", cores: 2, memoryMiB: 6144, storageGiB: 60}, plan)
+	plan, err = c.byName("HIMEM-4xCPU-32GB")
+	require.NoError(t, err)
+	require.Equal(t, int64(100), plan.storageGiB)
+	require.Empty(t, c.parsed)
+
+	custom := &sdkext.KubernetesNodeGroupCustomPlan{Cores: 2, Memory: 6144, StorageSize: 50}
+	plan, err = c.byCustomPlan(custom)
+	require.NoError(t, err)
+	require.Equal(t, int64(6144), plan.memoryMiB)
+	require.Equal(t, int64(50), plan.storageGiB)
+	// custom plan without storage size uses storage of the listed general purpose plan
+	plan, err = c.byCustomPlan(&sdkext.KubernetesNodeGroupCustomPlan{Cores: 4, Memory: 8192})
+	require.NoError(t, err)
+	require.Equal(t, serverPlan{name: customPlanName, cores: 4, memoryMiB: 8192, storageGiB: 160}, plan)
+
+	// previously loaded plans are kept when loading fails
+	svc.SetFaults(mocks.Faults{ErrorRate: 1})
+	require.Error(t, c.load(context.TODO(), svc))
+	plan, err = c.byName("CLOUDNATIVE-2xCPU-6GB")
+	require.NoError(t, err)
+	require.Equal(t, int64(60), plan.storageGiB)
+
+	// nil cache parses plans from plan names
+	var nilCache *planCache
+	plan, err = nilCache.byName("2xCPU-4GB")
+	require.NoError(t, err)
+	require.Equal(t, int64(4096), plan.memoryMiB)
+}
+
+func TestManager_ReloadPlans(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	svc := newMockService(clusterID)
+	m, err := newManager(context.Background(), svc, upCloudConfig{ClusterID: clusterID.String()}, config.AutoscalingOptions{}, cloudprovider.NodeGroupDiscoveryOptions{})
+	require.NoError(t, err)
+	plan, err := m.plans.byName("GPU-8xCPU-64GB-1xL40S")
+	require.NoError(t, err)
+	require.Equal(t, int64(300), plan.storageGiB)
+
+	m.plans.interval = 10 * time.Millisecond
+	svc.ServerPlans = append(svc.ServerPlans, sdkext.Plan{Name: "CLOUDNATIVE-2xCPU-6GB", CoreNumber: 2, MemoryAmount: 6144, StorageSize: 60})
+	done := make(chan struct{})
+	go func() {
+		m.reloadPlans()
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		plan, err := m.plans.byName("CLOUDNATIVE-2xCPU-6GB")
+		return err == nil && plan.storageGiB == 60
+	}, 5*time.Second, 10*time.Millisecond)
+	m.lifecycle.stop()
+	<-done
 }
 
 func TestUpCloudNodeGroup_AtomicIncreaseSize(t *testing.T) {
 	t.Parallel()
 
-	g := &upCloudNodeGroup{}
-	require.ErrorIs(t, g.AtomicIncreaseSize(1), cloudprovider.ErrNotImplemented)
+	clusterID := uuid.New()
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(2)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	g := newTestNodeGroup(clusterID, svc, fixture)
+
+	require.Error(t, g.AtomicIncreaseSize(0))
+	require.Error(t, g.AtomicIncreaseSize(g.MaxSize()))
+	require.NoError(t, g.AtomicIncreaseSize(2))
+	require.Equal(t, 4, g.targetSize())
+
+	// states are consumed by node list before scale-up, wait and rollback
+	svc.SetFaults(mocks.Faults{NodeGroupStates: map[string][]upcloud.KubernetesNodeGroupState{
+		"group1": {upcloud.KubernetesNodeGroupStateRunning, upcloud.KubernetesNodeGroupStateFailed, upcloud.KubernetesNodeGroupStateRunning},
+	}})
+	require.Error(t, g.AtomicIncreaseSize(2))
+	require.Equal(t, 4, g.targetSize())
+	details, err := g.nodeGroupDetails()
+	require.NoError(t, err)
+	require.Equal(t, 4, details.Count)
+
+	// nodes that are not running within provision time are rolled back
+	svc.SetFaults(mocks.Faults{ProvisioningTimes: map[string]time.Duration{"": time.Minute}})
+	g.maxNodeProvisionTime = 10 * time.Millisecond
+	require.ErrorContains(t, g.AtomicIncreaseSize(1), "4/5 nodes running")
+	require.Equal(t, 4, g.targetSize())
+	details, err = g.nodeGroupDetails()
+	require.NoError(t, err)
+	require.Equal(t, 4, details.Count)
+}
+
+func TestUpCloudNodeGroup_AtomicIncreaseSizeCleanup(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(2)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	g := newTestNodeGroup(clusterID, svc, fixture)
+	g.lifecycle = newLifecycle()
+	svc.SetFaults(mocks.Faults{ProvisioningTimes: map[string]time.Duration{"": time.Hour}})
+
+	// cleanup stops waiting for nodes, which would otherwise last for max node provision time
+	errs := make(chan error, 1)
+	go func() {
+		errs <- g.AtomicIncreaseSize(1)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	g.lifecycle.stop()
+	select {
+	case err := <-errs:
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorContains(t, err, "2/3 nodes running")
+	case <-time.After(5 * time.Second):
+		t.Fatal("atomic scale-up didn't stop on cleanup")
+	}
+}
+
+func TestUpCloudNodeGroup_ZeroOrMaxNodeScaling(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	fixture := mocks.NewTestNodeGroup("batch").WithLabel(labelZeroOrMaxNodeScaling, "true").WithLabel(labelMaxSize, "3")
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	m := &manager{clusterID: clusterID, svc: svc, maxNodesTotal: mocks.TestClusterPlanMaxNodes}
+	require.NoError(t, m.refresh())
+	g := m.getNodeGroups()[0]
+	require.Equal(t, 0, g.MinSize())
+	opts, err := g.GetOptions(config.NodeGroupAutoscalingOptions{})
+	require.NoError(t, err)
+	require.True(t, opts.ZeroOrMaxNodeScaling)
+
+	// node group is scaled straight to max size
+	require.ErrorContains(t, g.IncreaseSize(2), "can only be scaled to max size")
+	require.ErrorContains(t, g.AtomicIncreaseSize(1), "can only be scaled to max size")
+	require.NoError(t, g.IncreaseSize(3))
+	require.Equal(t, 3, g.targetSize())
+
+	// nodes are deleted together
+	require.NoError(t, m.refresh())
+	g = m.getNodeGroups()[0]
+	nodes := make([]*v1.Node, 0)
+	for _, i := range g.nodes {
+		nodes = append(nodes, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: i.Id}, Spec: v1.NodeSpec{ProviderID: i.Id}})
+	}
+	require.Len(t, nodes, 3)
+	require.ErrorContains(t, g.DeleteNodes(nodes[:1]), "must be deleted together")
+	require.Equal(t, 3, g.targetSize())
+	require.NoError(t, g.DeleteNodes(nodes))
+	require.Equal(t, 0, g.targetSize())
+	details, err := g.nodeGroupDetails()
+	require.NoError(t, err)
+	require.Equal(t, 0, details.Count)
+}
+
+// newTestNodeGroup returns node group built from fixture using default size limits
+func TestUpCloudNodeGroup_LogValues(t *testing.T) {
+	t.Parallel()
+
+	g := &upCloudNodeGroup{clusterID: uuid.New(), name: "test"}
+	require.Equal(t, []any{logKeyClusterID, g.clusterID.String(), logKeyNodeGroup, "test", "delta", 1}, g.logValues("delta", 1))
+
+	require.Equal(t, logInfo, operationLogLevel("NodeGroup.IncreaseSize"))
+	require.Equal(t, logInfo, operationLogLevel("NodeGroup.DeleteNodes"))
+	require.Equal(t, logDebug, operationLogLevel("NodeGroup.TargetSize"))
+	require.Equal(t, logDebug, operationLogLevel("CloudProvider.Refresh"))
+
+	l := g.logOperation("IncreaseSize", "delta", 1)
+	require.Equal(t, logInfo, l.level)
+	require.Equal(t, append([]any{logKeyOperation, "NodeGroup.IncreaseSize"}, g.logValues("delta", 1)...), l.values)
+	err := fmt.Errorf("test")
+	l.done(&err)
+	l.done(nil)
+	// completion values are not appended to the operation values
+	require.Len(t, l.values, 8)
+}
+
+func newTestNodeGroup(clusterID uuid.UUID, svc upCloudService, fixture *mocks.TestNodeGroup) *upCloudNodeGroup {
+	details := fixture.Details()
+	nodes := make([]cloudprovider.Instance, 0, len(details.Nodes))
+	for _, n := range details.Nodes {
+		nodes = append(nodes, cloudprovider.Instance{
+			Id:     fmt.Sprintf("upcloud:////%s", n.UUID),
+			Status: nodeStateToInstanceStatus(n.State),
+		})
+	}
+	return &upCloudNodeGroup{
+		clusterID: clusterID,
+		name:      details.Name,
+		size:      details.Count,
+		minSize:   nodeGroupMinSize,
+		maxSize:   mocks.TestClusterPlanMaxNodes,
+		svc:       svc,
+		opLocks:   newNodeGroupLocks(),
+		nodes:     nodes,
+	}
 }
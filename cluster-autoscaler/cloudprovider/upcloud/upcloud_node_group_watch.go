@@ -0,0 +1,108 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+)
+
+// nodeGroupWatchMaxAge is the maximum age of shared details, which covers the maximum delay between state checks
+// including jitter
+const nodeGroupWatchMaxAge time.Duration = nodeGroupStateBackoffMax * 3 / 2
+
+// nodeGroupWatch shares node group details fetched by node group state waits, so that refresh doesn't fetch
+// details of node groups that in-flight operations are already polling. UpCloud API doesn't support long polling
+// or conditional requests, so state waits and refresh would otherwise poll the same node group.
+// Nil nodeGroupWatch doesn't share details.
+type nodeGroupWatch struct {
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	watches map[string]*nodeGroupWatchEntry
+}
+
+type nodeGroupWatchEntry struct {
+	// waiters is the number of state waits that poll the node group
+	waiters   int
+	details   *upcloud.KubernetesNodeGroupDetails
+	fetchedAt time.Time
+}
+
+func newNodeGroupWatch(maxAge time.Duration) *nodeGroupWatch {
+	return &nodeGroupWatch{maxAge: maxAge, watches: make(map[string]*nodeGroupWatchEntry)}
+}
+
+// start registers state wait of the node group, stop must be called when the wait returns
+func (w *nodeGroupWatch) start(name string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.watches[name]
+	if !ok {
+		e = &nodeGroupWatchEntry{}
+		w.watches[name] = e
+	}
+	e.waiters++
+}
+
+// stop unregisters state wait of the node group and forgets its details after the last wait
+func (w *nodeGroupWatch) stop(name string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.watches[name]
+	if !ok {
+		return
+	}
+	if e.waiters--; e.waiters <= 0 {
+		delete(w.watches, name)
+	}
+}
+
+// observe shares details fetched by state wait
+func (w *nodeGroupWatch) observe(details *upcloud.KubernetesNodeGroupDetails) {
+	if w == nil || details == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e, ok := w.watches[details.Name]; ok {
+		e.details = details
+		e.fetchedAt = time.Now()
+	}
+}
+
+// get returns details of the node group if a state wait has fetched them within max age
+func (w *nodeGroupWatch) get(name string) (*upcloud.KubernetesNodeGroupDetails, bool) {
+	if w == nil {
+		return nil, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.watches[name]
+	if !ok || e.details == nil || time.Since(e.fetchedAt) > w.maxAge {
+		return nil, false
+	}
+	return e.details, true
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+	"k8s.io/klog/v2"
+)
+
+// pendingNodeErrorCode is the error code of nodes that have been pending longer than max node provision time
+const pendingNodeErrorCode string = "NODE_PROVISIONING_TIMEOUT"
+
+// pendingNodes tracks when pending nodes of node groups were first observed. Nodes that stay pending longer than
+// max node provision time are reported with error info, so that CA gives up the scale-up and tries other node groups
+// instead of waiting for the nodes. Nil pendingNodes doesn't track nodes.
+type pendingNodes struct {
+	mu sync.Mutex
+	// firstSeen maps node group name to the pending nodes of the node group and the time they were first observed
+	firstSeen map[string]map[string]time.Time
+}
+
+func newPendingNodes() *pendingNodes {
+	return &pendingNodes{firstSeen: make(map[string]map[string]time.Time)}
+}
+
+// observe records pending nodes of the node group and marks nodes that have been pending longer than provisionTime
+// with error info. Nodes that are no longer pending are forgotten. Zero provisionTime doesn't mark nodes.
+func (p *pendingNodes) observe(name string, nodes []cloudprovider.Instance, provisionTime time.Duration) []cloudprovider.Instance {
+	if p == nil {
+		return nodes
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	previous := p.firstSeen[name]
+	current := make(map[string]time.Time)
+	for i := range nodes {
+		n := &nodes[i]
+		if isPlaceholder(name, n.Id) || n.Status == nil || n.Status.State != cloudprovider.InstanceCreating || n.Status.ErrorInfo != nil {
+			continue
+		}
+		firstSeen, ok := previous[n.Id]
+		if !ok {
+			firstSeen = now
+		}
+		current[n.Id] = firstSeen
+		if pending := now.Sub(firstSeen); provisionTime > 0 && pending > provisionTime {
+			klog.V(logInfo).InfoS("reporting node pending longer than max node provision time as failed",
+				logKeyNodeGroup, name, "node", n.Id, "pending", pending.Round(time.Second), "maxNodeProvisionTime", provisionTime)
+			n.Status = &cloudprovider.InstanceStatus{
+				State: cloudprovider.InstanceCreating,
+				ErrorInfo: &cloudprovider.InstanceErrorInfo{
+					ErrorClass:   cloudprovider.OtherErrorClass,
+					ErrorCode:    pendingNodeErrorCode,
+					ErrorMessage: fmt.Sprintf("UKS node has been pending longer than max node provision time %s", provisionTime),
+				},
+			}
+		}
+	}
+	if len(current) == 0 {
+		delete(p.firstSeen, name)
+	} else {
+		p.firstSeen[name] = current
+	}
+	return nodes
+}
+
+// retain forgets pending nodes of node groups that are not listed, e.g. because node group was deleted
+func (p *pendingNodes) retain(groups []sdkext.KubernetesNodeGroup) {
+	if p == nil {
+		return
+	}
+	names := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		names[g.Name] = struct{}{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name := range p.firstSeen {
+		if _, ok := names[name]; !ok {
+			delete(p.firstSeen, name)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// pendingSizeTimeout is the time requested node group size overrides the size listed by the API, if the API doesn't
+// confirm it earlier
+const pendingSizeTimeout time.Duration = time.Minute
+
+// pendingSizes tracks node group sizes that have been requested, but that the API may not list yet. Refresh merges
+// them into rebuilt node groups, so that target size doesn't fall back to the previous size and trigger a duplicate
+// scale-up. Nil pendingSizes doesn't track sizes.
+type pendingSizes struct {
+	mu    sync.Mutex
+	sizes map[string]pendingSize
+}
+
+type pendingSize struct {
+	size        int
+	requestedAt time.Time
+}
+
+func newPendingSizes() *pendingSizes {
+	return &pendingSizes{sizes: make(map[string]pendingSize)}
+}
+
+// set records requested size of the node group
+func (p *pendingSizes) set(name string, size int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sizes[name] = pendingSize{size: size, requestedAt: time.Now()}
+}
+
+// clear removes requested size of the node group, e.g. after the API returned the node group size
+func (p *pendingSizes) clear(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sizes, name)
+}
+
+// get returns requested size of the node group that the API hasn't listed yet
+func (p *pendingSizes) get(name string) (pendingSize, bool) {
+	if p == nil {
+		return pendingSize{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.sizes[name]
+	return s, ok
+}
+
+// merge returns requested size of the node group in place of the listed size until the API lists the requested size
+// or pendingSizeTimeout passes
+func (p *pendingSizes) merge(name string, listed int) int {
+	if p == nil {
+		return listed
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pending, ok := p.sizes[name]
+	if !ok {
+		return listed
+	}
+	if pending.size == listed {
+		delete(p.sizes, name)
+		return listed
+	}
+	if time.Since(pending.requestedAt) > pendingSizeTimeout {
+		klog.Warningf("node group %s size %d requested %s ago is not confirmed, using listed size %d",
+			name, pending.size, pendingSizeTimeout, listed)
+		delete(p.sizes, name)
+		return listed
+	}
+	klog.V(logInfo).InfoS("using requested node group size instead of listed size", logKeyNodeGroup, name, "size", pending.size, "listedSize", listed)
+	return pending.size
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// customPlanName is the plan name of node groups that use custom plan
+	customPlanName string = "custom"
+	// planCacheRefreshInterval is the interval of loading server plans again
+	planCacheRefreshInterval time.Duration = 24 * time.Hour
+)
+
+// serverPlanPattern matches UpCloud server plan names, e.g. 2xCPU-4GB, DEV-1xCPU-1GB-10GB and GPU-8xCPU-64GB-1xL40S.
+// Resources of plans that the API doesn't list are parsed from the plan name.
+var serverPlanPattern = regexp.MustCompile(`^(?:[A-Z]+-)?(\d+)xCPU-(\d+)GB(?:-(\d+)GB)?(?:-(\d+)x([A-Za-z0-9]+))?$`)
+
+// generalPurposePlanStorageGiB contains storage sizes of general purpose plans, which don't include storage size in
+// the plan name
+var generalPurposePlanStorageGiB = map[string]int64{
+	"1xCPU-1GB":    25,
+	"1xCPU-2GB":    50,
+	"2xCPU-4GB":    80,
+	"4xCPU-8GB":    160,
+	"6xCPU-16GB":   320,
+	"8xCPU-32GB":   640,
+	"12xCPU-48GB":  960,
+	"16xCPU-64GB":  1280,
+	"20xCPU-96GB":  1920,
+	"20xCPU-128GB": 2048,
+}
+
+// serverPlan contains resources of UpCloud server plan
+type serverPlan struct {
+	name      string
+	cores     int64
+	memoryMiB int64
+	// storageGiB is size of the plan's storage, zero if it's not known
+	storageGiB int64
+	gpus       int64
+	gpuType    string
+}
+
+func parseServerPlan(name string) (serverPlan, error) {
+	m := serverPlanPattern.FindStringSubmatch(name)
+	if m == nil {
+		return serverPlan{}, fmt.Errorf("unsupported server plan '%s'", name)
+	}
+	p := serverPlan{name: name, gpuType: m[5]}
+	var err error
+	if p.cores, err = strconv.ParseInt(m[1], 10, 64); err != nil {
+		return p, fmt.Errorf("invalid server plan '%s' CPU count: %w", name, err)
+	}
+	memoryGiB, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return p, fmt.Errorf("invalid server plan '%s' memory: %w", name, err)
+	}
+	p.memoryMiB = memoryGiB * 1024
+	if m[3] != "" {
+		if p.storageGiB, err = strconv.ParseInt(m[3], 10, 64); err != nil {
+			return p, fmt.Errorf("invalid server plan '%s' storage: %w", name, err)
+		}
+	} else {
+		p.storageGiB = generalPurposePlanStorageGiB[name]
+	}
+	if m[4] != "" {
+		if p.gpus, err = strconv.ParseInt(m[4], 10, 64); err != nil {
+			return p, fmt.Errorf("invalid server plan '%s' GPU count: %w", name, err)
+		}
+	}
+	return p, nil
+}
+
+// serverPlan returns resources of the node group plan
+func (u *upCloudNodeGroup) serverPlan() (serverPlan, error) {
+	if u.customPlan != nil {
+		return u.plans.byCustomPlan(u.customPlan)
+	}
+	return u.plans.byName(u.plan)
+}
+
+// planCache caches server plans listed by the UpCloud API. It's owned by the manager and shared by its node groups,
+// and reloaded on refresh interval. Resources of plans that the API doesn't list, e.g. when plans couldn't be loaded,
+// are parsed from plan names. Nil planCache parses plans from plan names.
+type planCache struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// plans are the listed server plans by plan name
+	plans map[string]serverPlan
+	// parsed caches plans that are not listed, they are parsed from plan names until plans are loaded again
+	parsed map[string]planCacheEntry
+}
+
+type planCacheEntry struct {
+	plan serverPlan
+	err  error
+}
+
+func newPlanCache(interval time.Duration) *planCache {
+	return &planCache{interval: interval, plans: make(map[string]serverPlan), parsed: make(map[string]planCacheEntry)}
+}
+
+// load replaces cached plans with the server plans listed by the API
+func (c *planCache) load(ctx context.Context, svc upCloudService) error {
+	listed, err := svc.GetPlans(ctx, &sdkext.GetPlansRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to list server plans: %w", err)
+	}
+	plans := make(map[string]serverPlan, len(listed))
+	for _, p := range listed {
+		plans[p.Name] = listedServerPlan(p)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.plans = plans
+	c.parsed = make(map[string]planCacheEntry)
+	klog.V(logInfo).InfoS("loaded UpCloud server plans", "plans", len(plans))
+	return nil
+}
+
+// byName returns server plan with the name
+func (c *planCache) byName(name string) (serverPlan, error) {
+	if c == nil {
+		return parseServerPlan(name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.plans[name]; ok {
+		return p, nil
+	}
+	if e, ok := c.parsed[name]; ok {
+		return e.plan, e.err
+	}
+	plan, err := parseServerPlan(name)
+	klog.InfoS("server plan is not listed by UpCloud API, parsing its resources from the plan name", "plan", name, "err", err)
+	c.parsed[name] = planCacheEntry{plan: plan, err: err}
+	return plan, err
+}
+
+// byCustomPlan returns server plan of the custom plan definition. Definitions without storage size use the storage
+// size of the listed general purpose plan that has the same CPU cores and memory, if there is one.
+func (c *planCache) byCustomPlan(p *sdkext.KubernetesNodeGroupCustomPlan) (serverPlan, error) {
+	plan, err := customServerPlan(p)
+	if c == nil || err != nil || plan.storageGiB > 0 {
+		return plan, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if plan.memoryMiB%1024 == 0 {
+		plan.storageGiB = c.plans[fmt.Sprintf("%dxCPU-%dGB", plan.cores, plan.memoryMiB/1024)].storageGiB
+	}
+	return plan, nil
+}
+
+// reloadPlans loads server plans again on refresh interval until the manager is cleaned up
+func (m *manager) reloadPlans() {
+	ticker := time.NewTicker(m.plans.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.lifecycle.context().Done():
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := m.lifecycle.withTimeout(timeoutGetRequest)
+		if err := m.plans.load(ctx, m.service()); err != nil {
+			klog.ErrorS(err, "failed to reload UpCloud server plans, using previously loaded plans")
+		}
+		cancel()
+	}
+}
+
+// listedServerPlan returns resources of server plan listed by the API. GPU type is the GPU model without vendor
+// prefix, e.g. L40S, so that it matches GPU types parsed from plan names.
+func listedServerPlan(p sdkext.Plan) serverPlan {
+	plan := serverPlan{
+		name:       p.Name,
+		cores:      int64(p.CoreNumber),
+		memoryMiB:  int64(p.MemoryAmount),
+		storageGiB: int64(p.StorageSize),
+		gpus:       int64(p.GPUAmount),
+	}
+	if plan.gpus > 0 {
+		plan.gpuType = strings.ReplaceAll(strings.TrimSpace(strings.TrimPrefix(p.GPUModel, "NVIDIA")), " ", "-")
+	}
+	return plan
+}
+
+// customServerPlan returns resources of node group custom plan, which has memory in MiB and storage in GB
+func customServerPlan(c *sdkext.KubernetesNodeGroupCustomPlan) (serverPlan, error) {
+	if c == nil || c.Cores <= 0 || c.Memory <= 0 {
+		return serverPlan{}, fmt.Errorf("custom plan doesn't define CPU cores and memory")
+	}
+	return serverPlan{
+		name:       customPlanName,
+		cores:      int64(c.Cores),
+		memoryMiB:  int64(c.Memory),
+		storageGiB: int64(c.StorageSize),
+	}, nil
+}
+
+// gpuLabelValue returns value of the GPU label of the nodes using the plan
+func (p serverPlan) gpuLabelValue() string {
+	if p.gpus == 0 {
+		return ""
+	}
+	return "NVIDIA-" + p.gpuType
+}
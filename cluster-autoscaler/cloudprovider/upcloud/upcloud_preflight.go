@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/klog/v2"
+)
+
+// preflightNodeGroupPrefix is the name prefix of the missing node group used to check that API user can modify
+// node groups
+const preflightNodeGroupPrefix string = "preflight-"
+
+// preflight checks that API accepts the credentials, the cluster exists and API user is allowed to list and modify
+// node groups of the cluster. Returned error tells how to fix the configuration. Modify permission that can't be
+// verified is logged, and scaling fails later if the user isn't allowed to modify node groups.
+func preflight(ctx context.Context, svc upCloudService, cfg upCloudConfig) error {
+	if _, err := svc.GetKubernetesCluster(ctx, &request.GetKubernetesClusterRequest{UUID: cfg.ClusterID}); err != nil {
+		switch {
+		case isAuthenticationError(err):
+			return fmt.Errorf("UpCloud API rejected credentials of user '%s', check %s and %s environment variables: %w",
+				cfg.Username, envUpCloudUsername, envUpCloudPassword, err)
+		case isPermissionError(err):
+			return fmt.Errorf("API user '%s' is not allowed to access cluster %s, grant the user access to the cluster: %w",
+				cfg.Username, cfg.ClusterID, err)
+		case isNotFoundError(err):
+			return fmt.Errorf("cluster %s not found, check %s environment variable%s",
+				cfg.ClusterID, envUpCloudClusterID, accessibleClusters(ctx, svc))
+		default:
+			return fmt.Errorf("failed to get cluster %s: %w", cfg.ClusterID, err)
+		}
+	}
+	if _, err := svc.GetKubernetesNodeGroups(ctx, &request.GetKubernetesNodeGroupsRequest{ClusterUUID: cfg.ClusterID}); err != nil {
+		if isPermissionError(err) {
+			return fmt.Errorf("API user '%s' is not allowed to list node groups of cluster %s: %w", cfg.Username, cfg.ClusterID, err)
+		}
+		return fmt.Errorf("failed to list node groups of cluster %s: %w", cfg.ClusterID, err)
+	}
+	verified, err := modifyPermission(ctx, svc, cfg)
+	switch {
+	case err != nil:
+		return err
+	case !verified:
+		klog.Warningf("permission of API user '%s' to modify node groups of cluster %s is not verified, scaling fails if the user isn't allowed to modify node groups",
+			cfg.Username, cfg.ClusterID)
+	}
+	return nil
+}
+
+// modifyPermission checks whether API user is allowed to modify node groups of the cluster by modifying a node group
+// that doesn't exist, so that the check doesn't change the cluster. API that checks permission before looking up the
+// node group rejects the request with permission error. Not found error doesn't tell whether the user has permission,
+// so permission is not verified then. Returned error tells that the user isn't allowed to modify node groups.
+func modifyPermission(ctx context.Context, svc upCloudService, cfg upCloudConfig) (bool, error) {
+	name := fmt.Sprintf("%s%08x", preflightNodeGroupPrefix, rand.Uint32()) //nolint: gosec
+	_, err := svc.ModifyKubernetesNodeGroup(ctx, &request.ModifyKubernetesNodeGroupRequest{
+		ClusterUUID: cfg.ClusterID,
+		Name:        name,
+		NodeGroup:   request.ModifyKubernetesNodeGroup{Count: 0},
+	})
+	switch {
+	case err == nil:
+		return true, nil
+	case isPermissionError(err):
+		return false, fmt.Errorf("API user '%s' is not allowed to modify node groups of cluster %s, which is needed for scaling: %w",
+			cfg.Username, cfg.ClusterID, err)
+	case isNotFoundError(err):
+		return false, nil
+	default:
+		klog.Warningf("unable to check permission to modify node groups of cluster %s: %v", cfg.ClusterID, err)
+		return false, nil
+	}
+}
+
+// accessibleClusters returns hint that lists clusters available to API user, or empty string if they can't be listed
+func accessibleClusters(ctx context.Context, svc upCloudService) string {
+	clusters, err := svc.GetKubernetesClusters(ctx, &request.GetKubernetesClustersRequest{})
+	if err != nil {
+		return ""
+	}
+	if len(clusters) == 0 {
+		return ", API user doesn't have access to any clusters"
+	}
+	names := make([]string, 0, len(clusters))
+	for _, c := range clusters {
+		names = append(names, fmt.Sprintf("%s (%s)", c.UUID, c.Name))
+	}
+	return ", API user has access to clusters " + strings.Join(names, ", ")
+}
+
+// isPermissionError returns true if API user isn't allowed to make the request
+func isPermissionError(err error) bool {
+	var p *upcloud.Problem
+	return errors.As(err, &p) && (p.Status == http.StatusForbidden || hasErrorCode(p.ErrorCode(), permissionErrorCodes))
+}
+
+func isNotFoundError(err error) bool {
+	var p *upcloud.Problem
+	return errors.As(err, &p) && p.Status == http.StatusNotFound
+}
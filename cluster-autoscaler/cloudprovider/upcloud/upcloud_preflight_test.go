@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/mocks"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+)
+
+func TestPreflight(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clusterID := uuid.New()
+	cfg := upCloudConfig{ClusterID: clusterID.String(), Username: "user"}
+	svc := newMockService(clusterID)
+	require.NoError(t, preflight(ctx, svc, cfg))
+	// permission check doesn't change node groups
+	groups, err := svc.GetKubernetesNodeGroups(ctx, &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()})
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+
+	err = preflight(ctx, svc, upCloudConfig{ClusterID: uuid.NewString(), Username: "user"})
+	require.ErrorContains(t, err, "not found, check UPCLOUD_CLUSTER_ID environment variable, API user has access to clusters "+clusterID.String())
+
+	svc.SetFaults(mocks.Faults{ErrorRate: 1, ErrorStatus: http.StatusUnauthorized})
+	require.ErrorContains(t, preflight(ctx, svc, cfg), "UpCloud API rejected credentials of user 'user'")
+
+	svc.SetFaults(mocks.Faults{ErrorRate: 1, ErrorStatus: http.StatusForbidden})
+	require.ErrorContains(t, preflight(ctx, svc, cfg), "not allowed to access cluster")
+
+	svc.SetFaults(mocks.Faults{})
+	err = preflight(ctx, &readOnlyService{upCloudService: svc}, cfg)
+	require.ErrorContains(t, err, "API user 'user' is not allowed to modify node groups of cluster")
+}
+
+func TestModifyPermission(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clusterID := uuid.New()
+	cfg := upCloudConfig{ClusterID: clusterID.String(), Username: "user"}
+	svc := newMockService(clusterID)
+
+	// missing node group doesn't tell whether user has permission
+	verified, err := modifyPermission(ctx, svc, cfg)
+	require.NoError(t, err)
+	require.False(t, verified)
+
+	verified, err = modifyPermission(ctx, &readOnlyService{upCloudService: svc}, cfg)
+	require.ErrorContains(t, err, "API user 'user' is not allowed to modify node groups of cluster")
+	require.False(t, verified)
+
+	svc.SetFaults(mocks.Faults{ErrorRate: 1})
+	verified, err = modifyPermission(ctx, svc, cfg)
+	require.NoError(t, err)
+	require.False(t, verified)
+}
+
+// readOnlyService rejects requests that modify node groups like API user without modify permission
+type readOnlyService struct {
+	upCloudService
+}
+
+func (s *readOnlyService) ModifyKubernetesNodeGroup(_ context.Context, _ *request.ModifyKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error) {
+	return nil, &upcloud.Problem{Status: http.StatusForbidden}
+}
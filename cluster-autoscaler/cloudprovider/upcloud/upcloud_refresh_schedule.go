@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"sync"
+	"time"
+)
+
+// refreshSchedule decides whether refresh lists all node groups of the cluster or only updates node groups with
+// in-flight operations. Nil schedule makes every refresh full.
+type refreshSchedule struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func newRefreshSchedule(interval time.Duration) *refreshSchedule {
+	if interval <= 0 {
+		return nil
+	}
+	return &refreshSchedule{interval: interval}
+}
+
+// full returns true if the last full refresh is older than the interval
+func (s *refreshSchedule) full() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Since(s.last) >= s.interval
+}
+
+// done records completed full refresh
+func (s *refreshSchedule) done() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = time.Now()
+}
+
+// reset makes the next refresh full, which is needed after node groups are created or deleted
+func (s *refreshSchedule) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = time.Time{}
+}
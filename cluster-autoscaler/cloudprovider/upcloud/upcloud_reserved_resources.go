@@ -0,0 +1,202 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/klog/v2"
+)
+
+// Kubelet arguments that reserve node resources
+const (
+	kubeletArgKubeReserved   string = "kube-reserved"
+	kubeletArgSystemReserved string = "system-reserved"
+	kubeletArgEvictionHard   string = "eviction-hard"
+)
+
+// evictionSignal is a hard eviction signal that reserves node resource
+type evictionSignal struct {
+	name     string
+	resource apiv1.ResourceName
+	// threshold is kubelet's default threshold of the signal
+	threshold string
+}
+
+var evictionSignals = []evictionSignal{
+	{name: "memory.available", resource: apiv1.ResourceMemory, threshold: "100Mi"},
+	{name: "nodefs.available", resource: apiv1.ResourceEphemeralStorage, threshold: "10%"},
+}
+
+// reservedTier reserves fraction of the resource between the previous tier and upTo. Zero upTo means no upper limit.
+type reservedTier struct {
+	upTo     int64
+	fraction float64
+}
+
+var (
+	// defaultKubeReservedCPU is the reserved share of CPU cores in millicores when node group doesn't set kube-reserved kubelet argument
+	defaultKubeReservedCPU = []reservedTier{{1000, 0.06}, {2000, 0.01}, {4000, 0.005}, {0, 0.0025}}
+	// defaultKubeReservedMemory is the reserved share of memory in GiB when node group doesn't set kube-reserved kubelet argument
+	defaultKubeReservedMemory = []reservedTier{{4, 0.25}, {8, 0.2}, {16, 0.1}, {128, 0.06}, {0, 0.02}}
+)
+
+func nodeGroupKubeletArgs(args []upcloud.KubernetesKubeletArg) map[string]string {
+	if len(args) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(args))
+	for _, a := range args {
+		m[a.Key] = a.Value
+	}
+	return m
+}
+
+// allocatable returns capacity minus resources reserved by node group kubelet arguments. Default kube-reserved
+// resources are based on the plan size and default eviction threshold is used, if node group doesn't set them.
+// Invalid kubelet arguments are logged and defaults are used instead.
+func allocatable(name string, capacity apiv1.ResourceList, kubeletArgs map[string]string) apiv1.ResourceList {
+	reserved := defaultKubeReserved(capacity)
+	if v, ok := kubeletArgs[kubeletArgKubeReserved]; ok {
+		if r, err := parseReservedResources(v); err != nil {
+			klog.Warningf("ignoring node group %s kubelet argument %s: %v", name, kubeletArgKubeReserved, err)
+		} else {
+			reserved = r
+		}
+	}
+	if v, ok := kubeletArgs[kubeletArgSystemReserved]; ok {
+		if r, err := parseReservedResources(v); err != nil {
+			klog.Warningf("ignoring node group %s kubelet argument %s: %v", name, kubeletArgSystemReserved, err)
+		} else {
+			addResources(reserved, r)
+		}
+	}
+	for _, signal := range evictionSignals {
+		c, ok := capacity[signal.resource]
+		if !ok {
+			continue
+		}
+		eviction, err := evictionThreshold(kubeletArgs[kubeletArgEvictionHard], signal, c)
+		if err != nil {
+			klog.Warningf("ignoring node group %s kubelet argument %s: %v", name, kubeletArgEvictionHard, err)
+			eviction, _ = parseEvictionThreshold(signal.threshold, c)
+		}
+		addResources(reserved, apiv1.ResourceList{signal.resource: eviction})
+	}
+
+	a := capacity.DeepCopy()
+	for k, r := range reserved {
+		q, ok := a[k]
+		if !ok {
+			continue
+		}
+		q.Sub(r)
+		if q.Sign() < 0 {
+			q = *resource.NewQuantity(0, q.Format)
+		}
+		a[k] = q
+	}
+	return a
+}
+
+// defaultKubeReserved returns tiered CPU and memory reservations for the node capacity
+func defaultKubeReserved(capacity apiv1.ResourceList) apiv1.ResourceList {
+	gib := float64(capacity.Memory().Value()) / (1 << 30)
+	return apiv1.ResourceList{
+		apiv1.ResourceCPU:    *resource.NewMilliQuantity(int64(tieredReservation(float64(capacity.Cpu().MilliValue()), defaultKubeReservedCPU)), resource.DecimalSI),
+		apiv1.ResourceMemory: *resource.NewQuantity(int64(tieredReservation(gib, defaultKubeReservedMemory)*(1<<30)), resource.BinarySI),
+	}
+}
+
+func tieredReservation(v float64, tiers []reservedTier) float64 {
+	var reserved, from float64
+	for _, t := range tiers {
+		to := float64(t.upTo)
+		if t.upTo == 0 || v < to {
+			to = v
+		}
+		if to > from {
+			reserved += (to - from) * t.fraction
+		}
+		if t.upTo == 0 || v <= float64(t.upTo) {
+			break
+		}
+		from = float64(t.upTo)
+	}
+	return reserved
+}
+
+// parseReservedResources parses kubelet reservation in format <resource>=<quantity>[,<resource>=<quantity>]
+func parseReservedResources(v string) (apiv1.ResourceList, error) {
+	r := make(apiv1.ResourceList)
+	for _, kv := range strings.Split(v, ",") {
+		k, q, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("reservation %s should be in format <resource>=<quantity>", kv)
+		}
+		quantity, err := resource.ParseQuantity(q)
+		if err != nil {
+			return nil, fmt.Errorf("reservation %s: %w", kv, err)
+		}
+		r[apiv1.ResourceName(k)] = quantity
+	}
+	return r, nil
+}
+
+// evictionThreshold returns resource reserved by the hard eviction signal. Kubelet's default threshold is used
+// if eviction-hard kubelet argument doesn't set the signal.
+func evictionThreshold(v string, signal evictionSignal, capacity resource.Quantity) (resource.Quantity, error) {
+	for _, s := range strings.Split(v, ",") {
+		name, threshold, ok := strings.Cut(strings.TrimSpace(s), "<")
+		if !ok || name != signal.name {
+			continue
+		}
+		q, err := parseEvictionThreshold(threshold, capacity)
+		if err != nil {
+			return resource.Quantity{}, fmt.Errorf("threshold %s: %w", s, err)
+		}
+		return q, nil
+	}
+	return parseEvictionThreshold(signal.threshold, capacity)
+}
+
+// parseEvictionThreshold parses threshold that is either a quantity or a percentage of the capacity
+func parseEvictionThreshold(threshold string, capacity resource.Quantity) (resource.Quantity, error) {
+	if p, ok := strings.CutSuffix(threshold, "%"); ok {
+		q, err := resource.ParseQuantity(p)
+		if err != nil {
+			return resource.Quantity{}, err
+		}
+		return *resource.NewQuantity(int64(q.AsApproximateFloat64()/100*float64(capacity.Value())), resource.BinarySI), nil
+	}
+	return resource.ParseQuantity(threshold)
+}
+
+func addResources(dst, src apiv1.ResourceList) {
+	for k, q := range src {
+		if d, ok := dst[k]; ok {
+			d.Add(q)
+			dst[k] = d
+			continue
+		}
+		dst[k] = q.DeepCopy()
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+)
+
+// retryService limits the rate of UpCloud API requests and retries requests that fail with transient errors.
+// Every attempt is registered in API request metrics.
+// Idempotent requests are retried on 429 and 5xx responses, other requests only on 429 responses,
+// which are rejected before they're processed. Other errors are returned immediately.
+type retryService struct {
+	svc     upCloudService
+	limiter flowcontrol.RateLimiter
+	retries int
+	// backoff is the delay before the first retry, which is doubled on each retry up to maxBackoff
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func newRetryService(svc upCloudService, limiter flowcontrol.RateLimiter, retries int) *retryService {
+	return &retryService{
+		svc:        svc,
+		limiter:    limiter,
+		retries:    retries,
+		backoff:    retryBackoffInitial,
+		maxBackoff: retryBackoffMax,
+	}
+}
+
+// newAPIRateLimiter returns rate limiter shared by services, or nil if rate is not limited
+func newAPIRateLimiter(rate float64) flowcontrol.RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(float32(rate), max(1, int(rate)))
+}
+
+func (s *retryService) do(ctx context.Context, name string, idempotent bool, fn func() error) error {
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		if s.limiter != nil {
+			if err := s.limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		start := time.Now()
+		err := fn()
+		registerRequest(name, start, err)
+		if err == nil || attempt >= s.retries || !isTransientError(err, idempotent) {
+			return err
+		}
+		traceRetry(ctx, attempt+1, err)
+		klog.V(logInfo).InfoS("retrying UpCloud API request", "request", name, "backoff", backoff, "attempt", attempt+1, "retries", s.retries, "err", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, s.maxBackoff)
+	}
+}
+
+// isTransientError returns whether failed request can be retried
+func isTransientError(err error, idempotent bool) bool {
+	var p *upcloud.Problem
+	if !errors.As(err, &p) {
+		return false
+	}
+	if p.Status == http.StatusTooManyRequests {
+		return true
+	}
+	return idempotent && p.Status >= http.StatusInternalServerError
+}
+
+func (s *retryService) GetKubernetesClusters(ctx context.Context, r *request.GetKubernetesClustersRequest) (c []upcloud.KubernetesCluster, err error) {
+	err = s.do(ctx, "GetKubernetesClusters", true, func() error {
+		c, err = s.svc.GetKubernetesClusters(ctx, r)
+		return err
+	})
+	return c, err
+}
+
+func (s *retryService) GetKubernetesCluster(ctx context.Context, r *request.GetKubernetesClusterRequest) (c *upcloud.KubernetesCluster, err error) {
+	err = s.do(ctx, "GetKubernetesCluster", true, func() error {
+		c, err = s.svc.GetKubernetesCluster(ctx, r)
+		return err
+	})
+	return c, err
+}
+
+func (s *retryService) GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) (g []sdkext.KubernetesNodeGroup, err error) {
+	err = s.do(ctx, "GetKubernetesNodeGroups", true, func() error {
+		g, err = s.svc.GetKubernetesNodeGroups(ctx, r)
+		return err
+	})
+	return g, err
+}
+
+func (s *retryService) GetKubernetesNodeGroup(ctx context.Context, r *request.GetKubernetesNodeGroupRequest) (g *upcloud.KubernetesNodeGroupDetails, err error) {
+	err = s.do(ctx, "GetKubernetesNodeGroup", true, func() error {
+		g, err = s.svc.GetKubernetesNodeGroup(ctx, r)
+		return err
+	})
+	return g, err
+}
+
+func (s *retryService) CreateKubernetesNodeGroup(ctx context.Context, r *request.CreateKubernetesNodeGroupRequest) (g *upcloud.KubernetesNodeGroup, err error) {
+	err = s.do(ctx, "CreateKubernetesNodeGroup", false, func() error {
+		g, err = s.svc.CreateKubernetesNodeGroup(ctx, r)
+		return err
+	})
+	return g, err
+}
+
+// ModifyKubernetesNodeGroup is idempotent because it sets the node group size instead of changing it
+func (s *retryService) ModifyKubernetesNodeGroup(ctx context.Context, r *request.ModifyKubernetesNodeGroupRequest) (g *upcloud.KubernetesNodeGroup, err error) {
+	err = s.do(ctx, "ModifyKubernetesNodeGroup", true, func() error {
+		g, err = s.svc.ModifyKubernetesNodeGroup(ctx, r)
+		return err
+	})
+	return g, err
+}
+
+func (s *retryService) DeleteKubernetesNodeGroup(ctx context.Context, r *request.DeleteKubernetesNodeGroupRequest) error {
+	return s.do(ctx, "DeleteKubernetesNodeGroup", false, func() error {
+		return s.svc.DeleteKubernetesNodeGroup(ctx, r)
+	})
+}
+
+func (s *retryService) DeleteKubernetesNodeGroupNode(ctx context.Context, r *request.DeleteKubernetesNodeGroupNodeRequest) error {
+	return s.do(ctx, "DeleteKubernetesNodeGroupNode", false, func() error {
+		return s.svc.DeleteKubernetesNodeGroupNode(ctx, r)
+	})
+}
+
+func (s *retryService) GetKubernetesPlans(ctx context.Context, r *request.GetKubernetesPlansRequest) (p []upcloud.KubernetesPlan, err error) {
+	err = s.do(ctx, "GetKubernetesPlans", true, func() error {
+		p, err = s.svc.GetKubernetesPlans(ctx, r)
+		return err
+	})
+	return p, err
+}
+
+func (s *retryService) GetPlans(ctx context.Context, r *sdkext.GetPlansRequest) (p []sdkext.Plan, err error) {
+	err = s.do(ctx, "GetPlans", true, func() error {
+		p, err = s.svc.GetPlans(ctx, r)
+		return err
+	})
+	return p, err
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/mocks"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+)
+
+func TestRetryService(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	mock := newMockService(clusterID)
+	svc := newTestRetryService(mock, 2)
+	ctx := context.Background()
+	getRequest := &request.GetKubernetesNodeGroupsRequest{ClusterUUID: clusterID.String()}
+
+	mock.SetFaults(mocks.Faults{RateLimitedCalls: 2})
+	groups, err := svc.GetKubernetesNodeGroups(ctx, getRequest)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+
+	// error is returned after retries are exhausted
+	mock.SetFaults(mocks.Faults{RateLimitedCalls: 3})
+	_, err = svc.GetKubernetesNodeGroups(ctx, getRequest)
+	requireProblemStatus(t, err, http.StatusTooManyRequests)
+	_, err = svc.GetKubernetesNodeGroups(ctx, getRequest)
+	require.NoError(t, err)
+
+	// server errors are not retried when request is not idempotent
+	mock.SetFaults(mocks.Faults{ErrorRate: 1, ErrorStatus: http.StatusBadGateway})
+	requireProblemStatus(t, svc.DeleteKubernetesNodeGroupNode(ctx, &request.DeleteKubernetesNodeGroupNodeRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+		NodeName:    "group1-node-0",
+	}), http.StatusBadGateway)
+
+	// permanent errors are returned immediately
+	mock.SetFaults(mocks.Faults{ErrorRate: 1, ErrorStatus: http.StatusNotFound})
+	start := time.Now()
+	_, err = newRetryService(mock, nil, 3).GetKubernetesNodeGroup(ctx, &request.GetKubernetesNodeGroupRequest{
+		ClusterUUID: clusterID.String(),
+		Name:        "group1",
+	})
+	requireProblemStatus(t, err, http.StatusNotFound)
+	require.Less(t, time.Since(start), retryBackoffInitial)
+}
+
+func TestIsTransientError(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, isTransientError(&upcloud.Problem{Status: http.StatusTooManyRequests}, false))
+	require.True(t, isTransientError(&upcloud.Problem{Status: http.StatusServiceUnavailable}, true))
+	require.False(t, isTransientError(&upcloud.Problem{Status: http.StatusServiceUnavailable}, false))
+	require.False(t, isTransientError(&upcloud.Problem{Status: http.StatusConflict}, true))
+	require.False(t, isTransientError(context.DeadlineExceeded, true))
+}
+
+// newTestRetryService returns retry service that doesn't wait between retries
+func newTestRetryService(svc upCloudService, retries int) *retryService {
+	s := newRetryService(svc, newAPIRateLimiter(1000), retries)
+	s.backoff = time.Millisecond
+	s.maxBackoff = time.Millisecond
+	return s
+}
+
+func requireProblemStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	var p *upcloud.Problem
+	require.ErrorAs(t, err, &p)
+	require.Equal(t, status, p.Status)
+}
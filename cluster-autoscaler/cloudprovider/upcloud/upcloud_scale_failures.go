@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+)
+
+// scaleFailureBackoff is the time a failed scaling operation of a node group is reported through its instances
+const scaleFailureBackoff time.Duration = 5 * time.Minute
+
+// scaleFailure is the latest failed scaling operation of a node group
+type scaleFailure struct {
+	operation ScaleOperationType
+	failedAt  time.Time
+	info      cloudprovider.InstanceErrorInfo
+	err       error
+}
+
+// scaleFailures tracks recent failed scaling operations of node groups. Recent scale-up failures are reported as
+// error info of nodes that node group hasn't created, so that CA backs off the node group and prefers other node
+// groups instead of retrying the failed node group in every loop. Nil scaleFailures doesn't track failures.
+type scaleFailures struct {
+	mu       sync.Mutex
+	failures map[string]scaleFailure
+}
+
+func newScaleFailures() *scaleFailures {
+	return &scaleFailures{failures: make(map[string]scaleFailure)}
+}
+
+// done records failed operation of the node group, or clears failure of the same operation type if it succeeded
+func (f *scaleFailures) done(name string, operation ScaleOperationType, err error) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		if failure, ok := f.failures[name]; ok && failure.operation == operation {
+			delete(f.failures, name)
+		}
+		return
+	}
+	info := apiErrorInfo(err)
+	var e *apiError
+	if errors.As(err, &e) {
+		info = e.info
+	}
+	f.failures[name] = scaleFailure{operation: operation, failedAt: time.Now(), info: info, err: err}
+}
+
+// get returns failure of the node group that happened within scaleFailureBackoff
+func (f *scaleFailures) get(name string) (scaleFailure, bool) {
+	if f == nil {
+		return scaleFailure{}, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	failure, ok := f.failures[name]
+	if !ok {
+		return scaleFailure{}, false
+	}
+	if time.Since(failure.failedAt) > scaleFailureBackoff {
+		delete(f.failures, name)
+		return scaleFailure{}, false
+	}
+	return failure, true
+}
+
+// errorInfo returns error info of nodes that node group hasn't created. Recent scale-up failure takes precedence
+// over the state of the node group, because it tells the cause of the failure, e.g. exhausted zone capacity.
+func (f *scaleFailures) errorInfo(name string, state upcloud.KubernetesNodeGroupState) *cloudprovider.InstanceErrorInfo {
+	failure, ok := f.get(name)
+	if !ok || failure.operation != ScaleOperationIncreaseSize {
+		return nodeGroupErrorInfo(state)
+	}
+	info := failure.info
+	return &info
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// ScaleOperationType is the type of node group scaling operation
+type ScaleOperationType string
+
+const (
+	// ScaleOperationIncreaseSize increases node group size
+	ScaleOperationIncreaseSize ScaleOperationType = "increase-size"
+	// ScaleOperationDecreaseTargetSize decreases node group target size
+	ScaleOperationDecreaseTargetSize ScaleOperationType = "decrease-target-size"
+	// ScaleOperationDeleteNodes deletes nodes from node group
+	ScaleOperationDeleteNodes ScaleOperationType = "delete-nodes"
+	// ScaleOperationForceDeleteNodes deletes stuck nodes from node group
+	ScaleOperationForceDeleteNodes ScaleOperationType = "force-delete-nodes"
+)
+
+// ScaleOperation describes node group scaling operation passed to scale hooks
+type ScaleOperation struct {
+	Type      ScaleOperationType
+	ClusterID string
+	NodeGroup string
+	// CurrentSize is the target size of the node group before the operation
+	CurrentSize int
+	// TargetSize is the requested target size of the node group
+	TargetSize int
+	// Nodes contains names of the nodes to be deleted
+	Nodes []string
+	// Annotations can be set by hooks, they are logged and passed on to subsequent hooks
+	Annotations map[string]string
+}
+
+// ScaleHook is implemented by external builds to apply organization specific policies, e.g. budget caps or
+// change freezes, to node group scaling operations. PreScaleUp and PreScaleDown are called before the operation
+// is sent to UpCloud API, returning an error vetoes the operation and blocking delays it. PostOperation is called
+// after the operation has finished with the operation error, if any.
+type ScaleHook interface {
+	PreScaleUp(ctx context.Context, op *ScaleOperation) error
+	PreScaleDown(ctx context.Context, op *ScaleOperation) error
+	PostOperation(ctx context.Context, op *ScaleOperation, err error)
+}
+
+var (
+	registeredScaleHooks   = make([]ScaleHook, 0)
+	registeredScaleHooksMu sync.Mutex
+)
+
+// RegisterScaleHook registers hook that is used by UpCloud cloud providers built after the call.
+// It's meant to be called e.g. from the init function of an external package.
+func RegisterScaleHook(h ScaleHook) {
+	registeredScaleHooksMu.Lock()
+	defer registeredScaleHooksMu.Unlock()
+	registeredScaleHooks = append(registeredScaleHooks, h)
+}
+
+// scaleHooks calls hooks in registration order
+type scaleHooks []ScaleHook
+
+func newScaleHooks() scaleHooks {
+	registeredScaleHooksMu.Lock()
+	defer registeredScaleHooksMu.Unlock()
+	return append(scaleHooks(nil), registeredScaleHooks...)
+}
+
+func (h scaleHooks) pre(ctx context.Context, op *ScaleOperation) error {
+	if len(h) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeoutScaleHook)
+	defer cancel()
+	for _, hook := range h {
+		var err error
+		if op.Type == ScaleOperationIncreaseSize {
+			err = hook.PreScaleUp(ctx, op)
+		} else {
+			err = hook.PreScaleDown(ctx, op)
+		}
+		if err != nil {
+			return fmt.Errorf("%s operation of node group %s/%s vetoed by scale hook: %w", op.Type, op.ClusterID, op.NodeGroup, err)
+		}
+	}
+	if len(op.Annotations) > 0 {
+		klog.V(logInfo).InfoS("scale operation annotated by scale hooks",
+			logKeyClusterID, op.ClusterID, logKeyNodeGroup, op.NodeGroup, logKeyOperation, op.Type, "annotations", op.Annotations)
+	}
+	return nil
+}
+
+// post runs hooks even when the provider is being cleaned up, so that they see the outcome of aborted operations
+func (h scaleHooks) post(op *ScaleOperation, err error) {
+	if len(h) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutScaleHook)
+	defer cancel()
+	for _, hook := range h {
+		hook.PostOperation(ctx, op, err)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/mocks"
+)
+
+type testScaleHook struct {
+	veto error
+	pre  []ScaleOperation
+	post []error
+}
+
+func (h *testScaleHook) PreScaleUp(_ context.Context, op *ScaleOperation) error {
+	op.Annotations["budget"] = "ok"
+	h.pre = append(h.pre, *op)
+	return h.veto
+}
+
+func (h *testScaleHook) PreScaleDown(_ context.Context, op *ScaleOperation) error {
+	h.pre = append(h.pre, *op)
+	return h.veto
+}
+
+func (h *testScaleHook) PostOperation(_ context.Context, op *ScaleOperation, err error) {
+	h.post = append(h.post, err)
+}
+
+func TestUpCloudNodeGroup_ScaleHooks(t *testing.T) {
+	t.Parallel()
+
+	clusterID := uuid.New()
+	fixture := mocks.NewTestNodeGroup("group1").WithNodes(2)
+	svc := mocks.NewTestCluster(clusterID).WithNodeGroups(fixture).Service()
+	// failed scale-up leaves requested node unprovisioned, so that target size can be decreased
+	svc.SetFaults(mocks.Faults{FailedScaleUps: map[string]bool{"group1": true}})
+	hook := &testScaleHook{}
+	g := newTestNodeGroup(clusterID, svc, fixture)
+	g.hooks = scaleHooks{hook}
+
+	require.NoError(t, g.IncreaseSize(1))
+	require.NoError(t, g.DecreaseTargetSize(-1))
+	require.NoError(t, g.DeleteNodes([]*v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "group1-node-1"}}}))
+	require.Len(t, hook.pre, 3)
+	require.Equal(t, ScaleOperation{
+		Type:        ScaleOperationIncreaseSize,
+		ClusterID:   clusterID.String(),
+		NodeGroup:   "group1",
+		CurrentSize: 2,
+		TargetSize:  3,
+		Annotations: map[string]string{"budget": "ok"},
+	}, hook.pre[0])
+	require.Equal(t, ScaleOperationDecreaseTargetSize, hook.pre[1].Type)
+	require.Equal(t, ScaleOperationDeleteNodes, hook.pre[2].Type)
+	require.Equal(t, []string{"group1-node-1"}, hook.pre[2].Nodes)
+	require.Equal(t, []error{nil, nil, nil}, hook.post)
+
+	// vetoed operations are not executed
+	hook.veto = errors.New("change freeze")
+	require.ErrorIs(t, g.IncreaseSize(1), hook.veto)
+	size, err := g.TargetSize()
+	require.NoError(t, err)
+	require.Equal(t, 1, size)
+	require.Len(t, hook.post, 3)
+}
+
+func TestRegisterScaleHook(t *testing.T) {
+	hook := &testScaleHook{}
+	RegisterScaleHook(hook)
+	t.Cleanup(func() {
+		registeredScaleHooksMu.Lock()
+		defer registeredScaleHooksMu.Unlock()
+		registeredScaleHooks = registeredScaleHooks[:len(registeredScaleHooks)-1]
+	})
+	hooks := newScaleHooks()
+	require.Len(t, hooks, 1)
+	require.Equal(t, hook, hooks[0])
+}
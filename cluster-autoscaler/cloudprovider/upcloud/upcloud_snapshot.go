@@ -0,0 +1,666 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/config/dynamic"
+)
+
+// snapshotVersion is increased when snapshot format changes in backward incompatible way
+const snapshotVersion int = 1
+
+// managerSnapshot is serializable internal state of the manager. It's used to reproduce
+// field-reported states in tests.
+type managerSnapshot struct {
+	Version        int                              `json:"version"`
+	ClusterID      string                           `json:"cluster_id"`
+	Zone           string                           `json:"zone,omitempty"`
+	MaxNodesTotal  int                              `json:"max_nodes_total"`
+	NodeGroupSpecs map[string]dynamic.NodeGroupSpec `json:"node_group_specs,omitempty"`
+	// AntiAffinityMaxNodes caps size of anti-affinity node groups
+	AntiAffinityMaxNodes int                 `json:"anti_affinity_max_nodes,omitempty"`
+	NodeGroups           []nodeGroupSnapshot `json:"node_groups"`
+	// PendingSizes are requested node group sizes that the API hasn't listed yet
+	PendingSizes map[string]pendingSizeSnapshot `json:"pending_sizes,omitempty"`
+	// ScaleFailures are the latest failed scaling operations of node groups
+	ScaleFailures map[string]scaleFailureSnapshot `json:"scale_failures,omitempty"`
+	// PendingNodes maps node group name to its pending nodes and the time they were first observed
+	PendingNodes map[string]map[string]time.Time `json:"pending_nodes,omitempty"`
+	// Instances is the cache of cluster node UUIDs
+	Instances instanceCacheSnapshot `json:"instances"`
+	// Details is the node group details cache, nil when caching is disabled
+	Details *nodeGroupCacheSnapshot `json:"details,omitempty"`
+	// Discovery are the auto-discovery label selectors, all node groups are managed when it's empty
+	Discovery []labelSelector `json:"discovery,omitempty"`
+	// SizeDefaults are default size limits of node groups, nil uses built-in defaults
+	SizeDefaults *sizeDefaultsSnapshot `json:"size_defaults,omitempty"`
+	// NodeGroupDefaults are autoscaling options that node group labels override
+	NodeGroupDefaults config.NodeGroupAutoscalingOptions `json:"node_group_defaults"`
+	// SystemPods are added to node group templates
+	SystemPods []systemPodSnapshot `json:"system_pods,omitempty"`
+	// Templates are the template overrides, nil when template overrides ConfigMap is not set
+	Templates *templateOverridesSnapshot `json:"templates,omitempty"`
+	// Schedule is the refresh schedule, nil when every refresh lists node groups
+	Schedule *refreshScheduleSnapshot `json:"schedule,omitempty"`
+	// Health is the API request and refresh health of the manager
+	Health *healthSnapshot `json:"health,omitempty"`
+	// Metrics are the node groups that have gauges
+	Metrics []string `json:"metrics,omitempty"`
+	// Plans are the server plans listed by the API
+	Plans map[string]planSnapshot `json:"plans,omitempty"`
+}
+
+// planSnapshot is serializable server plan, memory is in MiB and storage in GiB
+type planSnapshot struct {
+	Cores   int64  `json:"cores"`
+	Memory  int64  `json:"memory"`
+	Storage int64  `json:"storage,omitempty"`
+	GPUs    int64  `json:"gpus,omitempty"`
+	GPUType string `json:"gpu_type,omitempty"`
+}
+
+// sizeDefaultsSnapshot is serializable default size limits of node groups
+type sizeDefaultsSnapshot struct {
+	MinSize int `json:"min_size"`
+	MaxSize int `json:"max_size,omitempty"`
+}
+
+// systemPodSnapshot is serializable system pod of node group templates
+type systemPodSnapshot struct {
+	Name   string            `json:"name"`
+	CPU    resource.Quantity `json:"cpu"`
+	Memory resource.Quantity `json:"memory"`
+}
+
+// templateOverridesSnapshot is serializable template overrides and their ConfigMap
+type templateOverridesSnapshot struct {
+	Namespace string                      `json:"namespace"`
+	Name      string                      `json:"name"`
+	Overrides map[string]templateOverride `json:"overrides,omitempty"`
+}
+
+// refreshScheduleSnapshot is serializable refresh schedule
+type refreshScheduleSnapshot struct {
+	Interval time.Duration `json:"interval"`
+	Last     time.Time     `json:"last,omitempty"`
+}
+
+// healthSnapshot is serializable health of the manager, errors are stored as messages
+type healthSnapshot struct {
+	Started      time.Time `json:"started"`
+	LastRequest  time.Time `json:"last_request,omitempty"`
+	AuthError    string    `json:"auth_error,omitempty"`
+	LastRefresh  time.Time `json:"last_refresh,omitempty"`
+	RefreshError string    `json:"refresh_error,omitempty"`
+	Degraded     string    `json:"degraded,omitempty"`
+}
+
+// pendingSizeSnapshot is serializable requested size of the node group
+type pendingSizeSnapshot struct {
+	Size        int       `json:"size"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// scaleFailureSnapshot is serializable failed scaling operation of the node group
+type scaleFailureSnapshot struct {
+	Operation    ScaleOperationType `json:"operation"`
+	FailedAt     time.Time          `json:"failed_at"`
+	ErrorClass   string             `json:"error_class,omitempty"`
+	ErrorCode    string             `json:"error_code,omitempty"`
+	ErrorMessage string             `json:"error_message,omitempty"`
+	// Error is the message of the original error
+	Error string `json:"error,omitempty"`
+}
+
+// instanceCacheSnapshot is serializable cache of cluster node UUIDs
+type instanceCacheSnapshot struct {
+	UUIDs     []string  `json:"uuids,omitempty"`
+	FetchedAt time.Time `json:"fetched_at,omitempty"`
+}
+
+// nodeGroupCacheSnapshot is serializable node group details cache
+type nodeGroupCacheSnapshot struct {
+	TTL     time.Duration                          `json:"ttl"`
+	Entries map[string]nodeGroupCacheEntrySnapshot `json:"entries,omitempty"`
+}
+
+type nodeGroupCacheEntrySnapshot struct {
+	Details   *upcloud.KubernetesNodeGroupDetails `json:"details"`
+	FetchedAt time.Time                           `json:"fetched_at"`
+}
+
+// nodeGroupSnapshot is serializable state of the node group
+type nodeGroupSnapshot struct {
+	Name    string `json:"name"`
+	Size    int    `json:"size"`
+	MinSize int    `json:"min_size"`
+	MaxSize int    `json:"max_size"`
+	// LimitSource tells where MinSize and MaxSize come from
+	LimitSource string            `json:"limit_source,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Plan        string            `json:"plan,omitempty"`
+	// CustomPlan is set when node group uses custom plan
+	CustomPlan *sdkext.KubernetesNodeGroupCustomPlan `json:"custom_plan,omitempty"`
+	Taints     []apiv1.Taint                         `json:"taints,omitempty"`
+	// KubeletArgs are UpCloud node group kubelet arguments
+	KubeletArgs map[string]string `json:"kubelet_args,omitempty"`
+	// Autoprovisioned is set for node groups created by the autoscaler
+	Autoprovisioned bool `json:"autoprovisioned,omitempty"`
+	// ZeroOrMaxNodeScaling node group is scaled from zero to max size and back to zero all at once
+	ZeroOrMaxNodeScaling bool `json:"zero_or_max_node_scaling,omitempty"`
+	// AntiAffinityMaxNodes caps nodes of anti-affinity node group
+	AntiAffinityMaxNodes int `json:"anti_affinity_max_nodes,omitempty"`
+	// MaxNodeProvisionTime is the time atomic scale-up waits for new nodes
+	MaxNodeProvisionTime time.Duration `json:"max_node_provision_time,omitempty"`
+	// InitialNodes are the nodes created together with the node group that count towards the first scale-up
+	InitialNodes int `json:"initial_nodes,omitempty"`
+	// Theoretical is set until autoprovisioned node group is created
+	Theoretical bool               `json:"theoretical,omitempty"`
+	Nodes       []instanceSnapshot `json:"nodes"`
+}
+
+// instanceSnapshot is serializable state of the node group instance
+type instanceSnapshot struct {
+	ID           string `json:"id"`
+	State        string `json:"state,omitempty"`
+	ErrorClass   string `json:"error_class,omitempty"`
+	ErrorCode    string `json:"error_code,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+var (
+	snapshotInstanceStates = map[cloudprovider.InstanceState]string{
+		cloudprovider.InstanceRunning:  "running",
+		cloudprovider.InstanceCreating: "creating",
+		cloudprovider.InstanceDeleting: "deleting",
+	}
+	snapshotErrorClasses = map[cloudprovider.InstanceErrorClass]string{
+		cloudprovider.OutOfResourcesErrorClass: "out-of-resources",
+		cloudprovider.OtherErrorClass:          "other",
+	}
+)
+
+// snapshot returns point-in-time copy of manager's state. Times are in UTC, so that they are equal after decoding.
+func (m *manager) snapshot() managerSnapshot {
+	s := managerSnapshot{
+		Version:              snapshotVersion,
+		ClusterID:            m.clusterID.String(),
+		Zone:                 m.zone,
+		MaxNodesTotal:        m.maxNodesTotal,
+		NodeGroupSpecs:       m.nodeGroupSpecs,
+		NodeGroups:           make([]nodeGroupSnapshot, 0),
+		AntiAffinityMaxNodes: m.antiAffinityMaxNodes,
+		PendingSizes:         m.pending.snapshot(),
+		ScaleFailures:        m.failures.snapshot(),
+		PendingNodes:         m.pendingNodes.snapshot(),
+		Instances:            m.instances.snapshot(),
+		Details:              m.details.snapshot(),
+		NodeGroupDefaults:    m.nodeGroupDefaults,
+		Templates:            m.templates.snapshot(),
+		Schedule:             m.schedule.snapshot(),
+		Health:               m.health.snapshot(),
+		Metrics:              m.metrics.snapshot(),
+		Plans:                m.plans.snapshot(),
+	}
+	if len(m.discovery) > 0 {
+		s.Discovery = m.discovery
+	}
+	if m.sizeDefaults != nil {
+		s.SizeDefaults = &sizeDefaultsSnapshot{MinSize: m.sizeDefaults.minSize, MaxSize: m.sizeDefaults.maxSize}
+	}
+	for _, p := range m.systemPods {
+		s.SystemPods = append(s.SystemPods, systemPodSnapshot{Name: p.name, CPU: p.cpu, Memory: p.memory})
+	}
+	for _, g := range m.getNodeGroups() {
+		g.mu.RLock()
+		ng := nodeGroupSnapshot{
+			Name:                 g.name,
+			Size:                 g.size,
+			MinSize:              g.minSize,
+			MaxSize:              g.maxSize,
+			LimitSource:          g.limitSource,
+			Labels:               g.labels,
+			Plan:                 g.plan,
+			CustomPlan:           g.customPlan,
+			Taints:               g.taints,
+			KubeletArgs:          g.kubeletArgs,
+			Autoprovisioned:      g.autoprovisioned,
+			ZeroOrMaxNodeScaling: g.zeroOrMaxNodeScaling,
+			AntiAffinityMaxNodes: g.antiAffinityMaxNodes,
+			MaxNodeProvisionTime: g.maxNodeProvisionTime,
+			InitialNodes:         g.initialNodes,
+			Theoretical:          g.theoretical,
+			Nodes:                make([]instanceSnapshot, 0, len(g.nodes)),
+		}
+		for _, n := range g.nodes {
+			ng.Nodes = append(ng.Nodes, newInstanceSnapshot(n))
+		}
+		g.mu.RUnlock()
+		s.NodeGroups = append(s.NodeGroups, ng)
+	}
+	return s
+}
+
+// writeSnapshot writes manager's state to w as indented JSON
+func (m *manager) writeSnapshot(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m.snapshot())
+}
+
+// readSnapshot reads manager's state written by writeSnapshot and returns manager using svc to access API.
+func readSnapshot(r io.Reader, svc upCloudService) (*manager, error) {
+	var s managerSnapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("failed to decode manager snapshot: %w", err)
+	}
+	return newManagerFromSnapshot(s, svc)
+}
+
+// newManagerFromSnapshot restores manager's state from snapshot
+func newManagerFromSnapshot(s managerSnapshot, svc upCloudService) (*manager, error) {
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported manager snapshot version %d", s.Version)
+	}
+	clusterID, err := uuid.Parse(s.ClusterID)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot cluster ID %s is not valid UUID %w", s.ClusterID, err)
+	}
+	m := &manager{
+		clusterID:            clusterID,
+		zone:                 s.Zone,
+		svc:                  svc,
+		maxNodesTotal:        s.MaxNodesTotal,
+		antiAffinityMaxNodes: s.AntiAffinityMaxNodes,
+		nodeGroupSpecs:       s.NodeGroupSpecs,
+		discovery:            s.Discovery,
+		nodeGroupDefaults:    s.NodeGroupDefaults,
+		nodeGroups:           make([]*upCloudNodeGroup, 0, len(s.NodeGroups)),
+		hooks:                newScaleHooks(),
+		lifecycle:            newLifecycle(),
+		opLocks:              newNodeGroupLocks(),
+		pending:              newPendingSizes(),
+		failures:             newScaleFailures(),
+		pendingNodes:         newPendingNodes(),
+		plans:                newPlanCache(planCacheRefreshInterval),
+		watch:                newNodeGroupWatch(nodeGroupWatchMaxAge),
+		metrics:              newNodeGroupMetrics(),
+	}
+	if m.nodeGroupSpecs == nil {
+		m.nodeGroupSpecs = make(map[string]dynamic.NodeGroupSpec)
+	}
+	for name, p := range s.PendingSizes {
+		m.pending.sizes[name] = pendingSize{size: p.Size, requestedAt: p.RequestedAt}
+	}
+	for name, f := range s.ScaleFailures {
+		failure, err := f.failure()
+		if err != nil {
+			return nil, fmt.Errorf("node group %s: %w", name, err)
+		}
+		m.failures.failures[name] = failure
+	}
+	for name, nodes := range s.PendingNodes {
+		m.pendingNodes.firstSeen[name] = nodes
+	}
+	m.instances.uuids = make(map[string]struct{}, len(s.Instances.UUIDs))
+	for _, id := range s.Instances.UUIDs {
+		m.instances.uuids[id] = struct{}{}
+	}
+	m.instances.fetchedAt = s.Instances.FetchedAt
+	if s.SizeDefaults != nil {
+		m.sizeDefaults = &nodeGroupSizeDefaults{minSize: s.SizeDefaults.MinSize, maxSize: s.SizeDefaults.MaxSize}
+	}
+	for _, p := range s.SystemPods {
+		m.systemPods = append(m.systemPods, systemPod{name: p.Name, cpu: p.CPU, memory: p.Memory})
+	}
+	if s.Templates != nil {
+		m.templates = &templateOverrides{namespace: s.Templates.Namespace, name: s.Templates.Name, overrides: s.Templates.Overrides}
+		if m.templates.overrides == nil {
+			m.templates.overrides = make(map[string]templateOverride)
+		}
+	}
+	if s.Schedule != nil {
+		m.schedule = &refreshSchedule{interval: s.Schedule.Interval, last: s.Schedule.Last}
+	}
+	if s.Health != nil {
+		m.health = s.Health.health()
+		m.svc = newHealthService(svc, m.health)
+	}
+	for _, name := range s.Metrics {
+		m.metrics.names[name] = true
+	}
+	for name, p := range s.Plans {
+		m.plans.plans[name] = serverPlan{name: name, cores: p.Cores, memoryMiB: p.Memory, storageGiB: p.Storage, gpus: p.GPUs, gpuType: p.GPUType}
+	}
+	if s.Details != nil {
+		m.details = &nodeGroupCache{ttl: s.Details.TTL, entries: make(map[string]nodeGroupCacheEntry, len(s.Details.Entries))}
+		for name, e := range s.Details.Entries {
+			m.details.entries[name] = nodeGroupCacheEntry{details: e.Details, fetchedAt: e.FetchedAt}
+		}
+	}
+	for _, g := range s.NodeGroups {
+		nodes := make([]cloudprovider.Instance, 0, len(g.Nodes))
+		for _, n := range g.Nodes {
+			i, err := n.instance()
+			if err != nil {
+				return nil, fmt.Errorf("node group %s: %w", g.Name, err)
+			}
+			nodes = append(nodes, i)
+		}
+		m.nodeGroups = append(m.nodeGroups, &upCloudNodeGroup{
+			clusterID:            clusterID,
+			name:                 g.Name,
+			size:                 g.Size,
+			minSize:              g.MinSize,
+			maxSize:              g.MaxSize,
+			limitSource:          g.LimitSource,
+			labels:               g.Labels,
+			plan:                 g.Plan,
+			customPlan:           g.CustomPlan,
+			taints:               g.Taints,
+			kubeletArgs:          g.KubeletArgs,
+			zone:                 s.Zone,
+			autoprovisioned:      g.Autoprovisioned,
+			zeroOrMaxNodeScaling: g.ZeroOrMaxNodeScaling,
+			antiAffinityMaxNodes: g.AntiAffinityMaxNodes,
+			maxNodeProvisionTime: g.MaxNodeProvisionTime,
+			initialNodes:         g.InitialNodes,
+			theoretical:          g.Theoretical,
+			svc:                  m.svc,
+			hooks:                m.hooks,
+			details:              m.details,
+			schedule:             m.schedule,
+			lifecycle:            m.lifecycle,
+			opLocks:              m.opLocks,
+			pending:              m.pending,
+			failures:             m.failures,
+			plans:                m.plans,
+			watch:                m.watch,
+			templates:            m.templates,
+			systemPods:           m.systemPods,
+			nodes:                nodes,
+		})
+	}
+	return m, nil
+}
+
+func (p *pendingSizes) snapshot() map[string]pendingSizeSnapshot {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.sizes) == 0 {
+		return nil
+	}
+	s := make(map[string]pendingSizeSnapshot, len(p.sizes))
+	for name, size := range p.sizes {
+		s[name] = pendingSizeSnapshot{Size: size.size, RequestedAt: size.requestedAt.UTC()}
+	}
+	return s
+}
+
+func (f *scaleFailures) snapshot() map[string]scaleFailureSnapshot {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.failures) == 0 {
+		return nil
+	}
+	s := make(map[string]scaleFailureSnapshot, len(f.failures))
+	for name, failure := range f.failures {
+		fs := scaleFailureSnapshot{
+			Operation:    failure.operation,
+			FailedAt:     failure.failedAt.UTC(),
+			ErrorClass:   snapshotErrorClasses[failure.info.ErrorClass],
+			ErrorCode:    failure.info.ErrorCode,
+			ErrorMessage: failure.info.ErrorMessage,
+		}
+		if failure.err != nil {
+			fs.Error = failure.err.Error()
+		}
+		s[name] = fs
+	}
+	return s
+}
+
+func (s scaleFailureSnapshot) failure() (scaleFailure, error) {
+	f := scaleFailure{
+		operation: s.Operation,
+		failedAt:  s.FailedAt,
+		info: cloudprovider.InstanceErrorInfo{
+			ErrorCode:    s.ErrorCode,
+			ErrorMessage: s.ErrorMessage,
+		},
+	}
+	if s.ErrorClass != "" {
+		class, ok := snapshotKey(snapshotErrorClasses, s.ErrorClass)
+		if !ok {
+			return f, fmt.Errorf("unknown scale failure error class %s", s.ErrorClass)
+		}
+		f.info.ErrorClass = class
+	}
+	if s.Error != "" {
+		f.err = errors.New(s.Error)
+	}
+	return f, nil
+}
+
+func (p *pendingNodes) snapshot() map[string]map[string]time.Time {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.firstSeen) == 0 {
+		return nil
+	}
+	s := make(map[string]map[string]time.Time, len(p.firstSeen))
+	for name, nodes := range p.firstSeen {
+		s[name] = make(map[string]time.Time, len(nodes))
+		for id, firstSeen := range nodes {
+			s[name][id] = firstSeen.UTC()
+		}
+	}
+	return s
+}
+
+func (c *instanceCache) snapshot() instanceCacheSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := instanceCacheSnapshot{FetchedAt: c.fetchedAt.UTC()}
+	for id := range c.uuids {
+		s.UUIDs = append(s.UUIDs, id)
+	}
+	sort.Strings(s.UUIDs)
+	return s
+}
+
+func (c *nodeGroupCache) snapshot() *nodeGroupCacheSnapshot {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := &nodeGroupCacheSnapshot{TTL: c.ttl, Entries: make(map[string]nodeGroupCacheEntrySnapshot, len(c.entries))}
+	for name, e := range c.entries {
+		s.Entries[name] = nodeGroupCacheEntrySnapshot{Details: e.details, FetchedAt: e.fetchedAt.UTC()}
+	}
+	return s
+}
+
+func newInstanceSnapshot(i cloudprovider.Instance) instanceSnapshot {
+	s := instanceSnapshot{ID: i.Id}
+	if i.Status == nil {
+		return s
+	}
+	s.State = snapshotInstanceStates[i.Status.State]
+	if e := i.Status.ErrorInfo; e != nil {
+		s.ErrorClass = snapshotErrorClasses[e.ErrorClass]
+		s.ErrorCode = e.ErrorCode
+		s.ErrorMessage = e.ErrorMessage
+	}
+	return s
+}
+
+func (s instanceSnapshot) instance() (cloudprovider.Instance, error) {
+	i := cloudprovider.Instance{Id: s.ID}
+	if s.State == "" && s.ErrorClass == "" {
+		return i, nil
+	}
+	i.Status = &cloudprovider.InstanceStatus{}
+	if s.State != "" {
+		state, ok := snapshotKey(snapshotInstanceStates, s.State)
+		if !ok {
+			return i, fmt.Errorf("unknown instance %s state %s", s.ID, s.State)
+		}
+		i.Status.State = state
+	}
+	if s.ErrorClass != "" {
+		class, ok := snapshotKey(snapshotErrorClasses, s.ErrorClass)
+		if !ok {
+			return i, fmt.Errorf("unknown instance %s error class %s", s.ID, s.ErrorClass)
+		}
+		i.Status.ErrorInfo = &cloudprovider.InstanceErrorInfo{
+			ErrorClass:   class,
+			ErrorCode:    s.ErrorCode,
+			ErrorMessage: s.ErrorMessage,
+		}
+	}
+	return i, nil
+}
+
+func snapshotKey[K comparable](m map[K]string, value string) (K, bool) {
+	for k, v := range m {
+		if v == value {
+			return k, true
+		}
+	}
+	var k K
+	return k, false
+}
+
+func (t *templateOverrides) snapshot() *templateOverridesSnapshot {
+	if t == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	s := &templateOverridesSnapshot{Namespace: t.namespace, Name: t.name}
+	if len(t.overrides) > 0 {
+		s.Overrides = t.overrides
+	}
+	return s
+}
+
+func (s *refreshSchedule) snapshot() *refreshScheduleSnapshot {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &refreshScheduleSnapshot{Interval: s.interval, Last: s.last.UTC()}
+}
+
+func (h *health) snapshot() *healthSnapshot {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return &healthSnapshot{
+		Started:      h.started.UTC(),
+		LastRequest:  h.lastRequest.UTC(),
+		AuthError:    errorMessage(h.authErr),
+		LastRefresh:  h.lastRefresh.UTC(),
+		RefreshError: errorMessage(h.refreshErr),
+		Degraded:     errorMessage(h.degraded),
+	}
+}
+
+func (s healthSnapshot) health() *health {
+	return &health{
+		started:     s.Started,
+		lastRequest: s.LastRequest,
+		authErr:     snapshotError(s.AuthError),
+		lastRefresh: s.LastRefresh,
+		refreshErr:  snapshotError(s.RefreshError),
+		degraded:    snapshotError(s.Degraded),
+	}
+}
+
+func (m *nodeGroupMetrics) snapshot() []string {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// errorMessage returns message of the error, empty if err is nil
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// snapshotError returns error with the message, nil if the message is empty
+func snapshotError(message string) error {
+	if message == "" {
+		return nil
+	}
+	return errors.New(message)
+}
+
+func (c *planCache) snapshot() map[string]planSnapshot {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.plans) == 0 {
+		return nil
+	}
+	s := make(map[string]planSnapshot, len(c.plans))
+	for name, p := range c.plans {
+		s[name] = planSnapshot{Cores: p.cores, Memory: p.memoryMiB, Storage: p.storageGiB, GPUs: p.gpus, GPUType: p.gpuType}
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"fmt"
+	"math/rand"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/apis/scheduling"
+	kubetypes "k8s.io/kubernetes/pkg/kubelet/types"
+)
+
+// systemPod is a pod that UKS runs on every node
+type systemPod struct {
+	name   string
+	cpu    resource.Quantity
+	memory resource.Quantity
+}
+
+// uksSystemPods are the pods that UKS runs on every node in addition to kube-proxy, with their typical requests.
+// Their requests consume a noticeable part of small plans, e.g. 1xCPU-2GB. They are DaemonSet pods, which the
+// autoscaler adds to node templates itself, so they are only added when the autoscaler can't list their DaemonSets.
+var uksSystemPods = []systemPod{
+	{name: "cilium", cpu: resource.MustParse("100m"), memory: resource.MustParse("128Mi")},
+	{name: "csi-upcloud-node", cpu: resource.MustParse("20m"), memory: resource.MustParse("64Mi")},
+	{name: "konnectivity-agent", cpu: resource.MustParse("10m"), memory: resource.MustParse("32Mi")},
+}
+
+// buildSystemPods returns system pods of the node group template node. Pods are built as static pods, same way
+// as kube-proxy pod.
+func buildSystemPods(nodeName string, pods []systemPod) []*apiv1.Pod {
+	priority := scheduling.SystemCriticalPriority
+	p := make([]*apiv1.Pod, 0, len(pods))
+	for _, s := range pods {
+		p = append(p, &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%s-%d", s.name, nodeName, rand.Int63()), //nolint: gosec
+				Namespace: "kube-system",
+				Annotations: map[string]string{
+					kubetypes.ConfigSourceAnnotationKey: kubetypes.FileSource,
+					kubetypes.ConfigMirrorAnnotationKey: "1234567890abcdef",
+				},
+				Labels: map[string]string{
+					"k8s-app": s.name,
+					"tier":    "node",
+				},
+			},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{
+						Name:  s.name,
+						Image: s.name,
+						Resources: apiv1.ResourceRequirements{
+							Requests: apiv1.ResourceList{
+								apiv1.ResourceCPU:    s.cpu,
+								apiv1.ResourceMemory: s.memory,
+							},
+						},
+					},
+				},
+				Priority: &priority,
+			},
+		})
+	}
+	return p
+}
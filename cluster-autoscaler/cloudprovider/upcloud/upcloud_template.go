@@ -0,0 +1,145 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/gpu"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// gpuLabel is set on GPU nodes by NVIDIA GPU feature discovery
+	gpuLabel string = "nvidia.com/gpu.product"
+
+	// templateNodeMaxPods is kubelet's default maximum number of pods
+	templateNodeMaxPods int64 = 110
+	// kubeletArgMaxPods is the kubelet argument that sets maximum number of pods
+	kubeletArgMaxPods string = "max-pods"
+
+	// labelEphemeralStorage overrides ephemeral storage capacity of the node group nodes, e.g. when nodes use
+	// custom storage that differs from the plan's storage
+	labelEphemeralStorage string = labelPrefix + "ephemeral-storage"
+	// labelMaxPods overrides maximum number of pods of the node group nodes, e.g. when CNI limits pods per node
+	labelMaxPods string = labelPrefix + "max-pods"
+)
+
+// templateNode builds node object of an empty node of the node group
+func (u *upCloudNodeGroup) templateNode() (*apiv1.Node, error) {
+	plan, err := u.serverPlan()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build node group %s template: %w", u.name, err)
+	}
+	name := fmt.Sprintf("%s-template-%d", u.name, rand.Int63()) //nolint: gosec
+	capacity := apiv1.ResourceList{
+		apiv1.ResourceCPU:    *resource.NewQuantity(plan.cores, resource.DecimalSI),
+		apiv1.ResourceMemory: *resource.NewQuantity(plan.memoryMiB*1024*1024, resource.BinarySI),
+		apiv1.ResourcePods:   *resource.NewQuantity(u.maxPods(), resource.DecimalSI),
+	}
+	if storage, ok := u.ephemeralStorage(plan); ok {
+		capacity[apiv1.ResourceEphemeralStorage] = storage
+	}
+	labels := map[string]string{
+		apiv1.LabelOSStable:           cloudprovider.DefaultOS,
+		apiv1.LabelArchStable:         cloudprovider.DefaultArch,
+		apiv1.LabelHostname:           name,
+		apiv1.LabelInstanceTypeStable: u.plan,
+	}
+	// UpCloud doesn't group zones into regions, so zone is used as both region and zone
+	if u.zone != "" {
+		labels[apiv1.LabelTopologyRegion] = u.zone
+		labels[apiv1.LabelTopologyZone] = u.zone
+	}
+	if plan.gpus > 0 {
+		capacity[gpu.ResourceNvidiaGPU] = *resource.NewQuantity(plan.gpus, resource.DecimalSI)
+		labels[gpuLabel] = plan.gpuLabelValue()
+	}
+	node := &apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: cloudprovider.JoinStringMaps(labels, u.labels),
+		},
+		Spec: apiv1.NodeSpec{
+			Taints: u.taints,
+		},
+		Status: apiv1.NodeStatus{
+			Capacity:    capacity,
+			Allocatable: allocatable(u.name, capacity, u.kubeletArgs),
+			Conditions:  cloudprovider.BuildReadyConditions(),
+		},
+	}
+	if o, ok := u.templates.get(u.name); ok {
+		o.apply(node)
+	}
+	return node, nil
+}
+
+// ephemeralStorage returns ephemeral storage capacity of the node group nodes, which is the plan's storage size
+// unless it's overridden by the node group label
+func (u *upCloudNodeGroup) ephemeralStorage(plan serverPlan) (resource.Quantity, bool) {
+	if v, ok := u.labels[labelEphemeralStorage]; ok {
+		q, err := resource.ParseQuantity(v)
+		if err == nil && q.Sign() > 0 {
+			return q, true
+		}
+		klog.Warningf("ignoring node group %s label %s: invalid quantity '%s'", u.name, labelEphemeralStorage, v)
+	}
+	if plan.storageGiB <= 0 {
+		return resource.Quantity{}, false
+	}
+	return *resource.NewQuantity(plan.storageGiB<<30, resource.BinarySI), true
+}
+
+// maxPods returns maximum number of pods of the node group nodes. Node group label takes precedence over kubelet argument.
+func (u *upCloudNodeGroup) maxPods() int64 {
+	if v, ok := u.labels[labelMaxPods]; ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+		klog.Warningf("ignoring node group %s label %s: invalid number of pods '%s'", u.name, labelMaxPods, v)
+	}
+	if v, ok := u.kubeletArgs[kubeletArgMaxPods]; ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+		klog.Warningf("ignoring node group %s kubelet argument %s: invalid number of pods '%s'", u.name, kubeletArgMaxPods, v)
+	}
+	return templateNodeMaxPods
+}
+
+func nodeGroupTaints(taints []upcloud.KubernetesTaint) []apiv1.Taint {
+	if len(taints) == 0 {
+		return nil
+	}
+	t := make([]apiv1.Taint, 0, len(taints))
+	for _, taint := range taints {
+		t = append(t, apiv1.Taint{
+			Key:    taint.Key,
+			Value:  taint.Value,
+			Effect: apiv1.TaintEffect(taint.Effect),
+		})
+	}
+	return t
+}
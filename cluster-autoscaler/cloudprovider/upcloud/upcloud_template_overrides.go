@@ -0,0 +1,146 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultTemplateConfigMapNamespace is the namespace of template overrides ConfigMap when it's not set
+const defaultTemplateConfigMapNamespace string = "kube-system"
+
+// templateOverride extends template node of a node group with properties that UKS node groups can't express.
+// ConfigMap keys are node group names and values are YAML documents of template overrides.
+type templateOverride struct {
+	// Labels are added to template node labels
+	Labels map[string]string `json:"labels,omitempty"`
+	// Taints are added to template node taints
+	Taints []apiv1.Taint `json:"taints,omitempty"`
+	// Resources are added to template node capacity and allocatable, e.g. extended resources of device plugins
+	Resources apiv1.ResourceList `json:"resources,omitempty"`
+	// Allocatable replaces allocatable resources of template node
+	Allocatable apiv1.ResourceList `json:"allocatable,omitempty"`
+}
+
+// templateOverrides holds template overrides loaded from ConfigMap. Nil overrides doesn't change templates.
+type templateOverrides struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+
+	mu        sync.RWMutex
+	overrides map[string]templateOverride
+}
+
+// newTemplateOverrides returns overrides loaded from ConfigMap in format [<namespace>/]<name>, nil if ConfigMap is
+// not set
+func newTemplateOverrides(client kubernetes.Interface, configMap string) *templateOverrides {
+	if configMap == "" {
+		return nil
+	}
+	namespace, name := parseTemplateConfigMap(configMap)
+	return &templateOverrides{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		overrides: make(map[string]templateOverride),
+	}
+}
+
+func parseTemplateConfigMap(configMap string) (string, string) {
+	if namespace, name, ok := strings.Cut(configMap, "/"); ok {
+		return namespace, name
+	}
+	return defaultTemplateConfigMapNamespace, configMap
+}
+
+// validTemplateConfigMap returns true if configMap is in format [<namespace>/]<name>
+func validTemplateConfigMap(configMap string) bool {
+	namespace, name := parseTemplateConfigMap(configMap)
+	return namespace != "" && name != "" && !strings.Contains(name, "/")
+}
+
+// load reloads overrides from ConfigMap. Missing ConfigMap clears overrides, other errors keep the previous overrides.
+// Invalid node group overrides are ignored. Overrides restored from snapshot don't have client and are not reloaded.
+func (t *templateOverrides) load(ctx context.Context) error {
+	if t == nil || t.client == nil {
+		return nil
+	}
+	cm, err := t.client.CoreV1().ConfigMaps(t.namespace).Get(ctx, t.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.Warningf("template overrides ConfigMap %s/%s not found", t.namespace, t.name)
+		cm = &apiv1.ConfigMap{}
+	} else if err != nil {
+		return fmt.Errorf("failed to get template overrides ConfigMap %s/%s: %w", t.namespace, t.name, err)
+	}
+	overrides := make(map[string]templateOverride, len(cm.Data))
+	for name, data := range cm.Data {
+		var o templateOverride
+		if err := yaml.UnmarshalStrict([]byte(data), &o); err != nil {
+			klog.Warningf("ignoring node group %s template overrides in ConfigMap %s/%s: %v", name, t.namespace, t.name, err)
+			continue
+		}
+		overrides[name] = o
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.overrides = overrides
+	return nil
+}
+
+// get returns template overrides of the node group
+func (t *templateOverrides) get(name string) (templateOverride, bool) {
+	if t == nil {
+		return templateOverride{}, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	o, ok := t.overrides[name]
+	return o, ok
+}
+
+// apply applies overrides to template node
+func (o templateOverride) apply(node *apiv1.Node) {
+	for k, v := range o.Labels {
+		node.Labels[k] = v
+	}
+	node.Spec.Taints = append(append([]apiv1.Taint(nil), node.Spec.Taints...), o.Taints...)
+	for r, q := range o.Resources {
+		addQuantity(node.Status.Capacity, r, q)
+		addQuantity(node.Status.Allocatable, r, q)
+	}
+	for r, q := range o.Allocatable {
+		node.Status.Allocatable[r] = q
+	}
+}
+
+func addQuantity(resources apiv1.ResourceList, name apiv1.ResourceName, q resource.Quantity) {
+	sum := resources[name]
+	sum.Add(q)
+	resources[name] = sum
+}
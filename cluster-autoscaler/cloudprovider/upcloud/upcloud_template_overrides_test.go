@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTemplateOverrides(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "templates"},
+		Data: map[string]string{
+			"fuse": `
+labels:
+  role: build
+taints:
+  - key: dedicated
+    value: build
+    effect: NoSchedule
+resources:
+  smarter-devices/fuse: "20"
+allocatable:
+  memory: 3Gi
+`,
+			"invalid": "resources: lots",
+		},
+	}
+	client := fake.NewSimpleClientset(cm)
+	templates := newTemplateOverrides(client, "templates")
+	require.NoError(t, templates.load(ctx))
+	_, ok := templates.get("invalid")
+	require.False(t, ok)
+
+	g := &upCloudNodeGroup{
+		name:      "fuse",
+		plan:      "2xCPU-4GB",
+		labels:    map[string]string{"team": "ci"},
+		taints:    []v1.Taint{{Key: "spot", Effect: v1.TaintEffectPreferNoSchedule}},
+		templates: templates,
+	}
+	node, err := g.templateNode()
+	require.NoError(t, err)
+	require.Equal(t, "build", node.Labels["role"])
+	require.Equal(t, "ci", node.Labels["team"])
+	require.Equal(t, []v1.Taint{
+		{Key: "spot", Effect: v1.TaintEffectPreferNoSchedule},
+		{Key: "dedicated", Value: "build", Effect: v1.TaintEffectNoSchedule},
+	}, node.Spec.Taints)
+	require.Len(t, g.taints, 1, "node group taints are not modified")
+	fuse := node.Status.Capacity["smarter-devices/fuse"]
+	require.Equal(t, int64(20), fuse.Value())
+	fuse = node.Status.Allocatable["smarter-devices/fuse"]
+	require.Equal(t, int64(20), fuse.Value())
+	require.Equal(t, "3Gi", node.Status.Allocatable.Memory().String())
+	require.Equal(t, "4Gi", node.Status.Capacity.Memory().String())
+
+	// node groups without overrides are not changed
+	g.name = "other"
+	node, err = g.templateNode()
+	require.NoError(t, err)
+	_, ok = node.Status.Capacity["smarter-devices/fuse"]
+	require.False(t, ok)
+
+	// deleted ConfigMap clears overrides
+	require.NoError(t, client.CoreV1().ConfigMaps("kube-system").Delete(ctx, "templates", metav1.DeleteOptions{}))
+	require.NoError(t, templates.load(ctx))
+	_, ok = templates.get("fuse")
+	require.False(t, ok)
+
+	var disabled *templateOverrides
+	require.NoError(t, disabled.load(ctx))
+	_, ok = disabled.get("fuse")
+	require.False(t, ok)
+}
+
+func TestParseTemplateConfigMap(t *testing.T) {
+	t.Parallel()
+
+	namespace, name := parseTemplateConfigMap("templates")
+	require.Equal(t, "kube-system", namespace)
+	require.Equal(t, "templates", name)
+	namespace, name = parseTemplateConfigMap("autoscaler/templates")
+	require.Equal(t, "autoscaler", namespace)
+	require.Equal(t, "templates", name)
+
+	require.True(t, validTemplateConfigMap("autoscaler/templates"))
+	require.False(t, validTemplateConfigMap("/templates"))
+	require.False(t, validTemplateConfigMap("autoscaler/"))
+	require.False(t, validTemplateConfigMap("a/b/c"))
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/sdkext"
+	"k8s.io/component-base/tracing"
+	tracingapi "k8s.io/component-base/tracing/api/v1"
+)
+
+const (
+	// tracerName is the instrumentation scope of UpCloud API spans
+	tracerName string = "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud"
+	// tracingServiceName is the service name of exported spans
+	tracingServiceName string = "cluster-autoscaler"
+
+	attrOperation  = attribute.Key("upcloud.operation")
+	attrClusterID  = attribute.Key("upcloud.cluster_id")
+	attrNodeGroup  = attribute.Key("upcloud.node_group")
+	attrHTTPStatus = attribute.Key("http.response.status_code")
+	attrAttempt    = attribute.Key("upcloud.attempt")
+)
+
+// newTracerProvider returns provider that exports spans to OTLP gRPC endpoint, nil when endpoint is not set
+func newTracerProvider(ctx context.Context, cfg upCloudConfig) (tracing.TracerProvider, error) {
+	if cfg.TracingEndpoint == "" {
+		return nil, nil
+	}
+	rate := cfg.TracingSamplingRatePerMillion
+	return tracing.NewProvider(ctx, &tracingapi.TracingConfiguration{
+		Endpoint:               &cfg.TracingEndpoint,
+		SamplingRatePerMillion: &rate,
+	}, nil, []resource.Option{resource.WithAttributes(attribute.String("service.name", tracingServiceName))})
+}
+
+// tracingService records a span of every UpCloud API request, including its rate limiting and retries
+type tracingService struct {
+	svc    upCloudService
+	tracer oteltrace.Tracer
+}
+
+func newTracingService(svc upCloudService, tp oteltrace.TracerProvider) upCloudService {
+	if tp == nil {
+		return svc
+	}
+	return &tracingService{svc: svc, tracer: tp.Tracer(tracerName)}
+}
+
+func (s *tracingService) start(ctx context.Context, operation, clusterID, nodeGroup string) (context.Context, oteltrace.Span) {
+	attrs := []attribute.KeyValue{attrOperation.String(operation)}
+	if clusterID != "" {
+		attrs = append(attrs, attrClusterID.String(clusterID))
+	}
+	if nodeGroup != "" {
+		attrs = append(attrs, attrNodeGroup.String(nodeGroup))
+	}
+	return s.tracer.Start(ctx, "UpCloud "+operation, oteltrace.WithSpanKind(oteltrace.SpanKindClient), oteltrace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span, failed requests have the HTTP status code of API errors
+func endSpan(span oteltrace.Span, err error) {
+	defer span.End()
+	if err == nil {
+		return
+	}
+	var p *upcloud.Problem
+	if errors.As(err, &p) {
+		span.SetAttributes(attrHTTPStatus.Int(p.Status))
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// traceRetry adds retry event to the span of the request
+func traceRetry(ctx context.Context, attempt int, err error) {
+	oteltrace.SpanFromContext(ctx).AddEvent("retry", oteltrace.WithAttributes(attrAttempt.Int(attempt), attribute.String("error", err.Error())))
+}
+
+func (s *tracingService) GetKubernetesClusters(ctx context.Context, r *request.GetKubernetesClustersRequest) ([]upcloud.KubernetesCluster, error) {
+	ctx, span := s.start(ctx, "GetKubernetesClusters", "", "")
+	clusters, err := s.svc.GetKubernetesClusters(ctx, r)
+	endSpan(span, err)
+	return clusters, err
+}
+
+func (s *tracingService) GetKubernetesCluster(ctx context.Context, r *request.GetKubernetesClusterRequest) (*upcloud.KubernetesCluster, error) {
+	ctx, span := s.start(ctx, "GetKubernetesCluster", r.UUID, "")
+	cluster, err := s.svc.GetKubernetesCluster(ctx, r)
+	endSpan(span, err)
+	return cluster, err
+}
+
+func (s *tracingService) GetKubernetesNodeGroups(ctx context.Context, r *request.GetKubernetesNodeGroupsRequest) ([]sdkext.KubernetesNodeGroup, error) {
+	ctx, span := s.start(ctx, "GetKubernetesNodeGroups", r.ClusterUUID, "")
+	groups, err := s.svc.GetKubernetesNodeGroups(ctx, r)
+	endSpan(span, err)
+	return groups, err
+}
+
+func (s *tracingService) GetKubernetesNodeGroup(ctx context.Context, r *request.GetKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroupDetails, error) {
+	ctx, span := s.start(ctx, "GetKubernetesNodeGroup", r.ClusterUUID, r.Name)
+	group, err := s.svc.GetKubernetesNodeGroup(ctx, r)
+	endSpan(span, err)
+	return group, err
+}
+
+func (s *tracingService) CreateKubernetesNodeGroup(ctx context.Context, r *request.CreateKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error) {
+	ctx, span := s.start(ctx, "CreateKubernetesNodeGroup", r.ClusterUUID, r.NodeGroup.Name)
+	group, err := s.svc.CreateKubernetesNodeGroup(ctx, r)
+	endSpan(span, err)
+	return group, err
+}
+
+func (s *tracingService) ModifyKubernetesNodeGroup(ctx context.Context, r *request.ModifyKubernetesNodeGroupRequest) (*upcloud.KubernetesNodeGroup, error) {
+	ctx, span := s.start(ctx, "ModifyKubernetesNodeGroup", r.ClusterUUID, r.Name)
+	group, err := s.svc.ModifyKubernetesNodeGroup(ctx, r)
+	endSpan(span, err)
+	return group, err
+}
+
+func (s *tracingService) DeleteKubernetesNodeGroup(ctx context.Context, r *request.DeleteKubernetesNodeGroupRequest) error {
+	ctx, span := s.start(ctx, "DeleteKubernetesNodeGroup", r.ClusterUUID, r.Name)
+	err := s.svc.DeleteKubernetesNodeGroup(ctx, r)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingService) DeleteKubernetesNodeGroupNode(ctx context.Context, r *request.DeleteKubernetesNodeGroupNodeRequest) error {
+	ctx, span := s.start(ctx, "DeleteKubernetesNodeGroupNode", r.ClusterUUID, r.Name)
+	err := s.svc.DeleteKubernetesNodeGroupNode(ctx, r)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingService) GetKubernetesPlans(ctx context.Context, r *request.GetKubernetesPlansRequest) ([]upcloud.KubernetesPlan, error) {
+	ctx, span := s.start(ctx, "GetKubernetesPlans", "", "")
+	plans, err := s.svc.GetKubernetesPlans(ctx, r)
+	endSpan(span, err)
+	return plans, err
+}
+
+func (s *tracingService) GetPlans(ctx context.Context, r *sdkext.GetPlansRequest) ([]sdkext.Plan, error) {
+	ctx, span := s.start(ctx, "GetPlans", "", "")
+	plans, err := s.svc.GetPlans(ctx, r)
+	endSpan(span, err)
+	return plans, err
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upcloud
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/mocks"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/upcloud/pkg/github.com/upcloudltd/upcloud-go-api/v6/upcloud/request"
+)
+
+func TestTracingService(t *testing.T) {
+	t.Parallel()
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	clusterID := uuid.New()
+	mock := newMockService(clusterID)
+	svc := newTracingService(newTestRetryService(mock, 2), tp)
+
+	mock.SetFaults(mocks.Faults{RateLimitedCalls: 1})
+	_, err := svc.GetKubernetesNodeGroup(context.Background(), &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group1"})
+	require.NoError(t, err)
+	mock.SetFaults(mocks.Faults{ErrorRate: 1, ErrorStatus: http.StatusForbidden})
+	_, err = svc.GetKubernetesNodeGroup(context.Background(), &request.GetKubernetesNodeGroupRequest{ClusterUUID: clusterID.String(), Name: "group1"})
+	requireProblemStatus(t, err, http.StatusForbidden)
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "UpCloud GetKubernetesNodeGroup", spans[0].Name())
+	require.Subset(t, spans[0].Attributes(), []attribute.KeyValue{
+		attrOperation.String("GetKubernetesNodeGroup"),
+		attrClusterID.String(clusterID.String()),
+		attrNodeGroup.String("group1"),
+	})
+	// rate limited attempt is retried within the same span
+	require.Len(t, spans[0].Events(), 1)
+	require.Equal(t, "retry", spans[0].Events()[0].Name)
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	require.Contains(t, spans[1].Attributes(), attrHTTPStatus.Int(http.StatusForbidden))
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+
+	// service is not wrapped without tracer provider
+	require.Same(t, mock, newTracingService(mock, nil))
+}
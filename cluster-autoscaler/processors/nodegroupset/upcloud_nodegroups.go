@@ -0,0 +1,135 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroupset
+
+import (
+	"maps"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	klog "k8s.io/klog/v2"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// upCloudOptionLabelPrefix is the prefix of UpCloud node group labels that set autoscaling options of the node group.
+// They don't affect scheduling and often differ between otherwise identical node groups, e.g. their size limits.
+const upCloudOptionLabelPrefix = "autoscaler.upcloud.com/"
+
+// CreateUpCloudNodeInfoComparator returns a comparator that checks if two nodes should be considered
+// part of the same NodeGroupSet. Nodes of UpCloud node groups are similar if they have the same server plan,
+// labels and taints, regardless of their zone. Capacity and allocatable resources of nodes with the same plan are
+// compared too, because kubelet reservations, storage and extended resources can differ between node groups of
+// the same plan. Nodes without plan label are compared using IsCloudProviderNodeInfoSimilar.
+func CreateUpCloudNodeInfoComparator(extraIgnoredLabels []string, ratioOpts config.NodeGroupDifferenceRatios) NodeInfoComparator {
+	upCloudIgnoredLabels := make(map[string]bool)
+	for k, v := range BasicIgnoredLabels {
+		upCloudIgnoredLabels[k] = v
+	}
+	for _, k := range extraIgnoredLabels {
+		upCloudIgnoredLabels[k] = true
+	}
+
+	return func(n1, n2 *schedulerframework.NodeInfo) bool {
+		plan1 := n1.Node().Labels[apiv1.LabelInstanceTypeStable]
+		plan2 := n2.Node().Labels[apiv1.LabelInstanceTypeStable]
+		if plan1 == "" || plan2 == "" {
+			return IsCloudProviderNodeInfoSimilar(n1, n2, upCloudIgnoredLabels, ratioOpts)
+		}
+		if plan1 != plan2 {
+			klog.V(3).Infof("nodes %s and %s are not similar, plans %s and %s do not match", n1.Node().Name, n2.Node().Name, plan1, plan2)
+			return false
+		}
+		if !maps.Equal(upCloudNodeLabels(n1.Node(), upCloudIgnoredLabels), upCloudNodeLabels(n2.Node(), upCloudIgnoredLabels)) {
+			klog.V(3).Infof("nodes %s and %s are not similar, labels do not match", n1.Node().Name, n2.Node().Name)
+			return false
+		}
+		if !equalTaints(n1.Node().Spec.Taints, n2.Node().Spec.Taints) {
+			klog.V(3).Infof("nodes %s and %s are not similar, taints do not match", n1.Node().Name, n2.Node().Name)
+			return false
+		}
+		return upCloudResourcesSimilar(n1.Node(), n2.Node(), ratioOpts)
+	}
+}
+
+// upCloudResourcesSimilar returns whether nodes have the same capacity and allocatable resources within tolerance.
+// Like in IsCloudProviderNodeInfoSimilar, capacity other than memory must match exactly, so that e.g. nodes with
+// different GPU counts are not similar.
+func upCloudResourcesSimilar(n1, n2 *apiv1.Node, ratioOpts config.NodeGroupDifferenceRatios) bool {
+	capacity := make(map[apiv1.ResourceName][]resource.Quantity)
+	allocatable := make(map[apiv1.ResourceName][]resource.Quantity)
+	for _, node := range []*apiv1.Node{n1, n2} {
+		for res, quantity := range node.Status.Capacity {
+			capacity[res] = append(capacity[res], quantity)
+		}
+		for res, quantity := range node.Status.Allocatable {
+			allocatable[res] = append(allocatable[res], quantity)
+		}
+	}
+	for kind, qtyList := range capacity {
+		if len(qtyList) != 2 {
+			klog.V(3).Infof("nodes %s and %s are not similar, missing capacity %s", n1.Name, n2.Name, kind)
+			return false
+		}
+		if kind == apiv1.ResourceMemory {
+			if !resourceListWithinTolerance(qtyList, ratioOpts.MaxCapacityMemoryDifferenceRatio) {
+				klog.V(3).Infof("nodes %s and %s are not similar, memory not within tolerance", n1.Name, n2.Name)
+				return false
+			}
+		} else if qtyList[0].Cmp(qtyList[1]) != 0 {
+			klog.V(3).Infof("nodes %s and %s are not similar, %s does not match", n1.Name, n2.Name, kind)
+			return false
+		}
+	}
+	if !resourceMapsWithinTolerance(allocatable, ratioOpts.MaxAllocatableDifferenceRatio) {
+		klog.V(3).Infof("nodes %s and %s are not similar, allocatable resources not within tolerance", n1.Name, n2.Name)
+		return false
+	}
+	return true
+}
+
+// upCloudNodeLabels returns labels of the node that aren't ignored or autoscaling options of the node group
+func upCloudNodeLabels(node *apiv1.Node, ignoredLabels map[string]bool) map[string]string {
+	labels := make(map[string]string, len(node.Labels))
+	for k, v := range node.Labels {
+		if ignoredLabels[k] || strings.HasPrefix(k, upCloudOptionLabelPrefix) {
+			continue
+		}
+		labels[k] = v
+	}
+	return labels
+}
+
+// equalTaints returns whether both lists have the same taints in any order
+func equalTaints(t1, t2 []apiv1.Taint) bool {
+	if len(t1) != len(t2) {
+		return false
+	}
+	taints := make(map[apiv1.Taint]int, len(t1))
+	for _, t := range t1 {
+		taints[apiv1.Taint{Key: t.Key, Value: t.Value, Effect: t.Effect}]++
+	}
+	for _, t := range t2 {
+		k := apiv1.Taint{Key: t.Key, Value: t.Value, Effect: t.Effect}
+		if taints[k] == 0 {
+			return false
+		}
+		taints[k]--
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroupset
+
+import (
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+func buildUpCloudTestNode(name, plan, zone string) *apiv1.Node {
+	n := BuildTestNode(name, 2000, 4096*1024*1024)
+	n.Labels[apiv1.LabelInstanceTypeStable] = plan
+	n.Labels[apiv1.LabelTopologyRegion] = zone
+	n.Labels[apiv1.LabelTopologyZone] = zone
+	return n
+}
+
+func TestIsUpCloudNodeInfoSimilar(t *testing.T) {
+	comparator := CreateUpCloudNodeInfoComparator([]string{}, config.NewDefaultNodeGroupDifferenceRatios())
+
+	// nodes of the same plan in different zones are similar
+	n1 := buildUpCloudTestNode("node1", "2xCPU-4GB", "fi-hel1")
+	n2 := buildUpCloudTestNode("node2", "2xCPU-4GB", "de-fra1")
+	checkNodesSimilar(t, n1, n2, comparator, true)
+
+	// resources of nodes with the same plan are compared within tolerance
+	n2.Status.Allocatable[apiv1.ResourceMemory] = *resource.NewQuantity(4000*1024*1024, resource.BinarySI)
+	checkNodesSimilar(t, n1, n2, comparator, true)
+	n2.Status.Allocatable[apiv1.ResourceMemory] = *resource.NewQuantity(3000*1024*1024, resource.BinarySI)
+	checkNodesSimilar(t, n1, n2, comparator, false)
+	n2.Status.Allocatable[apiv1.ResourceMemory] = n1.Status.Allocatable[apiv1.ResourceMemory]
+
+	// extended resources must match, e.g. GPUs added to the node group template
+	n1.Status.Capacity["nvidia.com/gpu"] = *resource.NewQuantity(1, resource.DecimalSI)
+	n1.Status.Allocatable["nvidia.com/gpu"] = *resource.NewQuantity(1, resource.DecimalSI)
+	checkNodesSimilar(t, n1, n2, comparator, false)
+	n2.Status.Capacity["nvidia.com/gpu"] = *resource.NewQuantity(2, resource.DecimalSI)
+	n2.Status.Allocatable["nvidia.com/gpu"] = *resource.NewQuantity(2, resource.DecimalSI)
+	checkNodesSimilar(t, n1, n2, comparator, false)
+	n2.Status.Capacity["nvidia.com/gpu"] = *resource.NewQuantity(1, resource.DecimalSI)
+	n2.Status.Allocatable["nvidia.com/gpu"] = *resource.NewQuantity(1, resource.DecimalSI)
+	checkNodesSimilar(t, n1, n2, comparator, true)
+
+	// autoscaling options of node groups are ignored
+	n1.Labels["autoscaler.upcloud.com/max-size"] = "5"
+	n2.Labels["autoscaler.upcloud.com/scale-down-disabled"] = "true"
+	checkNodesSimilar(t, n1, n2, comparator, true)
+
+	// other labels must match
+	n1.Labels["workload"] = "web"
+	checkNodesSimilar(t, n1, n2, comparator, false)
+	n2.Labels["workload"] = "web"
+	checkNodesSimilar(t, n1, n2, comparator, true)
+
+	// taints must match regardless of their order
+	n1.Spec.Taints = []apiv1.Taint{{Key: "a", Value: "1", Effect: apiv1.TaintEffectNoSchedule}, {Key: "b", Effect: apiv1.TaintEffectNoExecute}}
+	checkNodesSimilar(t, n1, n2, comparator, false)
+	n2.Spec.Taints = []apiv1.Taint{{Key: "b", Effect: apiv1.TaintEffectNoExecute}, {Key: "a", Value: "1", Effect: apiv1.TaintEffectNoSchedule}}
+	checkNodesSimilar(t, n1, n2, comparator, true)
+	n2.Spec.Taints[1].Value = "2"
+	checkNodesSimilar(t, n1, n2, comparator, false)
+
+	// nodes of different plans are not similar
+	n3 := buildUpCloudTestNode("node3", "2xCPU-4GB", "fi-hel1")
+	n4 := buildUpCloudTestNode("node4", "DEV-2xCPU-4GB", "de-fra1")
+	checkNodesSimilar(t, n3, n4, comparator, false)
+
+	// nodes without plan are compared by their resources
+	n5 := BuildTestNode("node5", 1000, 2000)
+	n6 := BuildTestNode("node6", 1000, 2000)
+	checkNodesSimilar(t, n5, n6, comparator, true)
+	n6.Status.Capacity[apiv1.ResourceCPU] = *resource.NewMilliQuantity(2000, resource.DecimalSI)
+	checkNodesSimilar(t, n5, n6, comparator, false)
+}
+
+func TestFindSimilarNodeGroupsUpCloudBasic(t *testing.T) {
+	context := &context.AutoscalingContext{}
+	ni1, ni2, ni3 := buildBasicNodeGroups(context)
+	processor := &BalancingNodeGroupSetProcessor{Comparator: CreateUpCloudNodeInfoComparator([]string{}, config.NodeGroupDifferenceRatios{})}
+	basicSimilarNodeGroupsTest(t, context, processor, ni1, ni2, ni3)
+}